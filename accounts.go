@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+)
+
+// Регистрация пользователя: в хранилище попадает только хеш пароля
+func (s *server) registerUser(ctx context.Context, user User) error {
+	passwordHash, err := hashPassword(user.Password)
+	if err != nil {
+		return err
+	}
+	user.Password = passwordHash
+	return s.users.CreateUser(ctx, user)
+}
+
+// Функция для поиска пользователя по имени и паролю
+func (s *server) findUser(ctx context.Context, user *User) (bool, int, error) {
+	stored, err := s.users.GetUserByUsername(ctx, user.Username)
+	if err != nil {
+		// Если пользователь не найден, возвращаем false
+		if errors.Is(err, ErrNotFound) {
+			// Проверяем пароль по фиктивному хешу, чтобы время ответа не выдавало существование аккаунта
+			verifyPassword(dummyPasswordHash(), user.Password)
+			return false, 0, nil // Пользователь не найден
+		}
+		// Если ошибка другая, возвращаем её
+		return false, 0, err
+	}
+
+	ok, needsRehash, err := verifyPassword(stored.Password, user.Password)
+	if err != nil {
+		// Повреждённый хеш — не повод сообщать клиенту, что аккаунт существует: ответ как на неверный пароль
+		log.Printf("Ошибка при проверке пароля пользователя %d: %v", stored.ID, err)
+		return false, 0, nil
+	}
+	if !ok {
+		return false, 0, nil
+	}
+
+	// Хеш устарел (другой алгоритм, параметры или открытый текст) — перехешируем прозрачно для пользователя
+	if needsRehash {
+		if err := rehashPassword(ctx, s.users, stored.ID, stored.Password, user.Password); err != nil {
+			log.Printf("Rehash failed for user %d: %v", stored.ID, err)
+		}
+	}
+
+	// Если мы получаем id, значит, пользователь существует
+	return true, stored.ID, nil
+}
+
+// Пользователь по ID вместе с хешем пароля
+func (s *server) storedUser(ctx context.Context, userID int) (User, error) {
+	profile, err := s.users.GetProfile(ctx, userID)
+	if err != nil {
+		return User{}, err
+	}
+	return s.users.GetUserByUsername(ctx, profile.Username)
+}
+
+func rehashPassword(ctx context.Context, users UserStore, userID int, oldHash, password string) error {
+	passwordHash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	return users.UpdatePasswordHash(ctx, userID, oldHash, passwordHash)
+}
+
+// Одноразовая миграция: хеширует все пароли, которые ещё хранятся открытым текстом
+func migratePlaintextPasswords(ctx context.Context, st *pgStore) (int, error) {
+	users, err := st.plaintextPasswordUsers(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	migrated := 0
+	for _, u := range users {
+		err := rehashPassword(ctx, st, u.ID, u.Password, u.Password)
+		if errors.Is(err, ErrNotFound) {
+			// Пароль успели сменить — он уже захеширован
+			continue
+		}
+		if err != nil {
+			return migrated, err
+		}
+		migrated++
+	}
+	return migrated, nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// Ошибки авторизации доступа к данным.
+// Чужой ресурс для пользователя неотличим от несуществующего (404), чтобы по ID нельзя было
+// узнать о чужих данных. 403 возвращается, когда ресурс виден пользователю, но действие запрещено.
+var (
+	ErrNotFound  = errors.New("not found")
+	ErrForbidden = errors.New("forbidden")
+)
+
+type contextKey string
+
+// Ключ контекста, под которым tokenAuthMiddleware сохраняет userID
+const userIDKey contextKey = "userID"
+
+// Получение ID аутентифицированного пользователя из контекста запроса
+func userIDFromContext(r *http.Request) (int, error) {
+	userIDStr, ok := r.Context().Value(userIDKey).(string)
+	if !ok || userIDStr == "" {
+		return 0, fmt.Errorf("userID отсутствует в контексте запроса")
+	}
+	userID, err := strconv.Atoi(userIDStr)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка преобразования userID в int: %v", err)
+	}
+	return userID, nil
+}
+
+// Роли в блокноте. Роль распространяется на все страницы и задачи блокнота.
+const (
+	roleOwner  = "owner"  // всё, включая участников, передачу владения и удаление блокнота
+	roleEditor = "editor" // изменение блокнота, страниц и задач
+	roleViewer = "viewer" // только чтение
+)
+
+var roleRank = map[string]int{roleViewer: 1, roleEditor: 2, roleOwner: 3}
+
+// Роли в пространстве. Доступ к блокнотам пространства его участникам даёт роль по умолчанию.
+const (
+	workspaceAdmin  = "admin"  // участники, название, роль по умолчанию и удаление пространства
+	workspaceMember = "member" // блокноты пространства с ролью по умолчанию
+)
+
+// Роль по умолчанию «нет»: участникам пространства видны только свои и открытые им блокноты
+const roleNone = "none"
+
+// Доступ пользователя к блокноту, странице или задаче: блокнот и роль в нём
+type Access struct {
+	NotebookID int
+	Role       string
+}
+
+// Роль не ниже need
+func (a Access) Allows(need string) bool {
+	return roleRank[a.Role] >= roleRank[need]
+}
+
+// Проверка роли пользователя в блокноте
+func (s *server) authorizeNotebook(ctx context.Context, userID, notebookID int, need string) (Access, error) {
+	access, err := s.notebooks.NotebookAccess(ctx, notebookID, userID)
+	return checkRole(access, err, need)
+}
+
+// Проверка роли пользователя в блокноте страницы
+func (s *server) authorizePage(ctx context.Context, userID, pageID int, need string) (Access, error) {
+	access, err := s.pages.PageAccess(ctx, pageID, userID)
+	return checkRole(access, err, need)
+}
+
+// Проверка роли пользователя в блокноте задачи (задача → страница → блокнот)
+func (s *server) authorizeTask(ctx context.Context, userID, taskID int, need string) (Access, error) {
+	access, err := s.tasks.TaskAccess(ctx, taskID, userID)
+	return checkRole(access, err, need)
+}
+
+// Проверка участия в пространстве; need = workspaceAdmin требует роль администратора.
+// Не участник — ErrNotFound, не администратор — ErrForbidden.
+func (s *server) authorizeWorkspace(ctx context.Context, userID, workspaceID int, need string) (string, error) {
+	role, err := s.workspaces.WorkspaceRole(ctx, workspaceID, userID)
+	if err != nil {
+		return "", err
+	}
+	if need == workspaceAdmin && role != workspaceAdmin {
+		return role, ErrForbidden
+	}
+	return role, nil
+}
+
+// Блокнот без доступа — ErrNotFound (от хранилища), недостаточная роль — ErrForbidden
+func checkRole(access Access, err error, need string) (Access, error) {
+	if err != nil {
+		return Access{}, err
+	}
+	if !access.Allows(need) {
+		return access, ErrForbidden
+	}
+	return access, nil
+}
+
+func checkOwner(userID, ownerID int, err error) error {
+	if err != nil {
+		return err
+	}
+	if ownerID != userID {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Ответ на ошибку авторизации: 404/403 для отказа, 500 для ошибок базы данных
+func writeAuthzError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		http.Error(w, "Not Found", http.StatusNotFound)
+	case errors.Is(err, ErrForbidden):
+		http.Error(w, "Forbidden", http.StatusForbidden)
+	default:
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
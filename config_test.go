@@ -0,0 +1,117 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadConfigDefaults(t *testing.T) {
+	cfg, err := loadConfig("")
+	require.NoError(t, err)
+	assert.Equal(t, envDevelopment, cfg.Env)
+	assert.Equal(t, ":8080", cfg.Server.Addr())
+	assert.Equal(t, devDatabaseURL, cfg.Database.URL, "В разработке используется локальная база")
+	assert.Equal(t, 15*time.Minute, cfg.Auth.AccessTokenTTL)
+}
+
+func TestLoadConfigFileEnvAndSecretFile(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte(`
+env: production
+server:
+  port: 9090
+database:
+  url: postgresql://taskflow:filepass@db:5432/tasks
+auth:
+  access_token_ttl: 5m
+reminders:
+  smtp:
+    host: smtp.example.com
+    from: TaskFlow <noreply@example.com>
+mail:
+  driver: smtp
+`), 0o600))
+	secretPath := filepath.Join(dir, "refresh_secret")
+	require.NoError(t, os.WriteFile(secretPath, []byte("refresh-secret-from-file-0123456789\n"), 0o600))
+
+	t.Setenv("TASKFLOW_PORT", "9191")
+	t.Setenv("TASKFLOW_ACCESS_SECRET", "access-secret-from-env-0123456789")
+	t.Setenv("TASKFLOW_REFRESH_SECRET_FILE", secretPath)
+
+	cfg, err := loadConfig(configPath)
+	require.NoError(t, err)
+	assert.Equal(t, 9191, cfg.Server.Port, "Переменная окружения важнее файла")
+	assert.Equal(t, 5*time.Minute, cfg.Auth.AccessTokenTTL, "Значение из файла важнее значения по умолчанию")
+	assert.Equal(t, "refresh-secret-from-file-0123456789", cfg.Auth.RefreshSecret, "Секрет читается из *_FILE без перевода строки")
+
+	printed := cfg.String()
+	assert.NotContains(t, printed, "filepass")
+	assert.NotContains(t, printed, "access-secret-from-env")
+	assert.NotContains(t, printed, "refresh-secret-from-file")
+}
+
+func TestLoadConfigValidation(t *testing.T) {
+	t.Setenv("TASKFLOW_ENV", envProduction)
+	_, err := loadConfig("")
+	assert.Error(t, err, "В production секреты и база должны задаваться явно")
+
+	t.Setenv("TASKFLOW_ENV", envDevelopment)
+	t.Setenv("TASKFLOW_PORT", "70000")
+	_, err = loadConfig("")
+	assert.ErrorContains(t, err, "server.port")
+
+	t.Setenv("TASKFLOW_PORT", "not-a-number")
+	_, err = loadConfig("")
+	assert.ErrorContains(t, err, "TASKFLOW_PORT")
+
+	t.Setenv("TASKFLOW_PORT", "8080")
+	t.Setenv("TASKFLOW_SMTP_HOST", "smtp.example.com")
+	_, err = loadConfig("")
+	assert.ErrorContains(t, err, "reminders.smtp.from", "Для канала email нужен адрес отправителя")
+}
+
+func TestLoadConfigMail(t *testing.T) {
+	cfg, err := loadConfig("")
+	require.NoError(t, err)
+	assert.Equal(t, mailDriverLog, cfg.Mail.Driver, "В разработке письма пишутся в журнал")
+	assert.False(t, cfg.Mail.RequireVerifiedEmail)
+
+	t.Setenv("TASKFLOW_MAIL_DRIVER", mailDriverSMTP)
+	_, err = loadConfig("")
+	assert.ErrorContains(t, err, "reminders.smtp.host", "Для smtp нужен SMTP-сервер")
+
+	t.Setenv("TASKFLOW_ENV", envStaging)
+	t.Setenv("TASKFLOW_MAIL_DRIVER", mailDriverLog)
+	_, err = loadConfig("")
+	assert.ErrorContains(t, err, "mail.driver: log", "Вне разработки письма со ссылками не пишутся в журнал")
+
+	t.Setenv("TASKFLOW_ENV", envDevelopment)
+	t.Setenv("TASKFLOW_MAIL_DRIVER", "pigeon")
+	t.Setenv("TASKFLOW_MAIL_BASE_URL", "localhost:8080")
+	_, err = loadConfig("")
+	assert.ErrorContains(t, err, "mail.driver")
+	assert.ErrorContains(t, err, "mail.base_url")
+}
+
+func TestLoadConfigLoginThrottle(t *testing.T) {
+	cfg, err := loadConfig("")
+	require.NoError(t, err)
+	assert.Equal(t, loginThrottleMemory, cfg.Auth.LoginThrottle.Store)
+	assert.False(t, cfg.Auth.LoginThrottle.TrustProxy)
+
+	t.Setenv("TASKFLOW_LOGIN_THROTTLE_STORE", loginThrottlePostgres)
+	t.Setenv("TASKFLOW_TRUST_PROXY", "true")
+	cfg, err = loadConfig("")
+	require.NoError(t, err)
+	assert.Equal(t, loginThrottlePostgres, cfg.Auth.LoginThrottle.Store)
+	assert.True(t, cfg.Auth.LoginThrottle.TrustProxy)
+
+	t.Setenv("TASKFLOW_LOGIN_THROTTLE_STORE", "redis")
+	_, err = loadConfig("")
+	assert.ErrorContains(t, err, "auth.login_throttle.store")
+}
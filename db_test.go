@@ -1,168 +1,1449 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/stretchr/testify/assert"
-	"log"
+	"github.com/stretchr/testify/require"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
-// Mock пользователь для тестирования
-var testUser = User{
-	Username: "test_userrr",
-	Email:    "test_userrr@example.com",
-	Password: "password123",
+// Прогон теста на всех реализациях хранилища: в памяти всегда,
+// в PostgreSQL — если задан TASKFLOW_TEST_DATABASE_URL (миграции применяются автоматически)
+func forEachStore(t *testing.T, fn func(t *testing.T, st Store)) {
+	t.Run("memory", func(t *testing.T) {
+		fn(t, newMemoryStore())
+	})
+	t.Run("postgres", func(t *testing.T) {
+		url := os.Getenv("TASKFLOW_TEST_DATABASE_URL")
+		if url == "" {
+			t.Skip("TASKFLOW_TEST_DATABASE_URL не задан")
+		}
+		ctx := context.Background()
+		pool, err := pgxpool.New(ctx, url)
+		require.NoError(t, err)
+		defer pool.Close()
+		_, err = migrateUp(ctx, pool)
+		require.NoError(t, err)
+		fn(t, newPgStore(pool))
+	})
 }
-var testNotebook = Notebook{
-	UserID: 6,
-	Name:   "Test Notebook",
+
+// Пользователь с уникальным именем
+func seedUser(t *testing.T, st Store) User {
+	ctx := context.Background()
+	name := fmt.Sprintf("test_user_%d", time.Now().UnixNano())
+	require.NoError(t, st.CreateUser(ctx, User{Username: name, Email: name + "@example.com", Password: "password123"}))
+	user, err := st.GetUserByUsername(ctx, name)
+	require.NoError(t, err)
+	return user
 }
-var testPage = Page{
-	NotebookID: 8,
-	Title:      "Test Page",
-	Content:    "Test Content",
+
+// Личное пространство пользователя — выбранное по умолчанию
+func personalWorkspaceID(t *testing.T, st Store, userID int) int {
+	workspace, err := st.CurrentWorkspace(context.Background(), userID)
+	require.NoError(t, err)
+	require.True(t, workspace.Personal)
+	return workspace.ID
 }
-var testTask = Task{
-	PageID:      26,
-	Title:       "Test Task",
-	Description: "Test Description",
+
+func seedNotebook(t *testing.T, st Store, userID int) Notebook {
+	notebook, err := st.CreateNotebook(context.Background(), Notebook{UserID: userID, Name: "Test Notebook"})
+	require.NoError(t, err)
+	return notebook
 }
 
-func TestInsertUser(t *testing.T) {
-	if err := initDB(); err != nil {
-		log.Fatalf("Ошибка подключения к базе данных: %v", err)
-	}
-	defer closeDB()
-	err := insertUser(testUser)
-	if err != nil {
-		assert.Contains(t, err.Error(), "duplicate key", "Ошибка должна быть связана с уникальностью ключа, если пользователь уже существует")
-	} else {
-		assert.NoError(t, err, "Пользователь должен быть успешно добавлен")
-	}
-}
-
-/*func TestGetUserFromDB(t *testing.T) {
-	if err := initDB(); err != nil {
-		log.Fatalf("Ошибка подключения к базе данных: %v", err)
-	}
-	defer closeDB()
-	_, userID, err := findUser(&testUser)
+func seedPage(t *testing.T, st Store, notebookID int) Page {
+	page, err := st.CreatePage(context.Background(), Page{NotebookID: notebookID, Title: "Test Page", Content: "Test Content"})
 	require.NoError(t, err)
+	return page
+}
+
+func seedTask(t *testing.T, st Store, pageID int) Task {
+	ownerID, err := st.PageOwnerID(context.Background(), pageID)
+	require.NoError(t, err)
+	task, err := st.CreateTask(context.Background(), Task{PageID: pageID, Title: "Test Task", Description: "Test Description", Status: taskWorkflow.Initial}, ownerID)
+	require.NoError(t, err)
+	return task
+}
 
-	user, err := getUserFromDB(userID)
-	assert.NoError(t, err, "Получение пользователя из базы данных не должно вызывать ошибку")
-	assert.Equal(t, testUser.Username, user.Username, "Имена пользователей должны совпадать")
-}*/
+func dueAt(t time.Time) *time.Time {
+	return &t
+}
+
+func TestInsertUser(t *testing.T) {
+	forEachStore(t, func(t *testing.T, st Store) {
+		user := seedUser(t, st)
+		assert.NotZero(t, user.ID, "Пользователь должен быть успешно добавлен")
+
+		err := st.CreateUser(context.Background(), User{Username: user.Username, Email: "other@example.com", Password: "x"})
+		assert.ErrorIs(t, err, ErrDuplicateKey, "Ошибка должна быть связана с уникальностью ключа, если пользователь уже существует")
+
+		_, err = st.GetUserByUsername(context.Background(), "no_such_user")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+}
+
+func TestUpdatePasswordHash(t *testing.T) {
+	forEachStore(t, func(t *testing.T, st Store) {
+		ctx := context.Background()
+		user := seedUser(t, st)
+
+		require.NoError(t, st.UpdatePasswordHash(ctx, user.ID, "password123", "new-hash"))
+		assert.ErrorIs(t, st.UpdatePasswordHash(ctx, user.ID, "password123", "other-hash"), ErrNotFound, "Хеш уже сменился")
+		assert.ErrorIs(t, st.UpdatePasswordHash(ctx, user.ID+1000, "new-hash", "other-hash"), ErrNotFound)
+
+		stored, err := st.GetUserByUsername(ctx, user.Username)
+		require.NoError(t, err)
+		assert.Equal(t, "new-hash", stored.Password)
+	})
+}
 
 func TestInsertNotebook(t *testing.T) {
-	if err := initDB(); err != nil {
-		log.Fatalf("Ошибка подключения к базе данных: %v", err)
-	}
-	defer closeDB()
-	err := insertNotebook(testNotebook)
-	assert.NoError(t, err, "Блокнот должен быть успешно добавлен")
+	forEachStore(t, func(t *testing.T, st Store) {
+		user := seedUser(t, st)
+		notebook, err := st.CreateNotebook(context.Background(), Notebook{UserID: user.ID, Name: "Test Notebook"})
+		assert.NoError(t, err, "Блокнот должен быть успешно добавлен")
+		assert.NotZero(t, notebook.ID, "Должен возвращаться id, сгенерированный базой")
+		assert.Equal(t, user.ID, notebook.UserID)
+		assert.Equal(t, "Test Notebook", notebook.Name)
+		assert.False(t, notebook.CreatedAt.IsZero(), "Должно возвращаться время создания")
+		assert.False(t, notebook.UpdatedAt.IsZero())
+
+		notebooks, err := st.ListNotebooks(context.Background(), user.ID, personalWorkspaceID(t, st, user.ID))
+		require.NoError(t, err)
+		assert.Equal(t, notebook.ID, notebooks[0].ID)
+	})
 }
 
 func TestGetNotebooksByUserID(t *testing.T) {
-	if err := initDB(); err != nil {
-		log.Fatalf("Ошибка подключения к базе данных: %v", err)
-	}
-	defer closeDB()
-	notebooks, err := getNotebooksByUserID(testNotebook.UserID)
-	assert.NoError(t, err, "Получение блокнотов пользователя не должно возвращать ошибку")
-	assert.NotEmpty(t, notebooks, "Список блокнотов не должен быть пустым")
+	forEachStore(t, func(t *testing.T, st Store) {
+		user := seedUser(t, st)
+		seedNotebook(t, st, user.ID)
+		notebooks, err := st.ListNotebooks(context.Background(), user.ID, personalWorkspaceID(t, st, user.ID))
+		assert.NoError(t, err, "Получение блокнотов пользователя не должно возвращать ошибку")
+		assert.NotEmpty(t, notebooks, "Список блокнотов не должен быть пустым")
+
+		ownerID, err := st.NotebookOwnerID(context.Background(), notebooks[0].ID)
+		assert.NoError(t, err)
+		assert.Equal(t, user.ID, ownerID)
+	})
 }
 
 func TestUpdateNotebook(t *testing.T) {
-	if err := initDB(); err != nil {
-		log.Fatalf("Ошибка подключения к базе данных: %v", err)
-	}
-	defer closeDB()
-	testNotebook.Name = "Updated Notebook"
-	err := UpdateNotebook(testNotebook)
-	assert.NoError(t, err, "Обновление блокнота не должно вызывать ошибку")
+	forEachStore(t, func(t *testing.T, st Store) {
+		user := seedUser(t, st)
+		notebook := seedNotebook(t, st, user.ID)
+		notebook.Name = "Updated Notebook"
+		updated, err := st.UpdateNotebook(context.Background(), notebook)
+		assert.NoError(t, err, "Обновление блокнота не должно вызывать ошибку")
+		assert.Equal(t, "Updated Notebook", updated.Name)
+		assert.Equal(t, user.ID, updated.UserID, "Обновление возвращает запись целиком")
+		assert.False(t, updated.UpdatedAt.Before(notebook.UpdatedAt))
+
+		notebooks, err := st.ListNotebooks(context.Background(), user.ID, personalWorkspaceID(t, st, user.ID))
+		require.NoError(t, err)
+		assert.Equal(t, "Updated Notebook", notebooks[0].Name)
+
+		_, err = st.UpdateNotebook(context.Background(), Notebook{ID: -1, Name: "x"})
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
 }
 
 func TestDeleteNotebook(t *testing.T) {
-	if err := initDB(); err != nil {
-		log.Fatalf("Ошибка подключения к базе данных: %v", err)
-	}
-	defer closeDB()
-	err := DeleteNotebook(testNotebook)
-	assert.NoError(t, err, "Удаление блокнота не должно вызывать ошибку")
+	forEachStore(t, func(t *testing.T, st Store) {
+		user := seedUser(t, st)
+		notebook := seedNotebook(t, st, user.ID)
+		page := seedPage(t, st, notebook.ID)
+		task := seedTask(t, st, page.ID)
+
+		err := st.DeleteNotebook(context.Background(), notebook.ID)
+		assert.NoError(t, err, "Удаление блокнота не должно вызывать ошибку")
+
+		// Страницы и задачи удаляются каскадно
+		_, err = st.PageOwnerID(context.Background(), page.ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+		_, err = st.TaskOwnerID(context.Background(), task.ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
 }
 
 func TestInsertPage(t *testing.T) {
-	if err := initDB(); err != nil {
-		log.Fatalf("Ошибка подключения к базе данных: %v", err)
-	}
-	defer closeDB()
-	err := insertPage(testPage)
-	assert.NoError(t, err, "Страница должна быть успешно добавлена")
+	forEachStore(t, func(t *testing.T, st Store) {
+		user := seedUser(t, st)
+		notebook := seedNotebook(t, st, user.ID)
+		page, err := st.CreatePage(context.Background(), Page{NotebookID: notebook.ID, Title: "Test Page", Content: "Test Content"})
+		assert.NoError(t, err, "Страница должна быть успешно добавлена")
+		assert.NotZero(t, page.ID)
+		assert.Equal(t, notebook.ID, page.NotebookID)
+		assert.False(t, page.CreatedAt.IsZero())
+	})
 }
 
 func TestGetPagesByNotebookID(t *testing.T) {
-	if err := initDB(); err != nil {
-		log.Fatalf("Ошибка подключения к базе данных: %v", err)
-	}
-	defer closeDB()
-	pages, err := getPagesByNotebookID(testPage.NotebookID)
-	assert.NoError(t, err, "Получение страниц блокнота не должно возвращать ошибку")
-	assert.NotEmpty(t, pages, "Список страниц не должен быть пустым")
+	forEachStore(t, func(t *testing.T, st Store) {
+		user := seedUser(t, st)
+		notebook := seedNotebook(t, st, user.ID)
+		seedPage(t, st, notebook.ID)
+		pages, err := st.ListPages(context.Background(), notebook.ID)
+		assert.NoError(t, err, "Получение страниц блокнота не должно возвращать ошибку")
+		assert.NotEmpty(t, pages, "Список страниц не должен быть пустым")
+
+		ownerID, err := st.PageOwnerID(context.Background(), pages[0].ID)
+		assert.NoError(t, err)
+		assert.Equal(t, user.ID, ownerID)
+	})
 }
 
 func TestUpdatePage(t *testing.T) {
-	if err := initDB(); err != nil {
-		log.Fatalf("Ошибка подключения к базе данных: %v", err)
-	}
-	defer closeDB()
-	testPage.Title = "Updated Page"
-	err := UpdatePage(testPage)
-	assert.NoError(t, err, "Обновление страницы не должно вызывать ошибку")
+	forEachStore(t, func(t *testing.T, st Store) {
+		user := seedUser(t, st)
+		page := seedPage(t, st, seedNotebook(t, st, user.ID).ID)
+		page.Title = "Updated Page"
+		updated, err := st.UpdatePage(context.Background(), page)
+		assert.NoError(t, err, "Обновление страницы не должно вызывать ошибку")
+		assert.Equal(t, "Updated Page", updated.Title)
+		assert.Equal(t, page.Content, updated.Content)
+
+		_, err = st.UpdatePage(context.Background(), Page{ID: -1})
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
 }
 
 func TestDeletePage(t *testing.T) {
-	if err := initDB(); err != nil {
-		log.Fatalf("Ошибка подключения к базе данных: %v", err)
-	}
-	defer closeDB()
-	err := DeletePage(testPage)
-	assert.NoError(t, err, "Удаление страницы не должно вызывать ошибку")
+	forEachStore(t, func(t *testing.T, st Store) {
+		user := seedUser(t, st)
+		page := seedPage(t, st, seedNotebook(t, st, user.ID).ID)
+		err := st.DeletePage(context.Background(), page.ID)
+		assert.NoError(t, err, "Удаление страницы не должно вызывать ошибку")
+	})
 }
 
 func TestInsertTask(t *testing.T) {
-	if err := initDB(); err != nil {
-		log.Fatalf("Ошибка подключения к базе данных: %v", err)
-	}
-	defer closeDB()
-	err := insertTask(testTask)
-	assert.NoError(t, err, "Задача должна быть успешно добавлена")
+	forEachStore(t, func(t *testing.T, st Store) {
+		user := seedUser(t, st)
+		page := seedPage(t, st, seedNotebook(t, st, user.ID).ID)
+		task, err := st.CreateTask(context.Background(), Task{PageID: page.ID, Title: "Test Task", Description: "Test Description"}, user.ID)
+		assert.NoError(t, err, "Задача должна быть успешно добавлена")
+		assert.NotZero(t, task.ID)
+		assert.Equal(t, page.ID, task.PageID)
+		assert.False(t, task.CreatedAt.IsZero())
+		assert.Nil(t, task.DueDate, "Задача без срока не должна получать срок по умолчанию")
+	})
 }
 
 func TestGetTasksByPageID(t *testing.T) {
-	if err := initDB(); err != nil {
-		log.Fatalf("Ошибка подключения к базе данных: %v", err)
-	}
-	defer closeDB()
-	tasks, err := getTasksByPageID(testTask.PageID)
-	assert.NoError(t, err, "Получение задач страницы не должно возвращать ошибку")
-	assert.NotEmpty(t, tasks, "Список задач не должен быть пустым")
+	forEachStore(t, func(t *testing.T, st Store) {
+		user := seedUser(t, st)
+		page := seedPage(t, st, seedNotebook(t, st, user.ID).ID)
+		seedTask(t, st, page.ID)
+		tasks, err := st.ListTasks(context.Background(), page.ID)
+		assert.NoError(t, err, "Получение задач страницы не должно возвращать ошибку")
+		assert.NotEmpty(t, tasks, "Список задач не должен быть пустым")
+
+		ownerID, err := st.TaskOwnerID(context.Background(), tasks[0].ID)
+		assert.NoError(t, err)
+		assert.Equal(t, user.ID, ownerID)
+	})
 }
 
 func TestUpdateTask(t *testing.T) {
-	if err := initDB(); err != nil {
-		log.Fatalf("Ошибка подключения к базе данных: %v", err)
-	}
-	defer closeDB()
-	testTask.Title = "Updated Task"
-	err := UpdateTask(testTask)
-	assert.NoError(t, err, "Обновление задачи не должно вызывать ошибку")
+	forEachStore(t, func(t *testing.T, st Store) {
+		user := seedUser(t, st)
+		task := seedTask(t, st, seedPage(t, st, seedNotebook(t, st, user.ID).ID).ID)
+		task.Title = "Updated Task"
+		updated, err := st.UpdateTask(context.Background(), task)
+		assert.NoError(t, err, "Обновление задачи не должно вызывать ошибку")
+		assert.Equal(t, "Updated Task", updated.Title)
+		assert.Equal(t, task.PageID, updated.PageID)
+
+		_, err = st.UpdateTask(context.Background(), Task{ID: -1})
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+}
+
+func TestPatchTask(t *testing.T) {
+	forEachStore(t, func(t *testing.T, st Store) {
+		ctx := context.Background()
+		user := seedUser(t, st)
+		task := seedTask(t, st, seedPage(t, st, seedNotebook(t, st, user.ID).ID).ID)
+
+		due := time.Date(2030, 1, 2, 10, 0, 0, 0, time.UTC)
+		patch := TaskPatch{FromStatus: task.Status, ChangedBy: user.ID}
+		patch.Status = optional[string]{Set: true, Value: "done"}
+		patch.Priority = optional[int]{Set: true, Value: 3}
+		patch.DueDate = optional[time.Time]{Set: true, Value: due}
+		patched, err := st.PatchTask(ctx, task.ID, patch)
+		require.NoError(t, err, "Частичное обновление задачи не должно вызывать ошибку")
+		assert.Equal(t, "done", patched.Status)
+		assert.Equal(t, 3, patched.Priority)
+		require.NotNil(t, patched.DueDate)
+		assert.True(t, due.Equal(*patched.DueDate))
+		assert.Equal(t, task.Title, patched.Title, "Непереданные поля не меняются")
+		assert.Equal(t, task.Description, patched.Description)
+		assert.False(t, patched.UpdatedAt.Before(task.UpdatedAt))
+
+		// null в description очищает описание
+		patched, err = st.PatchTask(ctx, task.ID, TaskPatch{Description: optional[string]{Set: true, Null: true}})
+		require.NoError(t, err)
+		assert.Equal(t, "", patched.Description)
+		assert.Equal(t, "done", patched.Status)
+
+		_, err = st.PatchTask(ctx, -1, TaskPatch{})
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+}
+
+func TestTaskStatusHistory(t *testing.T) {
+	forEachStore(t, func(t *testing.T, st Store) {
+		ctx := context.Background()
+		user := seedUser(t, st)
+		task := seedTask(t, st, seedPage(t, st, seedNotebook(t, st, user.ID).ID).ID)
+
+		_, err := st.PatchTask(ctx, task.ID, TaskPatch{
+			Status:     optional[string]{Set: true, Value: "in_progress"},
+			FromStatus: task.Status,
+			ChangedBy:  user.ID,
+		})
+		require.NoError(t, err)
+
+		// Переход проверялся от устаревшего статуса — конфликт, статус не меняется
+		_, err = st.PatchTask(ctx, task.ID, TaskPatch{
+			Status:     optional[string]{Set: true, Value: "done"},
+			FromStatus: task.Status,
+			ChangedBy:  user.ID,
+		})
+		assert.ErrorIs(t, err, ErrStatusConflict)
+
+		// Изменение без смены статуса в историю не попадает
+		_, err = st.PatchTask(ctx, task.ID, TaskPatch{Title: optional[string]{Set: true, Value: "Renamed"}})
+		require.NoError(t, err)
+
+		history, err := st.TaskStatusHistory(ctx, task.ID)
+		require.NoError(t, err)
+		require.Len(t, history, 2)
+		assert.Nil(t, history[0].FromStatus, "Первая запись — создание задачи")
+		assert.Equal(t, "todo", history[0].ToStatus)
+		require.NotNil(t, history[1].FromStatus)
+		assert.Equal(t, "todo", *history[1].FromStatus)
+		assert.Equal(t, "in_progress", history[1].ToStatus)
+		require.NotNil(t, history[1].UserID)
+		assert.Equal(t, user.ID, *history[1].UserID)
+	})
+}
+
+func TestListUserTasksPagination(t *testing.T) {
+	forEachStore(t, func(t *testing.T, st Store) {
+		ctx := context.Background()
+		user := seedUser(t, st)
+		other := seedUser(t, st)
+		notebook := seedNotebook(t, st, user.ID)
+		pages := []Page{seedPage(t, st, notebook.ID), seedPage(t, st, notebook.ID)}
+		seedTask(t, st, seedPage(t, st, seedNotebook(t, st, other.ID).ID).ID) // чужая задача
+
+		// 7 задач на двух страницах с повторяющимися приоритетами и сроками
+		base := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+		for i := 0; i < 7; i++ {
+			_, err := st.CreateTask(ctx, Task{
+				PageID:   pages[i%2].ID,
+				Title:    fmt.Sprintf("task %d", i),
+				Status:   "todo",
+				Priority: i % 3,
+				DueDate:  dueAt(base.Add(time.Duration(i%2) * time.Hour)),
+			}, user.ID)
+			require.NoError(t, err)
+		}
+
+		keys, err := parseTaskSort("-priority,due_date")
+		require.NoError(t, err)
+		var all []Task
+		filter := TaskFilter{UserID: user.ID, Sort: keys, Limit: 3}
+		for {
+			page, err := st.ListUserTasks(ctx, filter)
+			require.NoError(t, err)
+			all = append(all, page...)
+			if len(page) < filter.Limit {
+				break
+			}
+			filter.After = taskKeyValues(page[len(page)-1], keys)
+		}
+
+		require.Len(t, all, 7, "Все задачи пользователя без повторов и пропусков, чужие не попадают")
+		for i := 1; i < len(all); i++ {
+			assert.Negative(t, compareTaskToKeys(all[i-1], keys, taskKeyValues(all[i], keys)), "Порядок строго возрастает по ключам")
+		}
+
+		minPriority := 2
+		filtered, err := st.ListUserTasks(ctx, TaskFilter{UserID: user.ID, PriorityGTE: &minPriority, NotebookID: notebook.ID, Sort: keys, Limit: 10})
+		require.NoError(t, err)
+		assert.Len(t, filtered, 2)
+	})
+}
+
+func TestSearch(t *testing.T) {
+	forEachStore(t, func(t *testing.T, st Store) {
+		ctx := context.Background()
+		user := seedUser(t, st)
+		other := seedUser(t, st)
+
+		notebook, err := st.CreateNotebook(ctx, Notebook{UserID: user.ID, Name: "Квартальный план"})
+		require.NoError(t, err)
+		page, err := st.CreatePage(ctx, Page{NotebookID: notebook.ID, Title: "Budget", Content: "квартальный бюджет команды"})
+		require.NoError(t, err)
+		task, err := st.CreateTask(ctx, Task{PageID: page.ID, Title: "Собрать квартальный отчёт", Status: "todo"}, user.ID)
+		require.NoError(t, err)
+		_, err = st.CreateNotebook(ctx, Notebook{UserID: other.ID, Name: "Квартальный чужой"})
+		require.NoError(t, err)
+
+		results, err := st.Search(ctx, user.ID, personalWorkspaceID(t, st, user.ID), "квартальный", 10)
+		require.NoError(t, err)
+		require.Len(t, results, 3, "Ищутся блокноты, страницы и задачи только этого пользователя")
+
+		var found SearchResult
+		for _, r := range results {
+			assert.Contains(t, r.Snippet, "<mark>")
+			if r.Type == "task" {
+				found = r
+			}
+		}
+		assert.Equal(t, task.ID, found.ID)
+		assert.Equal(t, notebook.Name, found.NotebookName, "У задачи есть путь: блокнот → страница")
+		require.NotNil(t, found.PageID)
+		assert.Equal(t, page.ID, *found.PageID)
+
+		results, err = st.Search(ctx, user.ID, personalWorkspaceID(t, st, user.ID), "budget", 10)
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		assert.Equal(t, "page", results[0].Type)
+	})
+}
+
+func TestPatchNotebookAndPage(t *testing.T) {
+	forEachStore(t, func(t *testing.T, st Store) {
+		ctx := context.Background()
+		user := seedUser(t, st)
+		notebook := seedNotebook(t, st, user.ID)
+		page := seedPage(t, st, notebook.ID)
+
+		patchedNotebook, err := st.PatchNotebook(ctx, notebook.ID, NotebookPatch{Name: optional[string]{Set: true, Value: "Renamed"}})
+		require.NoError(t, err)
+		assert.Equal(t, "Renamed", patchedNotebook.Name)
+
+		patchedPage, err := st.PatchPage(ctx, page.ID, PagePatch{Content: optional[string]{Set: true, Value: "New content"}})
+		require.NoError(t, err)
+		assert.Equal(t, "New content", patchedPage.Content)
+		assert.Equal(t, page.Title, patchedPage.Title)
+	})
 }
 
 func TestDeleteTask(t *testing.T) {
-	if err := initDB(); err != nil {
-		log.Fatalf("Ошибка подключения к базе данных: %v", err)
-	}
-	defer closeDB()
-	err := DeleteTask(testTask)
-	assert.NoError(t, err, "Удаление задачи не должно вызывать ошибку")
+	forEachStore(t, func(t *testing.T, st Store) {
+		user := seedUser(t, st)
+		task := seedTask(t, st, seedPage(t, st, seedNotebook(t, st, user.ID).ID).ID)
+		err := st.DeleteTask(context.Background(), task.ID)
+		assert.NoError(t, err, "Удаление задачи не должно вызывать ошибку")
+	})
+}
+
+func TestSubtasks(t *testing.T) {
+	forEachStore(t, func(t *testing.T, st Store) {
+		ctx := context.Background()
+		user := seedUser(t, st)
+		parent := seedTask(t, st, seedPage(t, st, seedNotebook(t, st, user.ID).ID).ID)
+
+		newSubtask := func(parentID int, status string) Task {
+			task, err := st.CreateTask(ctx, Task{PageID: parent.PageID, ParentID: &parentID, Title: "Subtask", Status: status}, user.ID)
+			require.NoError(t, err)
+			return task
+		}
+		child := newSubtask(parent.ID, "in_progress")
+		cancelled := newSubtask(parent.ID, "cancelled")
+		grandchild := newSubtask(child.ID, "todo")
+		require.NotNil(t, grandchild.ParentID)
+		assert.Equal(t, child.ID, *grandchild.ParentID)
+
+		// Рекурсивное завершение не трогает отменённые подзадачи
+		_, err := st.PatchTask(ctx, parent.ID, TaskPatch{
+			Status:      optional[string]{Set: true, Value: "done"},
+			FromStatus:  parent.Status,
+			ChangedBy:   user.ID,
+			Cascade:     true,
+			CascadeSkip: []string{"cancelled"},
+		})
+		require.NoError(t, err)
+		for id, want := range map[int]string{child.ID: "done", grandchild.ID: "done", cancelled.ID: "cancelled"} {
+			task, err := st.GetTask(ctx, id)
+			require.NoError(t, err)
+			assert.Equal(t, want, task.Status)
+		}
+		history, err := st.TaskStatusHistory(ctx, grandchild.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "done", history[len(history)-1].ToStatus, "Каскадная смена статуса попадает в историю")
+
+		// Удаление родителя удаляет всё поддерево вместе с чек-листами
+		_, err = st.CreateChecklistItem(ctx, ChecklistItem{TaskID: grandchild.ID, Title: "Item"})
+		require.NoError(t, err)
+		require.NoError(t, st.DeleteTask(ctx, parent.ID))
+		tasks, err := st.ListTasks(ctx, parent.PageID)
+		require.NoError(t, err)
+		assert.Empty(t, tasks)
+		items, err := st.ListChecklistItems(ctx, []int{grandchild.ID})
+		require.NoError(t, err)
+		assert.Empty(t, items)
+	})
+}
+
+func TestChecklistItems(t *testing.T) {
+	forEachStore(t, func(t *testing.T, st Store) {
+		ctx := context.Background()
+		user := seedUser(t, st)
+		page := seedPage(t, st, seedNotebook(t, st, user.ID).ID)
+		task, other := seedTask(t, st, page.ID), seedTask(t, st, page.ID)
+
+		first, err := st.CreateChecklistItem(ctx, ChecklistItem{TaskID: task.ID, Title: "First"})
+		require.NoError(t, err)
+		second, err := st.CreateChecklistItem(ctx, ChecklistItem{TaskID: task.ID, Title: "Second"})
+		require.NoError(t, err)
+		assert.Greater(t, second.Position, first.Position, "Новый пункт добавляется в конец")
+
+		patched, err := st.PatchChecklistItem(ctx, task.ID, first.ID, ChecklistItemPatch{Done: optional[bool]{Set: true, Value: true}})
+		require.NoError(t, err)
+		assert.True(t, patched.Done)
+		assert.Equal(t, "First", patched.Title)
+
+		items, err := st.ListChecklistItems(ctx, []int{task.ID, other.ID})
+		require.NoError(t, err)
+		require.Len(t, items, 2)
+		assert.Equal(t, first.ID, items[0].ID)
+
+		// Пункт чужой задачи не найден
+		_, err = st.PatchChecklistItem(ctx, other.ID, first.ID, ChecklistItemPatch{Done: optional[bool]{Set: true, Value: false}})
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.ErrorIs(t, st.DeleteChecklistItem(ctx, other.ID, first.ID), ErrNotFound)
+
+		require.NoError(t, st.DeleteChecklistItem(ctx, task.ID, first.ID))
+		items, err = st.ListChecklistItems(ctx, []int{task.ID})
+		require.NoError(t, err)
+		require.Len(t, items, 1)
+		assert.Equal(t, second.ID, items[0].ID)
+	})
+}
+
+func TestLabels(t *testing.T) {
+	forEachStore(t, func(t *testing.T, st Store) {
+		ctx := context.Background()
+		user := seedUser(t, st)
+		notebook := seedNotebook(t, st, user.ID)
+		page := seedPage(t, st, notebook.ID)
+		otherPage := seedPage(t, st, notebook.ID)
+
+		newLabel := func(name string) Label {
+			label, err := st.CreateLabel(ctx, Label{UserID: user.ID, Name: name, Color: defaultLabelColor})
+			require.NoError(t, err)
+			return label
+		}
+		bug, urgent, backend := newLabel("bug"), newLabel("urgent"), newLabel("backend")
+
+		_, err := st.CreateLabel(ctx, Label{UserID: user.ID, Name: "bug", Color: defaultLabelColor})
+		assert.ErrorIs(t, err, ErrDuplicateKey, "Имя метки уникально в пределах пользователя")
+		_, err = st.CreateLabel(ctx, Label{UserID: seedUser(t, st).ID, Name: "bug", Color: defaultLabelColor})
+		assert.NoError(t, err, "У другого пользователя может быть метка с тем же именем")
+		_, err = st.PatchLabel(ctx, urgent.ID, LabelPatch{Name: optional[string]{Set: true, Value: "bug"}})
+		assert.ErrorIs(t, err, ErrDuplicateKey)
+
+		patched, err := st.PatchLabel(ctx, urgent.ID, LabelPatch{Color: optional[string]{Set: true, Value: "#ff0000"}})
+		require.NoError(t, err)
+		assert.Equal(t, "#ff0000", patched.Color)
+		assert.Equal(t, "urgent", patched.Name)
+
+		labels, err := st.ListLabels(ctx, user.ID)
+		require.NoError(t, err)
+		require.Len(t, labels, 3)
+		assert.Equal(t, "backend", labels[0].Name, "Метки отсортированы по имени")
+
+		// Задачи: одна с bug+urgent, одна только с bug, одна без меток
+		both, onlyBug := seedTask(t, st, page.ID), seedTask(t, st, page.ID)
+		seedTask(t, st, page.ID)
+		require.NoError(t, st.SetTaskLabels(ctx, user.ID, both.ID, []int{bug.ID, urgent.ID}))
+		require.NoError(t, st.SetTaskLabels(ctx, user.ID, onlyBug.ID, []int{urgent.ID}))
+		require.NoError(t, st.SetTaskLabels(ctx, user.ID, onlyBug.ID, []int{bug.ID}), "Набор меток заменяется целиком")
+
+		taskLabels, err := st.TaskLabels(ctx, user.ID, onlyBug.ID)
+		require.NoError(t, err)
+		require.Len(t, taskLabels, 1)
+		assert.Equal(t, bug.ID, taskLabels[0].ID)
+
+		keys, err := parseTaskSort("")
+		require.NoError(t, err)
+		listTasks := func(f LabelFilter) []int {
+			tasks, err := st.ListUserTasks(ctx, TaskFilter{UserID: user.ID, Labels: f, Sort: keys, Limit: 10})
+			require.NoError(t, err)
+			var ids []int
+			for _, task := range tasks {
+				ids = append(ids, task.ID)
+			}
+			return ids
+		}
+		assert.Equal(t, []int{both.ID, onlyBug.ID}, listTasks(LabelFilter{IDs: []int{urgent.ID, bug.ID}}))
+		assert.Equal(t, []int{both.ID}, listTasks(LabelFilter{IDs: []int{urgent.ID, bug.ID}, MatchAll: true}))
+		assert.Empty(t, listTasks(LabelFilter{IDs: []int{backend.ID}}))
+
+		require.NoError(t, st.SetPageLabels(ctx, user.ID, otherPage.ID, []int{backend.ID}))
+		pages, err := st.ListPagesByLabels(ctx, notebook.ID, LabelFilter{IDs: []int{backend.ID}})
+		require.NoError(t, err)
+		require.Len(t, pages, 1)
+		assert.Equal(t, otherPage.ID, pages[0].ID)
+
+		// Удаление метки снимает её со всех задач и страниц
+		require.NoError(t, st.DeleteLabel(ctx, bug.ID))
+		assert.Equal(t, []int{both.ID}, listTasks(LabelFilter{IDs: []int{urgent.ID}}))
+		taskLabels, err = st.TaskLabels(ctx, user.ID, both.ID)
+		require.NoError(t, err)
+		assert.Len(t, taskLabels, 1)
+		_, err = st.LabelOwnerID(ctx, bug.ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+}
+
+func TestRecurringTaskCompletion(t *testing.T) {
+	forEachStore(t, func(t *testing.T, st Store) {
+		ctx := context.Background()
+		user := seedUser(t, st)
+		page := seedPage(t, st, seedNotebook(t, st, user.ID).ID)
+		due := time.Date(2030, 1, 7, 9, 0, 0, 0, time.UTC)
+		task, err := st.CreateTask(ctx, Task{PageID: page.ID, Title: "Chore", Status: "review", DueDate: &due, Recurrence: "FREQ=WEEKLY;BYDAY=MO"}, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "FREQ=WEEKLY;BYDAY=MO", task.Recurrence)
+		label, err := st.CreateLabel(ctx, Label{UserID: user.ID, Name: "ops", Color: defaultLabelColor})
+		require.NoError(t, err)
+		require.NoError(t, st.SetTaskLabels(ctx, user.ID, task.ID, []int{label.ID}))
+		minutes := 60
+		_, err = st.CreateReminder(ctx, Reminder{TaskID: task.ID, UserID: user.ID, MinutesBefore: &minutes, Channel: channelInApp})
+		require.NoError(t, err)
+
+		next := task
+		next.Status, next.DueDate = "todo", dueAt(due.AddDate(0, 0, 7))
+		patch := TaskPatch{Status: optional[string]{Set: true, Value: "done"}, FromStatus: task.Status, ChangedBy: user.ID, Next: &next}
+		done, err := st.PatchTask(ctx, task.ID, patch)
+		require.NoError(t, err)
+		assert.Equal(t, "", done.Recurrence, "Правило переходит к следующему повторению")
+
+		// Повторное выполнение без смены статуса новых задач не создаёт
+		patch.FromStatus = "done"
+		_, err = st.PatchTask(ctx, task.ID, patch)
+		require.NoError(t, err)
+
+		tasks, err := st.ListTasks(ctx, page.ID)
+		require.NoError(t, err)
+		require.Len(t, tasks, 2)
+		created := tasks[1]
+		assert.Equal(t, "todo", created.Status)
+		assert.Equal(t, "FREQ=WEEKLY;BYDAY=MO", created.Recurrence)
+		assert.True(t, due.AddDate(0, 0, 7).Equal(*created.DueDate))
+		labels, err := st.TaskLabels(ctx, user.ID, created.ID)
+		require.NoError(t, err)
+		assert.Len(t, labels, 1, "Метки копируются в следующее повторение")
+		reminders, err := st.ListReminders(ctx, created.ID, user.ID)
+		require.NoError(t, err)
+		require.Len(t, reminders, 1, "Напоминания относительно срока копируются в следующее повторение")
+		assert.True(t, due.AddDate(0, 0, 7).Add(-time.Hour).Equal(*reminders[0].FireAt))
+		history, err := st.TaskStatusHistory(ctx, created.ID)
+		require.NoError(t, err)
+		assert.Len(t, history, 1)
+	})
+}
+
+func TestListUserTasksByDue(t *testing.T) {
+	forEachStore(t, func(t *testing.T, st Store) {
+		ctx := context.Background()
+		user := seedUser(t, st)
+		assert.Equal(t, "UTC", user.TimeZone, "Часовой пояс по умолчанию")
+		require.NoError(t, st.UpdateUserTimeZone(ctx, user.ID, "Europe/Moscow"))
+		user, err := st.GetUser(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "Europe/Moscow", user.TimeZone)
+		assert.ErrorIs(t, st.UpdateUserTimeZone(ctx, -1, "UTC"), ErrNotFound)
+
+		page := seedPage(t, st, seedNotebook(t, st, user.ID).ID)
+		now := time.Date(2030, 3, 1, 22, 0, 0, 0, time.UTC) // в Москве уже 2 марта
+		create := func(title, status string, due *time.Time, allDay bool) {
+			_, err := st.CreateTask(ctx, Task{PageID: page.ID, Title: title, Status: status, DueDate: due, DueAllDay: allDay}, user.ID)
+			require.NoError(t, err)
+		}
+		create("undated", "todo", nil, false)
+		create("tonight", "todo", dueAt(time.Date(2030, 3, 1, 23, 30, 0, 0, time.UTC)), false)
+		create("yesterday", "todo", dueAt(time.Date(2030, 3, 1, 0, 0, 0, 0, time.UTC)), true)
+		create("finished", "done", dueAt(time.Date(2030, 2, 1, 0, 0, 0, 0, time.UTC)), false)
+
+		keys, err := parseTaskSort("due_date")
+		require.NoError(t, err)
+		titles := func(due string) []string {
+			tasks, err := st.ListUserTasks(ctx, TaskFilter{UserID: user.ID, Due: due, DueWindow: newDueWindow(now, userLocation(user.TimeZone)), Sort: keys, Limit: 10})
+			require.NoError(t, err)
+			var titles []string
+			for _, task := range tasks {
+				titles = append(titles, task.Title)
+			}
+			return titles
+		}
+		assert.Equal(t, []string{"tonight"}, titles(dueToday))
+		assert.Equal(t, []string{"yesterday"}, titles(dueOverdue), "Закрытые задачи не просрочены")
+		assert.Equal(t, []string{"undated"}, titles(dueNone))
+		assert.Equal(t, []string{"finished", "yesterday", "tonight", "undated"}, titles(""), "Задачи без срока — в конце")
+	})
+}
+
+func TestReminders(t *testing.T) {
+	forEachStore(t, func(t *testing.T, st Store) {
+		ctx := context.Background()
+		user := seedUser(t, st)
+		page := seedPage(t, st, seedNotebook(t, st, user.ID).ID)
+		due := time.Date(2030, 1, 7, 9, 0, 0, 0, time.UTC)
+		task, err := st.CreateTask(ctx, Task{PageID: page.ID, Title: "Report", Status: "todo", DueDate: &due}, user.ID)
+		require.NoError(t, err)
+
+		minutes := 30
+		relative, err := st.CreateReminder(ctx, Reminder{TaskID: task.ID, UserID: user.ID, MinutesBefore: &minutes, Channel: channelInApp})
+		require.NoError(t, err)
+		require.NotNil(t, relative.FireAt)
+		assert.True(t, due.Add(-30*time.Minute).Equal(*relative.FireAt), "fire_at считается от срока задачи")
+		assert.Equal(t, reminderPending, relative.Status)
+		at := due.Add(time.Hour)
+		absolute, err := st.CreateReminder(ctx, Reminder{TaskID: task.ID, UserID: user.ID, RemindAt: &at, Channel: channelInApp})
+		require.NoError(t, err)
+		assert.True(t, at.Equal(*absolute.FireAt))
+
+		claimed, err := st.ClaimDueReminders(ctx, due, 10, time.Minute)
+		require.NoError(t, err)
+		require.Len(t, claimed, 1, "Наступило только относительное напоминание")
+		assert.Equal(t, relative.ID, claimed[0].ID)
+		assert.Equal(t, 1, claimed[0].Attempts)
+		claimedAgain, err := st.ClaimDueReminders(ctx, due, 10, time.Minute)
+		require.NoError(t, err)
+		assert.Empty(t, claimedAgain, "Захваченное напоминание скрыто до конца аренды")
+
+		sent := claimed[0]
+		sentAt := due
+		sent.Status, sent.SentAt = reminderSent, &sentAt
+		require.NoError(t, st.RecordReminderAttempt(ctx, sent))
+		claimed, err = st.ClaimDueReminders(ctx, due.Add(time.Hour), 10, time.Minute)
+		require.NoError(t, err)
+		require.Len(t, claimed, 1)
+		assert.Equal(t, absolute.ID, claimed[0].ID)
+
+		// Перенос срока: относительное напоминание снова ждёт отправки, результат старого захвата не записывается
+		later := due.AddDate(0, 0, 1)
+		_, err = st.PatchTask(ctx, task.ID, TaskPatch{DueDate: optional[time.Time]{Set: true, Value: later}})
+		require.NoError(t, err)
+		require.NoError(t, st.RecordReminderAttempt(ctx, sent))
+		reminders, err := st.ListReminders(ctx, task.ID, user.ID)
+		require.NoError(t, err)
+		require.Len(t, reminders, 2)
+		assert.Equal(t, reminderPending, reminders[0].Status)
+		assert.Equal(t, 0, reminders[0].Attempts)
+		assert.True(t, later.Add(-30*time.Minute).Equal(*reminders[0].FireAt))
+
+		// Срок без времени отсчитывается от полуночи в часовом поясе пользователя
+		require.NoError(t, st.UpdateUserTimeZone(ctx, user.ID, "Europe/Moscow"))
+		day := time.Date(2030, 1, 10, 0, 0, 0, 0, time.UTC)
+		_, err = st.PatchTask(ctx, task.ID, TaskPatch{DueDate: optional[time.Time]{Set: true, Value: day}, DueAllDay: optional[bool]{Set: true, Value: true}})
+		require.NoError(t, err)
+		reminders, err = st.ListReminders(ctx, task.ID, user.ID)
+		require.NoError(t, err)
+		assert.True(t, time.Date(2030, 1, 9, 20, 30, 0, 0, time.UTC).Equal(*reminders[0].FireAt), "00:00 MSK минус 30 минут")
+
+		_, err = st.PatchTask(ctx, task.ID, TaskPatch{DueDate: optional[time.Time]{Set: true, Null: true}, DueAllDay: optional[bool]{Set: true}})
+		require.NoError(t, err)
+		reminders, err = st.ListReminders(ctx, task.ID, user.ID)
+		require.NoError(t, err)
+		assert.Nil(t, reminders[0].FireAt, "Без срока относительное напоминание не срабатывает")
+
+		assert.ErrorIs(t, st.DeleteReminder(ctx, task.ID+1, user.ID, absolute.ID), ErrNotFound, "Напоминание другой задачи")
+		require.NoError(t, st.DeleteReminder(ctx, task.ID, user.ID, absolute.ID))
+
+		taskID := task.ID
+		notification, err := st.CreateNotification(ctx, Notification{UserID: user.ID, TaskID: &taskID, Kind: "reminder", Title: "Report"})
+		require.NoError(t, err)
+		assert.NotZero(t, notification.ID)
+		assert.Nil(t, notification.ReadAt)
+
+		require.NoError(t, st.DeleteTask(ctx, task.ID))
+		reminders, err = st.ListReminders(ctx, task.ID, user.ID)
+		require.NoError(t, err)
+		assert.Empty(t, reminders, "Напоминания удаляются вместе с задачей")
+	})
+}
+
+func TestNotifications(t *testing.T) {
+	forEachStore(t, func(t *testing.T, st Store) {
+		ctx := context.Background()
+		user := seedUser(t, st)
+		other := seedUser(t, st)
+
+		var ids []int
+		for i := 0; i < 3; i++ {
+			n, err := st.CreateNotification(ctx, Notification{UserID: user.ID, Kind: notificationOverdue, Title: fmt.Sprintf("n%d", i), DedupeKey: fmt.Sprintf("k%d", i)})
+			require.NoError(t, err)
+			ids = append(ids, n.ID)
+		}
+		_, err := st.CreateNotification(ctx, Notification{UserID: user.ID, Kind: notificationOverdue, Title: "again", DedupeKey: "k0"})
+		assert.ErrorIs(t, err, ErrDuplicateKey, "Повтор по ключу")
+		_, err = st.CreateNotification(ctx, Notification{UserID: other.ID, Kind: notificationOverdue, Title: "other", DedupeKey: "k0"})
+		assert.NoError(t, err, "Ключ уникален в пределах пользователя")
+		_, err = st.CreateNotification(ctx, Notification{UserID: other.ID, Kind: notificationReminder, Title: "no key"})
+		require.NoError(t, err)
+		_, err = st.CreateNotification(ctx, Notification{UserID: other.ID, Kind: notificationReminder, Title: "no key"})
+		assert.NoError(t, err, "Без ключа повторы разрешены")
+
+		page, err := st.ListNotifications(ctx, NotificationFilter{UserID: user.ID, Limit: 2})
+		require.NoError(t, err)
+		require.Len(t, page, 2)
+		assert.Equal(t, ids[2], page[0].ID, "Новые — первыми")
+		page, err = st.ListNotifications(ctx, NotificationFilter{UserID: user.ID, BeforeID: page[1].ID, Limit: 2})
+		require.NoError(t, err)
+		require.Len(t, page, 1)
+		assert.Equal(t, ids[0], page[0].ID)
+
+		_, err = st.MarkNotificationRead(ctx, other.ID, ids[1])
+		assert.ErrorIs(t, err, ErrNotFound, "Чужое уведомление")
+		read, err := st.MarkNotificationRead(ctx, user.ID, ids[1])
+		require.NoError(t, err)
+		require.NotNil(t, read.ReadAt)
+		unread, err := st.ListNotifications(ctx, NotificationFilter{UserID: user.ID, UnreadOnly: true, Limit: 10})
+		require.NoError(t, err)
+		assert.Len(t, unread, 2)
+
+		marked, err := st.MarkAllNotificationsRead(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 2, marked)
+		count, err := st.UnreadNotificationCount(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Zero(t, count)
+		count, err = st.UnreadNotificationCount(ctx, other.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 3, count, "Чужие уведомления не затронуты")
+	})
+}
+
+func TestListDueTasks(t *testing.T) {
+	forEachStore(t, func(t *testing.T, st Store) {
+		ctx := context.Background()
+		user := seedUser(t, st)
+		page := seedPage(t, st, seedNotebook(t, st, user.ID).ID)
+		// Далёкое будущее, чтобы в окно не попали задачи других тестов в общей базе
+		base := time.Date(2999, 6, 1, 12, 0, 0, 0, time.UTC)
+		create := func(title, status string, due *time.Time) {
+			_, err := st.CreateTask(ctx, Task{PageID: page.ID, Title: title, Status: status, DueDate: due}, user.ID)
+			require.NoError(t, err)
+		}
+		create("inside", "todo", dueAt(base))
+		create("closed", "done", dueAt(base))
+		create("before", "todo", dueAt(base.Add(-2*time.Hour)))
+		create("at end", "todo", dueAt(base.Add(time.Hour)))
+		create("undated", "todo", nil)
+
+		tasks, err := st.ListDueTasks(ctx, base.Add(-time.Hour), base.Add(time.Hour))
+		require.NoError(t, err)
+		require.Len(t, tasks, 1)
+		assert.Equal(t, "inside", tasks[0].Title)
+	})
+}
+
+func TestNotebookSharing(t *testing.T) {
+	forEachStore(t, func(t *testing.T, st Store) {
+		ctx := context.Background()
+		owner, editor, viewer := seedUser(t, st), seedUser(t, st), seedUser(t, st)
+		notebook := seedNotebook(t, st, owner.ID)
+		page := seedPage(t, st, notebook.ID)
+		task := seedTask(t, st, page.ID)
+
+		found, err := st.GetUserByEmail(ctx, strings.ToUpper(editor.Email))
+		require.NoError(t, err)
+		assert.Equal(t, editor.ID, found.ID, "Email сравнивается без учёта регистра")
+
+		_, err = st.AddNotebookMember(ctx, NotebookMember{NotebookID: notebook.ID, UserID: editor.ID, Role: roleEditor, InvitedBy: &owner.ID})
+		require.NoError(t, err)
+		_, err = st.AddNotebookMember(ctx, NotebookMember{NotebookID: notebook.ID, UserID: viewer.ID, Role: roleEditor, InvitedBy: &owner.ID})
+		require.NoError(t, err)
+		_, err = st.AddNotebookMember(ctx, NotebookMember{NotebookID: notebook.ID, UserID: viewer.ID, Role: roleViewer})
+		assert.ErrorIs(t, err, ErrDuplicateKey)
+		_, err = st.AddNotebookMember(ctx, NotebookMember{NotebookID: notebook.ID, UserID: owner.ID, Role: roleViewer})
+		assert.ErrorIs(t, err, ErrDuplicateKey, "Владелец не может стать участником")
+		updated, err := st.UpdateNotebookMemberRole(ctx, notebook.ID, viewer.ID, roleViewer)
+		require.NoError(t, err)
+		assert.Equal(t, roleViewer, updated.Role)
+
+		members, err := st.ListNotebookMembers(ctx, notebook.ID)
+		require.NoError(t, err)
+		require.Len(t, members, 3)
+		assert.Equal(t, owner.ID, members[0].UserID, "Владелец первым")
+		assert.Equal(t, roleOwner, members[0].Role)
+		assert.Equal(t, editor.Username, members[1].Username)
+
+		access, err := st.TaskAccess(ctx, task.ID, viewer.ID)
+		require.NoError(t, err)
+		assert.Equal(t, Access{NotebookID: notebook.ID, Role: roleViewer}, access)
+		access, err = st.PageAccess(ctx, page.ID, editor.ID)
+		require.NoError(t, err)
+		assert.Equal(t, roleEditor, access.Role)
+		_, err = st.NotebookAccess(ctx, notebook.ID, seedUser(t, st).ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		notebooks, err := st.ListNotebooks(ctx, viewer.ID, personalWorkspaceID(t, st, viewer.ID))
+		require.NoError(t, err)
+		require.Len(t, notebooks, 1)
+		assert.Equal(t, roleViewer, notebooks[0].Role)
+		keys, err := parseTaskSort("")
+		require.NoError(t, err)
+		tasks, err := st.ListUserTasks(ctx, TaskFilter{UserID: editor.ID, Sort: keys, Limit: 10})
+		require.NoError(t, err)
+		assert.Len(t, tasks, 1, "Задачи общих блокнотов видны участникам")
+
+		// Метки и напоминания личные: участник не видит и не затирает метки владельца
+		ownerLabel, err := st.CreateLabel(ctx, Label{UserID: owner.ID, Name: "mine", Color: defaultLabelColor})
+		require.NoError(t, err)
+		editorLabel, err := st.CreateLabel(ctx, Label{UserID: editor.ID, Name: "mine", Color: defaultLabelColor})
+		require.NoError(t, err)
+		require.NoError(t, st.SetTaskLabels(ctx, owner.ID, task.ID, []int{ownerLabel.ID}))
+		require.NoError(t, st.SetTaskLabels(ctx, editor.ID, task.ID, []int{editorLabel.ID}))
+		labels, err := st.TaskLabels(ctx, owner.ID, task.ID)
+		require.NoError(t, err)
+		require.Len(t, labels, 1)
+		assert.Equal(t, ownerLabel.ID, labels[0].ID)
+		minutes := 5
+		_, err = st.CreateReminder(ctx, Reminder{TaskID: task.ID, UserID: editor.ID, MinutesBefore: &minutes, Channel: channelInApp})
+		require.NoError(t, err)
+
+		// Удаление участника убирает его метки и напоминания в блокноте
+		require.NoError(t, st.RemoveNotebookMember(ctx, notebook.ID, editor.ID))
+		assert.ErrorIs(t, st.RemoveNotebookMember(ctx, notebook.ID, editor.ID), ErrNotFound)
+		labels, err = st.TaskLabels(ctx, editor.ID, task.ID)
+		require.NoError(t, err)
+		assert.Empty(t, labels)
+		reminders, err := st.ListReminders(ctx, task.ID, editor.ID)
+		require.NoError(t, err)
+		assert.Empty(t, reminders)
+		labels, err = st.TaskLabels(ctx, owner.ID, task.ID)
+		require.NoError(t, err)
+		assert.Len(t, labels, 1)
+
+		// Передача владения: прежний владелец остаётся редактором
+		assert.ErrorIs(t, st.TransferNotebookOwnership(ctx, notebook.ID, owner.ID, editor.ID), ErrNotFound, "Передать можно только участнику")
+		require.NoError(t, st.TransferNotebookOwnership(ctx, notebook.ID, owner.ID, viewer.ID))
+		access, err = st.NotebookAccess(ctx, notebook.ID, viewer.ID)
+		require.NoError(t, err)
+		assert.Equal(t, roleOwner, access.Role)
+		access, err = st.NotebookAccess(ctx, notebook.ID, owner.ID)
+		require.NoError(t, err)
+		assert.Equal(t, roleEditor, access.Role)
+		got, err := st.GetNotebook(ctx, notebook.ID)
+		require.NoError(t, err)
+		assert.Equal(t, viewer.ID, got.UserID)
+	})
+}
+
+func TestWorkspaces(t *testing.T) {
+	forEachStore(t, func(t *testing.T, st Store) {
+		ctx := context.Background()
+		admin, member, guest := seedUser(t, st), seedUser(t, st), seedUser(t, st)
+		personal := personalWorkspaceID(t, st, admin.ID)
+
+		sales, err := st.CreateWorkspace(ctx, Workspace{Name: "Sales", DefaultRole: roleViewer}, admin.ID)
+		require.NoError(t, err)
+		assert.Equal(t, workspaceAdmin, sales.Role)
+		assert.False(t, sales.Personal)
+		_, err = st.AddWorkspaceMember(ctx, WorkspaceMember{WorkspaceID: sales.ID, UserID: member.ID, Role: workspaceMember})
+		require.NoError(t, err)
+		_, err = st.AddWorkspaceMember(ctx, WorkspaceMember{WorkspaceID: sales.ID, UserID: member.ID, Role: workspaceAdmin})
+		assert.ErrorIs(t, err, ErrDuplicateKey)
+
+		workspaces, err := st.ListWorkspaces(ctx, admin.ID)
+		require.NoError(t, err)
+		require.Len(t, workspaces, 2)
+		assert.True(t, workspaces[0].Personal, "Личное пространство первым")
+		members, err := st.ListWorkspaceMembers(ctx, sales.ID)
+		require.NoError(t, err)
+		require.Len(t, members, 2)
+		assert.Equal(t, admin.ID, members[0].UserID, "Администраторы первыми")
+		assert.Equal(t, member.Username, members[1].Username)
+
+		// Блокноты пространства доступны участникам с ролью по умолчанию
+		plan, err := st.CreateNotebook(ctx, Notebook{UserID: admin.ID, WorkspaceID: sales.ID, Name: "Plan"})
+		require.NoError(t, err)
+		private := seedNotebook(t, st, admin.ID)
+		assert.Equal(t, personal, private.WorkspaceID, "По умолчанию — личное пространство владельца")
+		access, err := st.NotebookAccess(ctx, plan.ID, member.ID)
+		require.NoError(t, err)
+		assert.Equal(t, roleViewer, access.Role)
+		_, err = st.NotebookAccess(ctx, private.ID, member.ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		// Явная роль в блокноте повышает роль по умолчанию, но не понижает
+		_, err = st.AddNotebookMember(ctx, NotebookMember{NotebookID: plan.ID, UserID: member.ID, Role: roleEditor})
+		require.NoError(t, err)
+		access, err = st.NotebookAccess(ctx, plan.ID, member.ID)
+		require.NoError(t, err)
+		assert.Equal(t, roleEditor, access.Role)
+
+		notebooks, err := st.ListNotebooks(ctx, admin.ID, sales.ID)
+		require.NoError(t, err)
+		require.Len(t, notebooks, 1)
+		assert.Equal(t, plan.ID, notebooks[0].ID)
+		notebooks, err = st.ListNotebooks(ctx, admin.ID, personal)
+		require.NoError(t, err)
+		require.Len(t, notebooks, 1)
+		assert.Equal(t, private.ID, notebooks[0].ID)
+
+		// Гость — участник блокнота, но не пространства: блокнот виден в его личном пространстве
+		_, err = st.AddNotebookMember(ctx, NotebookMember{NotebookID: plan.ID, UserID: guest.ID, Role: roleViewer})
+		require.NoError(t, err)
+		notebooks, err = st.ListNotebooks(ctx, guest.ID, personalWorkspaceID(t, st, guest.ID))
+		require.NoError(t, err)
+		require.Len(t, notebooks, 1)
+		assert.Equal(t, plan.ID, notebooks[0].ID)
+		notebooks, err = st.ListNotebooks(ctx, member.ID, personalWorkspaceID(t, st, member.ID))
+		require.NoError(t, err)
+		assert.Empty(t, notebooks, "Участнику пространства блокнот виден только в нём")
+
+		keys, err := parseTaskSort("")
+		require.NoError(t, err)
+		task := seedTask(t, st, seedPage(t, st, plan.ID).ID)
+		seedTask(t, st, seedPage(t, st, private.ID).ID)
+		tasks, err := st.ListUserTasks(ctx, TaskFilter{UserID: admin.ID, WorkspaceID: sales.ID, Sort: keys, Limit: 10})
+		require.NoError(t, err)
+		require.Len(t, tasks, 1)
+		assert.Equal(t, task.ID, tasks[0].ID)
+		results, err := st.Search(ctx, admin.ID, sales.ID, "Plan", 10)
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		assert.Equal(t, plan.ID, results[0].ID)
+
+		// Роль по умолчанию «none»: остаётся только явный доступ
+		patched, err := st.PatchWorkspace(ctx, sales.ID, WorkspacePatch{DefaultRole: optional[string]{Set: true, Value: roleNone}})
+		require.NoError(t, err)
+		assert.Equal(t, roleNone, patched.DefaultRole)
+		require.NoError(t, st.RemoveNotebookMember(ctx, plan.ID, member.ID))
+		_, err = st.NotebookAccess(ctx, plan.ID, member.ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		// Выбранное пространство; после выхода из него — снова личное
+		assert.ErrorIs(t, st.SetCurrentWorkspace(ctx, guest.ID, sales.ID), ErrNotFound)
+		require.NoError(t, st.SetCurrentWorkspace(ctx, member.ID, sales.ID))
+		current, err := st.CurrentWorkspace(ctx, member.ID)
+		require.NoError(t, err)
+		assert.Equal(t, sales.ID, current.ID)
+		assert.Equal(t, workspaceMember, current.Role)
+		updated, err := st.UpdateWorkspaceMemberRole(ctx, sales.ID, member.ID, workspaceAdmin)
+		require.NoError(t, err)
+		assert.Equal(t, workspaceAdmin, updated.Role)
+		require.NoError(t, st.RemoveWorkspaceMember(ctx, sales.ID, member.ID))
+		assert.ErrorIs(t, st.RemoveWorkspaceMember(ctx, sales.ID, member.ID), ErrNotFound)
+		current, err = st.CurrentWorkspace(ctx, member.ID)
+		require.NoError(t, err)
+		assert.True(t, current.Personal)
+
+		// Удаление пространства удаляет его блокноты; личное не удаляется
+		assert.ErrorIs(t, st.DeleteWorkspace(ctx, personal), ErrNotFound)
+		require.NoError(t, st.DeleteWorkspace(ctx, sales.ID))
+		_, err = st.GetNotebook(ctx, plan.ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+		_, err = st.WorkspaceRole(ctx, sales.ID, admin.ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+}
+
+func TestRefreshTokenRotationAndReuse(t *testing.T) {
+	forEachStore(t, func(t *testing.T, st Store) {
+		ctx := context.Background()
+		s := newServer(st)
+		user := seedUser(t, st)
+
+		first, err := s.issueRefreshToken(ctx, user.ID)
+		require.NoError(t, err, "Выдача refresh-токена не должна вызывать ошибку")
+
+		second, rotatedUserID, err := s.rotateRefreshToken(ctx, first)
+		require.NoError(t, err, "Ротация действующего токена не должна вызывать ошибку")
+		assert.Equal(t, user.ID, rotatedUserID)
+		assert.NotEqual(t, first, second, "Ротация должна выдавать новый токен")
+
+		// Повторное использование старого токена отзывает всю сессию
+		_, _, err = s.rotateRefreshToken(ctx, first)
+		assert.ErrorIs(t, err, ErrRefreshTokenReused, "Повторное использование должно обнаруживаться")
+		_, _, err = s.rotateRefreshToken(ctx, second)
+		assert.ErrorIs(t, err, ErrRefreshTokenInvalid, "После обнаружения повтора вся сессия должна быть отозвана")
+	})
+}
+
+func TestRevokeRefreshTokens(t *testing.T) {
+	forEachStore(t, func(t *testing.T, st Store) {
+		ctx := context.Background()
+		s := newServer(st)
+		user := seedUser(t, st)
+
+		session, err := s.issueRefreshToken(ctx, user.ID)
+		require.NoError(t, err)
+		other, err := s.issueRefreshToken(ctx, user.ID)
+		require.NoError(t, err)
+
+		require.NoError(t, st.RevokeRefreshFamily(ctx, hashToken(session)), "Выход не должен вызывать ошибку")
+		_, _, err = s.rotateRefreshToken(ctx, session)
+		assert.ErrorIs(t, err, ErrRefreshTokenInvalid, "Токен отозванной сессии недействителен")
+
+		other, _, err = s.rotateRefreshToken(ctx, other)
+		require.NoError(t, err, "Другие сессии не затрагиваются обычным выходом")
+
+		require.NoError(t, st.RevokeUserRefreshTokens(ctx, user.ID), "Выход на всех устройствах не должен вызывать ошибку")
+		_, _, err = s.rotateRefreshToken(ctx, other)
+		assert.ErrorIs(t, err, ErrRefreshTokenInvalid)
+	})
+}
+
+func TestProfile(t *testing.T) {
+	forEachStore(t, func(t *testing.T, st Store) {
+		ctx := context.Background()
+		user, other := seedUser(t, st), seedUser(t, st)
+
+		profile, err := st.GetProfile(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, user.Username, profile.Username)
+		assert.Equal(t, defaultLocale, profile.Locale)
+		assert.Equal(t, "UTC", profile.TimeZone)
+		assert.False(t, profile.CreatedAt.IsZero())
+
+		patch := ProfilePatch{
+			DisplayName: optional[string]{Set: true, Value: "Иван"},
+			Locale:      optional[string]{Set: true, Value: "en-US"},
+			TimeZone:    optional[string]{Set: true, Value: "Europe/Moscow"},
+		}
+		profile, err = st.PatchProfile(ctx, user.ID, patch)
+		require.NoError(t, err)
+		assert.Equal(t, "Иван", profile.DisplayName)
+		assert.Equal(t, "en-US", profile.Locale)
+		stored, err := st.GetUser(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "Europe/Moscow", stored.TimeZone)
+
+		_, err = st.PatchProfile(ctx, user.ID, ProfilePatch{Email: optional[string]{Set: true, Value: other.Email}})
+		assert.ErrorIs(t, err, ErrDuplicateKey)
+		_, err = st.PatchProfile(ctx, user.ID, ProfilePatch{Username: optional[string]{Set: true, Value: other.Username}})
+		assert.ErrorIs(t, err, ErrDuplicateKey)
+		profile, err = st.PatchProfile(ctx, user.ID, ProfilePatch{Username: optional[string]{Set: true, Value: user.Username + "_renamed"}})
+		require.NoError(t, err)
+		_, err = st.GetUserByUsername(ctx, profile.Username)
+		assert.NoError(t, err, "Вход возможен под новым именем")
+
+		_, err = st.GetProfile(ctx, 1<<30)
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+}
+
+func TestDeleteUser(t *testing.T) {
+	forEachStore(t, func(t *testing.T, st Store) {
+		ctx := context.Background()
+		s := newServer(st)
+		user, colleague, friend := seedUser(t, st), seedUser(t, st), seedUser(t, st)
+
+		// Общее пространство, где пользователь единственный администратор
+		team, err := st.CreateWorkspace(ctx, Workspace{Name: "Team", DefaultRole: roleViewer}, user.ID)
+		require.NoError(t, err)
+		_, err = st.AddWorkspaceMember(ctx, WorkspaceMember{WorkspaceID: team.ID, UserID: colleague.ID, Role: workspaceMember})
+		require.NoError(t, err)
+		teamNotebook, err := st.CreateNotebook(ctx, Notebook{UserID: user.ID, WorkspaceID: team.ID, Name: "Team notes"})
+		require.NoError(t, err)
+		colleagueNotebook, err := st.CreateNotebook(ctx, Notebook{UserID: colleague.ID, WorkspaceID: team.ID, Name: "Colleague notes"})
+		require.NoError(t, err)
+		// Пространство без других участников
+		solo, err := st.CreateWorkspace(ctx, Workspace{Name: "Solo", DefaultRole: roleViewer}, user.ID)
+		require.NoError(t, err)
+
+		// Чужой блокнот, куда пользователь приглашён, и его метка на задаче в нём
+		shared := seedNotebook(t, st, friend.ID)
+		_, err = st.AddNotebookMember(ctx, NotebookMember{NotebookID: shared.ID, UserID: user.ID, Role: roleEditor, InvitedBy: &friend.ID})
+		require.NoError(t, err)
+		page := seedPage(t, st, shared.ID)
+		task := seedTask(t, st, page.ID)
+		label, err := st.CreateLabel(ctx, Label{UserID: user.ID, Name: "mine", Color: defaultLabelColor})
+		require.NoError(t, err)
+		require.NoError(t, st.SetTaskLabels(ctx, user.ID, task.ID, []int{label.ID}))
+		_, err = s.issueRefreshToken(ctx, user.ID)
+		require.NoError(t, err)
+
+		require.NoError(t, st.DeleteUser(ctx, user.ID))
+		assert.ErrorIs(t, st.DeleteUser(ctx, user.ID), ErrNotFound)
+
+		_, err = st.GetProfile(ctx, user.ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+		_, err = st.GetNotebook(ctx, teamNotebook.ID)
+		assert.ErrorIs(t, err, ErrNotFound, "Блокноты пользователя удаляются и в общих пространствах")
+		_, err = st.GetWorkspace(ctx, solo.ID)
+		assert.ErrorIs(t, err, ErrNotFound, "Пространство без участников удаляется")
+
+		// Общее пространство остаётся с новым администратором
+		role, err := st.WorkspaceRole(ctx, team.ID, colleague.ID)
+		require.NoError(t, err)
+		assert.Equal(t, workspaceAdmin, role)
+		_, err = st.GetNotebook(ctx, colleagueNotebook.ID)
+		assert.NoError(t, err)
+
+		// Данные других пользователей не затронуты, связи с удалённым убраны
+		members, err := st.ListNotebookMembers(ctx, shared.ID)
+		require.NoError(t, err)
+		for _, m := range members {
+			assert.NotEqual(t, user.ID, m.UserID)
+		}
+		_, err = st.GetTask(ctx, task.ID)
+		assert.NoError(t, err)
+		labels, err := st.TaskLabels(ctx, friend.ID, task.ID)
+		require.NoError(t, err)
+		assert.Empty(t, labels)
+	})
+}
+
+func TestEmailTokens(t *testing.T) {
+	forEachStore(t, func(t *testing.T, st Store) {
+		ctx := context.Background()
+		user := seedUser(t, st)
+		assert.False(t, user.EmailVerified)
+
+		newToken := func(purpose, hash string, ttl time.Duration) {
+			require.NoError(t, st.CreateEmailToken(ctx, EmailToken{
+				UserID: user.ID, Purpose: purpose, Email: user.Email, TokenHash: hash, ExpiresAt: time.Now().Add(ttl),
+			}))
+		}
+		suffix := fmt.Sprint(time.Now().UnixNano())
+		newToken(emailTokenReset, "first"+suffix, time.Hour)
+		newToken(emailTokenReset, "second"+suffix, time.Hour)
+		newToken(emailTokenVerify, "verify"+suffix, time.Hour)
+		newToken(emailTokenVerify, "expired"+suffix, -time.Minute)
+
+		_, err := st.ConsumeEmailToken(ctx, emailTokenVerify, "first"+suffix)
+		assert.ErrorIs(t, err, ErrNotFound, "Токен сброса не подтверждает email")
+		token, err := st.ConsumeEmailToken(ctx, emailTokenReset, "first"+suffix)
+		require.NoError(t, err)
+		assert.Equal(t, user.ID, token.UserID)
+		assert.Equal(t, user.Email, token.Email)
+		_, err = st.ConsumeEmailToken(ctx, emailTokenReset, "first"+suffix)
+		assert.ErrorIs(t, err, ErrNotFound, "Токен одноразовый")
+		_, err = st.ConsumeEmailToken(ctx, emailTokenReset, "second"+suffix)
+		assert.ErrorIs(t, err, ErrNotFound, "Остальные токены сброса погашаются вместе с использованным")
+		_, err = st.ConsumeEmailToken(ctx, emailTokenVerify, "expired"+suffix)
+		assert.ErrorIs(t, err, ErrNotFound, "Истёкший токен недействителен")
+
+		// Адрес подтверждается, только если он не сменился после отправки письма
+		token, err = st.ConsumeEmailToken(ctx, emailTokenVerify, "verify"+suffix)
+		require.NoError(t, err)
+		assert.ErrorIs(t, st.MarkEmailVerified(ctx, user.ID, "other@example.com"), ErrNotFound)
+		require.NoError(t, st.MarkEmailVerified(ctx, user.ID, token.Email))
+		stored, err := st.GetUserByUsername(ctx, user.Username)
+		require.NoError(t, err)
+		assert.True(t, stored.EmailVerified)
+
+		// Смена адреса снимает подтверждение
+		profile, err := st.PatchProfile(ctx, user.ID, ProfilePatch{Email: optional[string]{Set: true, Value: "new_" + user.Email}})
+		require.NoError(t, err)
+		assert.False(t, profile.EmailVerified)
+	})
+}
+
+func TestTwoFactor(t *testing.T) {
+	forEachStore(t, func(t *testing.T, st Store) {
+		ctx := context.Background()
+		user := seedUser(t, st)
+
+		_, err := st.GetTOTP(ctx, user.ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+		require.NoError(t, st.SetTOTPSecret(ctx, user.ID, "FIRSTSECRET"))
+		require.NoError(t, st.SetTOTPSecret(ctx, user.ID, "SECONDSECRET"), "Неподтверждённый секрет можно заменить")
+		totp, err := st.GetTOTP(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "SECONDSECRET", totp.Secret)
+		assert.False(t, totp.Confirmed)
+
+		require.NoError(t, st.ConfirmTOTP(ctx, user.ID, []string{"hash-a", "hash-b"}))
+		assert.ErrorIs(t, st.SetTOTPSecret(ctx, user.ID, "THIRDSECRET"), ErrDuplicateKey, "Подключённую 2FA нельзя перезаписать")
+		profile, err := st.GetProfile(ctx, user.ID)
+		require.NoError(t, err)
+		assert.True(t, profile.TwoFactorEnabled)
+
+		require.NoError(t, st.UseTOTPStep(ctx, user.ID, 100))
+		assert.ErrorIs(t, st.UseTOTPStep(ctx, user.ID, 100), ErrNotFound, "Код не принимается повторно")
+		assert.ErrorIs(t, st.UseTOTPStep(ctx, user.ID, 99), ErrNotFound)
+
+		require.NoError(t, st.UseRecoveryCode(ctx, user.ID, "hash-a"))
+		assert.ErrorIs(t, st.UseRecoveryCode(ctx, user.ID, "hash-a"), ErrNotFound, "Код восстановления одноразовый")
+		require.NoError(t, st.ReplaceRecoveryCodes(ctx, user.ID, []string{"hash-c"}))
+		assert.ErrorIs(t, st.UseRecoveryCode(ctx, user.ID, "hash-b"), ErrNotFound, "Прежние коды заменяются")
+		require.NoError(t, st.UseRecoveryCode(ctx, user.ID, "hash-c"))
+
+		jti := fmt.Sprint("challenge-", time.Now().UnixNano())
+		require.NoError(t, st.UseLoginChallenge(ctx, jti, time.Now().Add(time.Minute)))
+		assert.ErrorIs(t, st.UseLoginChallenge(ctx, jti, time.Now().Add(time.Minute)), ErrNotFound, "Токен второго шага одноразовый")
+		require.NoError(t, st.UseLoginChallenge(ctx, jti+"-other", time.Now().Add(time.Minute)))
+
+		require.NoError(t, st.DeleteTOTP(ctx, user.ID))
+		assert.ErrorIs(t, st.DeleteTOTP(ctx, user.ID), ErrNotFound)
+		profile, err = st.GetProfile(ctx, user.ID)
+		require.NoError(t, err)
+		assert.False(t, profile.TwoFactorEnabled)
+	})
+}
+
+func TestAccessTokens(t *testing.T) {
+	forEachStore(t, func(t *testing.T, st Store) {
+		ctx := context.Background()
+		user := seedUser(t, st)
+		other := seedUser(t, st)
+
+		expired := time.Now().Add(-time.Minute)
+		created, err := st.CreateAccessToken(ctx, AccessToken{UserID: user.ID, Name: "ci", Scopes: []string{"tasks:read"}, TokenHash: fmt.Sprintf("hash-ci-%d", user.ID)})
+		require.NoError(t, err)
+		assert.NotZero(t, created.ID)
+		assert.Equal(t, []string{"tasks:read"}, created.Scopes)
+		assert.Nil(t, created.LastUsedAt)
+		_, err = st.CreateAccessToken(ctx, AccessToken{UserID: user.ID, Name: "old", Scopes: []string{"tasks:read"}, TokenHash: fmt.Sprintf("hash-old-%d", user.ID), ExpiresAt: &expired})
+		require.NoError(t, err)
+
+		tokens, err := st.ListAccessTokens(ctx, user.ID)
+		require.NoError(t, err)
+		require.Len(t, tokens, 2)
+		assert.Equal(t, "old", tokens[0].Name, "Новые токены первыми")
+		tokens, err = st.ListAccessTokens(ctx, other.ID)
+		require.NoError(t, err)
+		assert.Empty(t, tokens)
+
+		used, err := st.UseAccessToken(ctx, created.TokenHash)
+		require.NoError(t, err)
+		assert.Equal(t, created.ID, used.ID)
+		assert.Equal(t, user.ID, used.UserID)
+		require.NotNil(t, used.LastUsedAt)
+		_, err = st.UseAccessToken(ctx, fmt.Sprintf("hash-old-%d", user.ID))
+		assert.ErrorIs(t, err, ErrNotFound, "Истёкший токен не принимается")
+		_, err = st.UseAccessToken(ctx, "unknown")
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		assert.ErrorIs(t, st.DeleteAccessToken(ctx, other.ID, created.ID), ErrNotFound, "Чужой токен не отзывается")
+		require.NoError(t, st.DeleteAccessToken(ctx, user.ID, created.ID))
+		_, err = st.UseAccessToken(ctx, created.TokenHash)
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.ErrorIs(t, st.DeleteAccessToken(ctx, user.ID, created.ID), ErrNotFound)
+
+		// Отзыв всех токенов пользователя не задевает чужие
+		_, err = st.CreateAccessToken(ctx, AccessToken{UserID: other.ID, Name: "ci", Scopes: []string{"tasks:read"}, TokenHash: fmt.Sprintf("hash-ci-%d", other.ID)})
+		require.NoError(t, err)
+		require.NoError(t, st.DeleteUserAccessTokens(ctx, user.ID))
+		tokens, err = st.ListAccessTokens(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Empty(t, tokens)
+		tokens, err = st.ListAccessTokens(ctx, other.ID)
+		require.NoError(t, err)
+		assert.Len(t, tokens, 1)
+	})
+}
+
+func TestLoginThrottle(t *testing.T) {
+	forEachStore(t, func(t *testing.T, st Store) {
+		ctx := context.Background()
+		suffix := fmt.Sprint(time.Now().UnixNano())
+		account, ip := "account:"+suffix, "ip:"+suffix
+
+		// attempt учитывает попытку и возвращает счётчики, которые видел allow
+		attempt := func(window time.Duration, keys ...string) map[string]LoginFailures {
+			var seen map[string]LoginFailures
+			allowed, err := st.AddLoginAttempt(ctx, keys, window, func(f map[string]LoginFailures) bool {
+				seen = f
+				return true
+			})
+			require.NoError(t, err)
+			require.True(t, allowed)
+			return seen
+		}
+
+		assert.Empty(t, attempt(time.Hour, account, ip))
+		failures := attempt(time.Hour, account)
+		assert.Equal(t, 1, failures[account].Failures)
+		failures = attempt(time.Hour, account, ip)
+		assert.Equal(t, 2, failures[account].Failures)
+		assert.Equal(t, 1, failures[ip].Failures)
+		assert.WithinDuration(t, time.Now(), failures[account].LastFailureAt, time.Minute)
+
+		// Запрещённая попытка не учитывается
+		allowed, err := st.AddLoginAttempt(ctx, []string{account, ip}, time.Hour, func(map[string]LoginFailures) bool { return false })
+		require.NoError(t, err)
+		assert.False(t, allowed)
+		failures = attempt(time.Hour, account)
+		assert.Equal(t, 3, failures[account].Failures)
+
+		require.NoError(t, st.RemoveLoginAttempt(ctx, account))
+		failures = attempt(time.Hour, account)
+		assert.Equal(t, 3, failures[account].Failures, "Снята одна попытка из четырёх")
+
+		// Счётчик старше окна не учитывается и начинается заново
+		time.Sleep(10 * time.Millisecond)
+		assert.Empty(t, attempt(time.Millisecond, account))
+		failures = attempt(time.Hour, account)
+		assert.Equal(t, 1, failures[account].Failures)
+
+		require.NoError(t, st.ResetLoginFailures(ctx, account))
+		failures = attempt(time.Hour, account, ip)
+		assert.NotContains(t, failures, account)
+		assert.Contains(t, failures, ip, "Сбрасывается только указанный ключ")
+	})
+}
+
+func TestLoginThrottleConcurrentAttempts(t *testing.T) {
+	forEachStore(t, func(t *testing.T, st Store) {
+		ctx := context.Background()
+		key := "account:concurrent" + fmt.Sprint(time.Now().UnixNano())
+
+		const limit = 3
+		var allowed atomic.Int32
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				ok, err := st.AddLoginAttempt(ctx, []string{key}, time.Hour, func(f map[string]LoginFailures) bool {
+					return f[key].Failures < limit
+				})
+				assert.NoError(t, err)
+				if ok {
+					allowed.Add(1)
+				}
+			}()
+		}
+		wg.Wait()
+		assert.EqualValues(t, limit, allowed.Load(), "Параллельные попытки не проходят проверку по одному счётчику")
+	})
+}
+
+func TestLoginAudit(t *testing.T) {
+	forEachStore(t, func(t *testing.T, st Store) {
+		ctx := context.Background()
+		user := seedUser(t, st)
+
+		require.NoError(t, st.AddLoginAudit(ctx, LoginAuditEntry{Username: user.Username, UserID: &user.ID, IP: "192.0.2.1", Reason: loginFailedCredentials}))
+		require.NoError(t, st.AddLoginAudit(ctx, LoginAuditEntry{Username: "nobody", IP: "192.0.2.1", Reason: loginFailedCredentials}))
+		require.NoError(t, st.AddLoginAudit(ctx, LoginAuditEntry{Username: user.Username, UserID: &user.ID, IP: "192.0.2.2", Reason: loginFailedThrottled}))
+
+		entries, err := st.ListLoginAudit(ctx, user.ID, 10)
+		require.NoError(t, err)
+		require.Len(t, entries, 2, "Попытки с неизвестным именем к аккаунту не относятся")
+		assert.Equal(t, loginFailedThrottled, entries[0].Reason, "Новые записи первыми")
+		assert.Equal(t, "192.0.2.2", entries[0].IP)
+		assert.NotZero(t, entries[0].ID)
+		entries, err = st.ListLoginAudit(ctx, user.ID, 1)
+		require.NoError(t, err)
+		assert.Len(t, entries, 1)
+
+		require.NoError(t, st.DeleteUser(ctx, user.ID))
+		entries, err = st.ListLoginAudit(ctx, user.ID, 10)
+		require.NoError(t, err)
+		assert.Empty(t, entries, "Записи удалённого аккаунта остаются в журнале без user_id")
+	})
 }
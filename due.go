@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// Значения фильтра due в GET /api/tasks
+const (
+	dueToday   = "today"   // срок приходится на сегодняшнюю дату пользователя
+	dueOverdue = "overdue" // срок прошёл, задача не выполнена и не отменена
+	dueNone    = "none"    // без срока
+)
+
+// Часовой пояс пользователя; пустой или неизвестный (например, удалённый из tzdata) — UTC
+func userLocation(tz string) *time.Location {
+	if tz == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+func validateTimeZone(tz string) error {
+	if tz == "" || tz == "Local" {
+		return &validationError{"time_zone", "must be an IANA time zone name"}
+	}
+	if _, err := time.LoadLocation(tz); err != nil {
+		return &validationError{"time_zone", "unknown time zone " + tz}
+	}
+	return nil
+}
+
+// Дата момента t (в его часовом поясе) как полночь UTC — так хранятся сроки без времени
+func civilDate(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// Срок в хранимом виде: у срока без времени остаётся только дата; без даты флага быть не может
+func normalizeDue(due *time.Time, allDay bool) (*time.Time, error) {
+	if due == nil {
+		if allDay {
+			return nil, &validationError{"due_all_day", "requires due_date"}
+		}
+		return nil, nil
+	}
+	d := *due
+	if allDay {
+		d = civilDate(d)
+	}
+	return &d, nil
+}
+
+// «Сегодня» пользователя: границы текущих суток в его часовом поясе
+type dueWindow struct {
+	Now      time.Time
+	DayStart time.Time
+	DayEnd   time.Time
+	Today    time.Time // сегодняшняя дата пользователя как полночь UTC — для сроков без времени
+}
+
+func newDueWindow(now time.Time, loc *time.Location) dueWindow {
+	local := now.In(loc)
+	start := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+	return dueWindow{Now: now, DayStart: start, DayEnd: start.AddDate(0, 0, 1), Today: civilDate(local)}
+}
+
+func (w dueWindow) isToday(t Task) bool {
+	if t.DueDate == nil {
+		return false
+	}
+	if t.DueAllDay {
+		return t.DueDate.Equal(w.Today)
+	}
+	return !t.DueDate.Before(w.DayStart) && t.DueDate.Before(w.DayEnd)
+}
+
+// Просрочена ли задача без учёта статуса: срок без времени — со следующего дня
+func (w dueWindow) isOverdue(t Task) bool {
+	if t.DueDate == nil {
+		return false
+	}
+	if t.DueAllDay {
+		return t.DueDate.Before(w.Today)
+	}
+	return t.DueDate.Before(w.Now)
+}
+
+// Часовой пояс пользователя из профиля
+func (s *server) userLocation(ctx context.Context, userID int) (*time.Location, error) {
+	user, err := s.users.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return userLocation(user.TimeZone), nil
+}
+
+// PUT /api/profile/time-zone {"time_zone": "Europe/Moscow"}
+func (s *server) updateTimeZoneHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := userIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		TimeZone string `json:"time_zone"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := validateTimeZone(req.TimeZone); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.users.UpdateUserTimeZone(r.Context(), userID, req.TimeZone); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		http.Error(w, "Failed to update time zone: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"time_zone": req.TimeZone})
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestNormalizeDue(t *testing.T) {
+	due, err := normalizeDue(nil, false)
+	require.NoError(t, err)
+	assert.Nil(t, due, "Без срока задача остаётся без срока")
+
+	_, err = normalizeDue(nil, true)
+	assert.Error(t, err, "Срок без времени требует даты")
+
+	msk := time.FixedZone("MSK", 3*60*60)
+	due, err = normalizeDue(dueAt(time.Date(2030, 3, 1, 1, 30, 0, 0, msk)), true)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2030, 3, 1, 0, 0, 0, 0, time.UTC), *due, "Дата берётся в поясе клиента, а не в UTC")
+}
+
+func TestDueWindow(t *testing.T) {
+	moscow, err := time.LoadLocation("Europe/Moscow")
+	require.NoError(t, err)
+	// 22:00 UTC 1 марта — в Москве уже 2 марта
+	now := time.Date(2030, 3, 1, 22, 0, 0, 0, time.UTC)
+	utc, msk := newDueWindow(now, time.UTC), newDueWindow(now, moscow)
+
+	late := Task{DueDate: dueAt(time.Date(2030, 3, 1, 23, 30, 0, 0, time.UTC))}
+	assert.True(t, utc.isToday(late))
+	assert.True(t, msk.isToday(late), "23:30 UTC — 02:30 2 марта по Москве")
+	assert.False(t, utc.isOverdue(late))
+
+	evening := Task{DueDate: dueAt(time.Date(2030, 3, 1, 20, 0, 0, 0, time.UTC))}
+	assert.True(t, utc.isToday(evening))
+	assert.False(t, msk.isToday(evening), "Для Москвы это уже вчера")
+	assert.True(t, msk.isOverdue(evening))
+
+	allDay := Task{DueDate: dueAt(time.Date(2030, 3, 1, 0, 0, 0, 0, time.UTC)), DueAllDay: true}
+	assert.True(t, utc.isToday(allDay))
+	assert.False(t, utc.isOverdue(allDay), "Срок без времени просрочен только со следующего дня")
+	assert.False(t, msk.isToday(allDay))
+	assert.True(t, msk.isOverdue(allDay))
+
+	none := Task{}
+	assert.False(t, utc.isToday(none))
+	assert.False(t, utc.isOverdue(none))
+}
+
+func TestValidateTimeZone(t *testing.T) {
+	assert.NoError(t, validateTimeZone("Europe/Moscow"))
+	assert.NoError(t, validateTimeZone("UTC"))
+	for _, bad := range []string{"", "Local", "Mars/Olympus"} {
+		assert.Error(t, validateTimeZone(bad), bad)
+	}
+	assert.Equal(t, time.UTC, userLocation("Mars/Olympus"))
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// Назначение токенов из писем (email_tokens.purpose)
+const (
+	emailTokenVerify = "verify_email"
+	emailTokenReset  = "reset_password"
+)
+
+var (
+	appBaseURL           = "http://localhost:8080" // Адрес приложения для ссылок в письмах (задаётся конфигурацией)
+	requireVerifiedEmail = false                   // Вход только с подтверждённым email
+	emailVerificationTTL = 48 * time.Hour
+	passwordResetTTL     = time.Hour
+)
+
+var errEmailTokenInvalid = errors.New("invalid or expired token")
+
+// Сколько ждать почтовый сервер при фоновой отправке
+const backgroundEmailTimeout = time.Minute
+
+// Отправка письма в фоне для запросов по адресу от анонимного пользователя: ответ не ждёт
+// почтового сервера, и по времени ответа нельзя узнать, зарегистрирован ли адрес
+func (s *server) sendEmailTokenAsync(userID int, email, purpose string) {
+	s.mailing.Add(1)
+	go func() {
+		defer s.mailing.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), backgroundEmailTimeout)
+		defer cancel()
+		if err := s.sendEmailToken(ctx, userID, email, purpose); err != nil {
+			log.Printf("Error sending %s email to user %d: %v", purpose, userID, err)
+		}
+	}()
+}
+
+// Письмо со ссылкой, содержащей одноразовый токен
+func (s *server) sendEmailToken(ctx context.Context, userID int, email, purpose string) error {
+	ttl, path, subject, text := emailVerificationTTL, "/verify-email", "Подтверждение адреса электронной почты",
+		"Чтобы подтвердить адрес, перейдите по ссылке:"
+	if purpose == emailTokenReset {
+		ttl, path, subject, text = passwordResetTTL, "/password/reset", "Сброс пароля",
+			"Для сброса пароля перейдите по ссылке. Если вы не запрашивали сброс, просто проигнорируйте это письмо."
+	}
+	token, expiresAt, err := generatePurposeToken(userID, purpose, ttl)
+	if err != nil {
+		return err
+	}
+	err = s.emailTokens.CreateEmailToken(ctx, EmailToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		Email:     email,
+		TokenHash: hashToken(token),
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return err
+	}
+	link := appBaseURL + path + "?token=" + url.QueryEscape(token)
+	body := fmt.Sprintf("%s\n%s\n\nСсылка действует до %s.", text, link, expiresAt.UTC().Format("02.01.2006 15:04 MST"))
+	return s.mailer.Send(ctx, email, subject, body)
+}
+
+// Проверка подписи и погашение токена; любой недействительный токен — errEmailTokenInvalid
+func (s *server) consumeEmailToken(ctx context.Context, token, purpose string) (EmailToken, error) {
+	claims, err := validateToken(token, refreshSecret)
+	if err != nil {
+		return EmailToken{}, errEmailTokenInvalid
+	}
+	if p, _ := claims["purpose"].(string); p != purpose {
+		return EmailToken{}, errEmailTokenInvalid
+	}
+	record, err := s.emailTokens.ConsumeEmailToken(ctx, purpose, hashToken(token))
+	if errors.Is(err, ErrNotFound) {
+		return EmailToken{}, errEmailTokenInvalid
+	}
+	if err != nil {
+		return EmailToken{}, err
+	}
+	if sub, _ := claims["sub"].(string); sub != strconv.Itoa(record.UserID) {
+		return EmailToken{}, errEmailTokenInvalid
+	}
+	return record, nil
+}
+
+// Ответ на запросы писем не зависит от того, существует ли адрес: так его нельзя проверить перебором
+func writeEmailAccepted(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"message": "If the address is registered, an email has been sent"})
+}
+
+// GET /verify-email?token=... — переход по ссылке из письма;
+// POST /verify-email {"email": "..."} — повторная отправка письма
+func (s *server) verifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		token, err := s.consumeEmailToken(r.Context(), r.URL.Query().Get("token"), emailTokenVerify)
+		if err == nil {
+			err = s.users.MarkEmailVerified(r.Context(), token.UserID, token.Email)
+			if errors.Is(err, ErrNotFound) {
+				// Адрес сменился после отправки письма
+				err = errEmailTokenInvalid
+			}
+		}
+		if errors.Is(err, errEmailTokenInvalid) {
+			http.Error(w, "Verification link is invalid or expired", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			log.Printf("Error verifying email: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/login?verified=1", http.StatusSeeOther)
+
+	case http.MethodPost:
+		var req struct {
+			Email string `json:"email"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		user, err := s.users.GetUserByEmail(r.Context(), req.Email)
+		if err == nil && !user.EmailVerified {
+			s.sendEmailTokenAsync(user.ID, user.Email, emailTokenVerify)
+		} else if err != nil && !errors.Is(err, ErrNotFound) {
+			log.Printf("Error looking up user by email: %v", err)
+		}
+		writeEmailAccepted(w)
+
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// POST /password/forgot {"email": "..."}
+func (s *server) forgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	user, err := s.users.GetUserByEmail(r.Context(), req.Email)
+	if err == nil {
+		s.sendEmailTokenAsync(user.ID, user.Email, emailTokenReset)
+	} else if !errors.Is(err, ErrNotFound) {
+		log.Printf("Error looking up user by email: %v", err)
+	}
+	writeEmailAccepted(w)
+}
+
+// GET /password/reset — страница сброса пароля;
+// POST /password/reset {"token": "...", "new_password": "..."} — новый пароль; все сессии завершаются,
+// персональные токены доступа отзываются: сброс пароля — обычная реакция на взлом аккаунта
+func (s *server) resetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		tmpl, err := template.ParseFiles("reset_password.html")
+		if err != nil {
+			fmt.Println(err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		tmpl.Execute(w, nil)
+
+	case http.MethodPost:
+		var req struct {
+			Token       string `json:"token"`
+			NewPassword string `json:"new_password"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if utf8.RuneCountInString(req.NewPassword) < minPasswordLength {
+			http.Error(w, fmt.Sprintf("new_password: must be at least %d characters", minPasswordLength), http.StatusBadRequest)
+			return
+		}
+		token, err := s.consumeEmailToken(r.Context(), req.Token, emailTokenReset)
+		if errors.Is(err, errEmailTokenInvalid) {
+			http.Error(w, "Reset link is invalid or expired", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			log.Printf("Error consuming password reset token: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		stored, err := s.storedUser(r.Context(), token.UserID)
+		if errors.Is(err, ErrNotFound) {
+			http.Error(w, "Reset link is invalid or expired", http.StatusBadRequest)
+			return
+		}
+		if err == nil {
+			err = rehashPassword(r.Context(), s.users, token.UserID, stored.Password, req.NewPassword)
+		}
+		// Пароль сменили между чтением и записью; ссылка уже использована
+		if errors.Is(err, ErrNotFound) {
+			http.Error(w, "Password was changed concurrently, request a new reset link", http.StatusConflict)
+			return
+		}
+		if err == nil {
+			err = s.sessions.RevokeUserRefreshTokens(r.Context(), token.UserID)
+		}
+		if err == nil {
+			err = s.accessTokens.DeleteUserAccessTokens(r.Context(), token.UserID)
+		}
+		if err != nil {
+			log.Printf("Error resetting password of user %d: %v", token.UserID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		// Письмо дошло — адрес подтверждён, если не сменился с момента отправки
+		if err := s.users.MarkEmailVerified(r.Context(), token.UserID, token.Email); err != nil && !errors.Is(err, ErrNotFound) {
+			log.Printf("Error marking email of user %d verified: %v", token.UserID, err)
+		}
+		log.Printf("Password of user %d reset by email", token.UserID)
+		clearRefreshCookie(w)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
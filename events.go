@@ -0,0 +1,435 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// События об изменениях данных для GET /api/events (Server-Sent Events).
+// Тип события — "<объект>.<действие>": notebook.created, page.updated, task.deleted и т. п.
+const (
+	eventCreated = "created"
+	eventUpdated = "updated"
+	eventDeleted = "deleted"
+)
+
+// Служебное событие: пропущенные события восстановить нельзя, клиент должен перезагрузить данные
+const eventReset = "reset"
+
+// Сколько событий может ждать отправки одному клиенту; медленный клиент отключается
+// и при переподключении догоняет остальных по журналу
+const subscriberBuffer = 64
+
+const eventRetry = 3 * time.Second // пауза перед переподключением EventSource
+
+type Event struct {
+	ID       string          `json:"-"` // "<эпоха>-<номер>", назначается хабом
+	Type     string          `json:"type"`
+	ObjectID int             `json:"id"`
+	Data     json.RawMessage `json:"data,omitempty"` // объект после изменения; у удалённых отсутствует
+	Audience []int           `json:"-"`              // пользователи, которым видно событие
+}
+
+// Публикация событий: локальный хаб или рассылка через PostgreSQL (pgEventBus).
+// Ошибки публикации не отменяют изменение, поэтому только логируются.
+type EventPublisher interface {
+	Publish(ctx context.Context, e Event)
+}
+
+// Хаб событий экземпляра сервера: раздаёт события подписчикам и хранит последние события
+// в журнале, чтобы переподключившийся клиент получил пропущенное по Last-Event-ID.
+type eventHub struct {
+	mu          sync.Mutex
+	epoch       string // меняется при перезапуске и при потере событий; id из другой эпохи не продолжить
+	seq         int64
+	log         []Event
+	logSize     int
+	subscribers map[*eventSubscription]struct{}
+}
+
+type eventSubscription struct {
+	userID int
+	events chan Event // закрывается хабом, если клиент не успевает читать
+}
+
+func newEventHub(logSize int) *eventHub {
+	h := &eventHub{logSize: logSize, subscribers: map[*eventSubscription]struct{}{}}
+	h.epoch = newEventEpoch()
+	return h
+}
+
+func newEventEpoch() string {
+	epoch, err := randomID(4)
+	if err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return epoch
+}
+
+func (h *eventHub) Publish(ctx context.Context, e Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.seq++
+	e.ID = fmt.Sprintf("%s-%d", h.epoch, h.seq)
+	h.log = append(h.log, e)
+	if len(h.log) > h.logSize {
+		h.log = h.log[len(h.log)-h.logSize:]
+	}
+	for sub := range h.subscribers {
+		if !e.visibleTo(sub.userID) {
+			continue
+		}
+		select {
+		case sub.events <- e:
+		default:
+			h.dropLocked(sub)
+		}
+	}
+}
+
+// Подписка пользователя с продолжением после lastEventID. Возвращает пропущенные события;
+// complete = false, если часть пропущенного уже вытеснена из журнала или id из другой эпохи.
+func (h *eventHub) Subscribe(userID int, lastEventID string) (sub *eventSubscription, backlog []Event, complete bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	complete = true
+	if lastEventID != "" {
+		backlog, complete = h.sinceLocked(lastEventID, userID)
+	}
+	sub = &eventSubscription{userID: userID, events: make(chan Event, subscriberBuffer)}
+	h.subscribers[sub] = struct{}{}
+	return sub, backlog, complete
+}
+
+func (h *eventHub) sinceLocked(lastEventID string, userID int) ([]Event, bool) {
+	epoch, seqStr, ok := strings.Cut(lastEventID, "-")
+	seq, err := strconv.ParseInt(seqStr, 10, 64)
+	if !ok || err != nil || epoch != h.epoch || seq > h.seq {
+		return nil, false
+	}
+	// Журнал хранит события с номерами (h.seq-len(h.log), h.seq]
+	first := h.seq - int64(len(h.log)) + 1
+	if seq+1 < first {
+		return nil, false
+	}
+	var backlog []Event
+	for _, e := range h.log[seq+1-first:] {
+		if e.visibleTo(userID) {
+			backlog = append(backlog, e)
+		}
+	}
+	return backlog, true
+}
+
+func (h *eventHub) Unsubscribe(sub *eventSubscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.subscribers[sub]; ok {
+		h.dropLocked(sub)
+	}
+}
+
+func (h *eventHub) dropLocked(sub *eventSubscription) {
+	delete(h.subscribers, sub)
+	close(sub.events)
+}
+
+// События могли быть потеряны (например, разрывалось соединение LISTEN): журнал сбрасывается,
+// а подписчики отключаются и при переподключении получают reset
+func (h *eventHub) Invalidate() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.epoch = newEventEpoch()
+	h.seq = 0
+	h.log = nil
+	for sub := range h.subscribers {
+		h.dropLocked(sub)
+	}
+}
+
+func (e Event) visibleTo(userID int) bool {
+	for _, id := range e.Audience {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// Публикация события об объекте блокнота notebookID всем, у кого есть доступ к блокноту;
+// если блокнот общий, остальные получают ещё и уведомление
+func (s *server) publish(ctx context.Context, notebookID int, object, action string, id int, data any) {
+	audience := s.notebookAudience(ctx, notebookID)
+	s.publishTo(ctx, audience, object, action, id, data)
+	s.notifyNotebookChange(ctx, notebookID, audience, object, action, id, data)
+}
+
+func (s *server) publishTo(ctx context.Context, audience []int, object, action string, id int, data any) {
+	if len(audience) == 0 {
+		return
+	}
+	e := Event{Type: object + "." + action, ObjectID: id, Audience: audience}
+	if data != nil {
+		raw, err := json.Marshal(data)
+		if err != nil {
+			log.Printf("Ошибка кодирования события %s: %v", e.Type, err)
+			return
+		}
+		e.Data = raw
+	}
+	s.events.Publish(ctx, e)
+}
+
+// Получатели событий о блокноте
+func (s *server) notebookAudience(ctx context.Context, notebookID int) []int {
+	audience, err := notebookReaders(ctx, s.notebooks, s.workspaces, notebookID)
+	if err != nil {
+		log.Printf("Ошибка получения участников блокнота %d для события: %v", notebookID, err)
+	}
+	return audience
+}
+
+// Все, кто видит блокнот (роль не ниже viewer): владелец, участники блокнота и, если роль
+// по умолчанию даёт доступ, участники его пространства. При ошибке — те, кого успели найти.
+func notebookReaders(ctx context.Context, notebooks NotebookStore, workspaces WorkspaceStore, notebookID int) ([]int, error) {
+	members, err := notebooks.ListNotebookMembers(ctx, notebookID)
+	if err != nil {
+		return nil, err
+	}
+	readers := make([]int, 0, len(members))
+	for _, m := range members {
+		readers = append(readers, m.UserID)
+	}
+
+	notebook, err := notebooks.GetNotebook(ctx, notebookID)
+	if err != nil {
+		return readers, nil
+	}
+	workspace, err := workspaces.GetWorkspace(ctx, notebook.WorkspaceID)
+	if err != nil || workspace.DefaultRole == roleNone {
+		return readers, nil
+	}
+	wsMembers, err := workspaces.ListWorkspaceMembers(ctx, workspace.ID)
+	if err != nil {
+		return readers, fmt.Errorf("Ошибка при получении участников пространства %d: %v", workspace.ID, err)
+	}
+	ids := make([]int, 0, len(wsMembers))
+	for _, m := range wsMembers {
+		ids = append(ids, m.UserID)
+	}
+	return mergeAudience(readers, ids), nil
+}
+
+// GET /api/events: поток событий в формате text/event-stream.
+// Продолжение — по заголовку Last-Event-ID (EventSource передаёт его сам) или параметру last_event_id.
+func (s *server) eventsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	userID, err := userIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("last_event_id")
+	}
+	sub, backlog, complete := s.hub.Subscribe(userID, lastEventID)
+	defer s.hub.Unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // nginx не должен буферизовать поток
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", eventRetry.Milliseconds())
+	if !complete {
+		fmt.Fprintf(w, "event: %s\ndata: {}\n\n", eventReset)
+	}
+	for _, e := range backlog {
+		writeEvent(w, e)
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(s.heartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e, ok := <-sub.events:
+			if !ok {
+				return // клиент отстал или журнал сброшен — переподключится сам
+			}
+			writeEvent(w, e)
+		case <-heartbeat.C:
+			// Комментарий не виден клиенту, но не даёт прокси закрыть простаивающее соединение
+			fmt.Fprint(w, ": ping\n\n")
+		}
+		flusher.Flush()
+	}
+}
+
+func writeEvent(w http.ResponseWriter, e Event) {
+	data, _ := json.Marshal(e)
+	fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+}
+
+// EventSource не умеет передавать заголовки, поэтому для потока событий
+// access-токен можно передать параметром access_token
+func queryTokenMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if token := q.Get("access_token"); token != "" && r.Header.Get("Authorization") == "" {
+			r = r.Clone(r.Context())
+			r.Header.Set("Authorization", "Bearer "+token)
+			q.Del("access_token")
+			r.URL.RawQuery = q.Encode()
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Канал LISTEN/NOTIFY для рассылки событий между экземплярами сервера
+const eventsChannel = "taskflow_events"
+
+// Полезная нагрузка NOTIFY ограничена 8000 байт. Крупные объекты отправляются без data —
+// клиент всё равно перезагружает изменившийся список, — а длинный список получателей
+// делится между несколькими сообщениями.
+const maxNotifyPayload = 7000
+
+// Рассылка событий через PostgreSQL: событие уходит в NOTIFY, а каждый экземпляр, включая
+// отправивший, получает его через LISTEN и передаёт своему хабу
+type pgEventBus struct {
+	pool *pgxpool.Pool
+	hub  *eventHub
+}
+
+// Событие вместе с получателями — в таком виде оно передаётся через NOTIFY
+type notifyEvent struct {
+	Type     string          `json:"type"`
+	ObjectID int             `json:"id"`
+	Data     json.RawMessage `json:"data,omitempty"`
+	Audience []int           `json:"audience"`
+}
+
+func newPgEventBus(pool *pgxpool.Pool, hub *eventHub) *pgEventBus {
+	return &pgEventBus{pool: pool, hub: hub}
+}
+
+func (b *pgEventBus) Publish(ctx context.Context, e Event) {
+	payloads, err := notifyPayloads(e)
+	if err != nil {
+		log.Printf("Ошибка кодирования события %s: %v", e.Type, err)
+		return
+	}
+	for _, payload := range payloads {
+		if _, err := b.pool.Exec(ctx, "SELECT pg_notify($1, $2)", eventsChannel, string(payload)); err != nil {
+			log.Printf("Ошибка отправки события %s: %v", e.Type, err)
+		}
+	}
+}
+
+// Сообщения NOTIFY для события, каждое не длиннее maxNotifyPayload. Получатели делятся между
+// сообщениями, и каждый получает событие ровно один раз. Data остаётся, если занимает
+// не больше половины сообщения, иначе на получателей почти не осталось бы места.
+func notifyPayloads(e Event) ([][]byte, error) {
+	payload, err := json.Marshal(notifyEvent{e.Type, e.ObjectID, e.Data, e.Audience})
+	if err != nil || len(payload) <= maxNotifyPayload {
+		return [][]byte{payload}, err
+	}
+
+	empty, err := json.Marshal(notifyEvent{e.Type, e.ObjectID, e.Data, []int{}})
+	if err != nil {
+		return nil, err
+	}
+	data := e.Data
+	if len(empty) > maxNotifyPayload/2 {
+		data = nil
+		if empty, err = json.Marshal(notifyEvent{e.Type, e.ObjectID, nil, []int{}}); err != nil {
+			return nil, err
+		}
+	}
+
+	var payloads [][]byte
+	flush := func(audience []int) error {
+		payload, err := json.Marshal(notifyEvent{e.Type, e.ObjectID, data, audience})
+		payloads = append(payloads, payload)
+		return err
+	}
+	start, size := 0, len(empty)
+	for i, id := range e.Audience {
+		n := len(strconv.Itoa(id)) + 1 // с запятой
+		if size+n > maxNotifyPayload && i > start {
+			if err := flush(e.Audience[start:i]); err != nil {
+				return nil, err
+			}
+			start, size = i, len(empty)
+		}
+		size += n
+	}
+	if err := flush(e.Audience[start:]); err != nil {
+		return nil, err
+	}
+	return payloads, nil
+}
+
+// Приём событий до отмены ctx. После разрыва соединения подписка восстанавливается,
+// а хаб сбрасывается: события за время разрыва потеряны.
+func (b *pgEventBus) Listen(ctx context.Context) {
+	for {
+		err := b.listen(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("Ошибка LISTEN %s: %v", eventsChannel, err)
+		b.hub.Invalidate()
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(eventRetry):
+		}
+	}
+}
+
+func (b *pgEventBus) listen(ctx context.Context) error {
+	conn, err := b.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+	if _, err := conn.Exec(ctx, "LISTEN "+eventsChannel); err != nil {
+		return err
+	}
+	for {
+		n, err := conn.Conn().WaitForNotification(ctx)
+		if err != nil {
+			// Соединение с невыполненным LISTEN не должно вернуться в пул
+			conn.Conn().Close(context.Background())
+			return err
+		}
+		var e notifyEvent
+		if err := json.Unmarshal([]byte(n.Payload), &e); err != nil {
+			log.Printf("Некорректное событие в %s: %v", eventsChannel, err)
+			continue
+		}
+		b.hub.Publish(ctx, Event{Type: e.Type, ObjectID: e.ObjectID, Data: e.Data, Audience: e.Audience})
+	}
+}
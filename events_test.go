@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestEventHubResume(t *testing.T) {
+	ctx := context.Background()
+	h := newEventHub(3)
+	for i := 1; i <= 4; i++ {
+		h.Publish(ctx, Event{Type: "task.updated", ObjectID: i, Audience: []int{1}})
+	}
+	h.Publish(ctx, Event{Type: "task.updated", ObjectID: 99, Audience: []int{2}})
+
+	// В журнале события 3, 4 и 99; продолжение после события 3
+	sub, backlog, complete := h.Subscribe(1, h.log[0].ID)
+	defer h.Unsubscribe(sub)
+	assert.True(t, complete)
+	require.Len(t, backlog, 1, "Чужие события не попадают в журнал подписчика")
+	assert.Equal(t, 4, backlog[0].ObjectID)
+
+	_, _, complete = h.Subscribe(1, h.epoch+"-1")
+	assert.False(t, complete, "Событие 2 уже вытеснено из журнала")
+	_, _, complete = h.Subscribe(1, "other-4")
+	assert.False(t, complete, "Id из другой эпохи")
+	_, backlog, complete = h.Subscribe(1, "")
+	assert.True(t, complete)
+	assert.Empty(t, backlog, "Без Last-Event-ID — только новые события")
+}
+
+func TestEventHubDelivery(t *testing.T) {
+	ctx := context.Background()
+	h := newEventHub(10)
+	mine, _, _ := h.Subscribe(1, "")
+	slow, _, _ := h.Subscribe(1, "")
+	other, _, _ := h.Subscribe(2, "")
+
+	h.Publish(ctx, Event{Type: "notebook.created", ObjectID: 1, Audience: []int{1}})
+	e := <-mine.events
+	assert.Equal(t, "notebook.created", e.Type)
+	assert.NotEmpty(t, e.ID)
+	assert.Len(t, other.events, 0)
+
+	// Отставший подписчик отключается, остальные продолжают получать события
+	for i := 0; i < subscriberBuffer; i++ {
+		h.Publish(ctx, Event{Type: "task.updated", ObjectID: i, Audience: []int{1}})
+		<-mine.events
+	}
+	for range slow.events {
+	}
+	_, ok := h.subscribers[slow]
+	assert.False(t, ok)
+	h.Unsubscribe(slow) // повторная отписка безопасна
+
+	h.Invalidate()
+	_, ok = <-mine.events
+	assert.False(t, ok, "После сброса журнала подписчики отключаются")
+	_, _, complete := h.Subscribe(1, e.ID)
+	assert.False(t, complete)
+}
+
+func TestNotifyPayloads(t *testing.T) {
+	decode := func(payloads [][]byte) (audience []int, events []notifyEvent) {
+		for _, p := range payloads {
+			assert.LessOrEqual(t, len(p), maxNotifyPayload, "NOTIFY не примет сообщение длиннее 8000 байт")
+			var e notifyEvent
+			require.NoError(t, json.Unmarshal(p, &e))
+			audience = append(audience, e.Audience...)
+			events = append(events, e)
+		}
+		return audience, events
+	}
+
+	payloads, err := notifyPayloads(Event{Type: "task.updated", ObjectID: 7, Data: json.RawMessage(`{"title":"Report"}`), Audience: []int{1, 2}})
+	require.NoError(t, err)
+	assert.Len(t, payloads, 1)
+
+	// Большое пространство: получатели делятся между сообщениями, data сохраняется
+	audience := make([]int, 5000)
+	for i := range audience {
+		audience[i] = 1000000 + i
+	}
+	payloads, err = notifyPayloads(Event{Type: "task.updated", ObjectID: 7, Data: json.RawMessage(`{"title":"Report"}`), Audience: audience})
+	require.NoError(t, err)
+	assert.Greater(t, len(payloads), 1)
+	got, events := decode(payloads)
+	assert.Equal(t, audience, got, "Каждый получатель — ровно в одном сообщении")
+	for _, e := range events {
+		assert.Equal(t, "task.updated", e.Type)
+		assert.JSONEq(t, `{"title":"Report"}`, string(e.Data))
+	}
+
+	// Крупный объект и много получателей: data не отправляется
+	big := json.RawMessage(`{"content":"` + strings.Repeat("x", maxNotifyPayload) + `"}`)
+	payloads, err = notifyPayloads(Event{Type: "page.updated", ObjectID: 3, Data: big, Audience: audience})
+	require.NoError(t, err)
+	got, events = decode(payloads)
+	assert.Equal(t, audience, got)
+	assert.Empty(t, events[0].Data)
+}
@@ -34,7 +34,7 @@ func SignUpGetHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // Обработчик для регистрации пользователя signup POST
-func SignUpPostHandler(w http.ResponseWriter, r *http.Request) {
+func (s *server) SignUpPostHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodPost {
 		var req SignUpRequest
 		// Логирование входящего запроса
@@ -46,18 +46,21 @@ func SignUpPostHandler(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "Invalid request body", http.StatusBadRequest)
 			return
 		}
-		log.Printf("Decoded data: %+v", req)
+		log.Printf("Decoded data: email=%s username=%s", req.Email, req.Username)
+		if !emailRe.MatchString(req.Email) {
+			http.Error(w, "email: must be a valid email address", http.StatusBadRequest)
+			return
+		}
 
-		// Создание нового пользователя
+		// Создание нового пользователя (пароль хешируется в insertUser)
 		user := User{
 			Email:    req.Email,
 			Username: req.Username,
-			Password: req.Password, // Убедитесь, что пароль хэшируется
+			Password: req.Password,
 		}
-		log.Printf("Created user object: %+v", user)
 
 		// Вставка пользователя в базу данных
-		err := insertUser(user)
+		err := s.registerUser(r.Context(), user)
 		if err != nil {
 			log.Printf("Error inserting user: %v", err)
 
@@ -70,6 +73,13 @@ func SignUpPostHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		// Письмо для подтверждения адреса; ошибка отправки не отменяет регистрацию
+		if created, err := s.users.GetUserByUsername(r.Context(), user.Username); err != nil {
+			log.Printf("Error loading registered user: %v", err)
+		} else if err := s.sendEmailToken(r.Context(), created.ID, created.Email, emailTokenVerify); err != nil {
+			log.Printf("Error sending verification email to user %d: %v", created.ID, err)
+		}
+
 		// Успех
 		log.Println("User successfully registered")
 		w.WriteHeader(http.StatusOK)
@@ -88,7 +98,7 @@ func LogInGetHandler(w http.ResponseWriter, r *http.Request) {
 	tmpl.Execute(w, nil)
 }
 
-func LoginPostHandler(w http.ResponseWriter, r *http.Request) {
+func (s *server) LoginPostHandler(w http.ResponseWriter, r *http.Request) {
 	var req LoginRequest
 	// Логирование входящего запроса
 	log.Println("Received request for login")
@@ -103,90 +113,119 @@ func LoginPostHandler(w http.ResponseWriter, r *http.Request) {
 		Username: req.Username,
 		Password: req.Password,
 	}
-	log.Printf("Decoded data: %+v", req)
-	exists, userID, err := findUser(&user)
+	log.Printf("Decoded data: username=%s", req.Username)
+
+	// Защита от перебора: после неудачных попыток вход с аккаунта или IP-адреса приостанавливается
+	ip := clientIP(r, loginThrottle.TrustProxy)
+	if !s.beginLoginAttempt(w, r, req.Username, nil, ip) {
+		return
+	}
+	exists, userID, err := s.findUser(r.Context(), &user)
 	if err != nil {
-		handleError(w, err, http.StatusBadRequest)
+		log.Printf("Error checking credentials of %q: %v", req.Username, err)
+		handleError(w, errLoginFailed, http.StatusInternalServerError)
 		return
 	}
 	if !exists {
-		handleError(w, fmt.Errorf("user not found"), http.StatusNotFound)
+		s.recordLoginFailure(r.Context(), req.Username, nil, ip, loginFailedCredentials)
+		handleError(w, errInvalidCredentials, http.StatusUnauthorized)
+		return
+	}
+	if requireVerifiedEmail {
+		stored, err := s.users.GetUser(r.Context(), userID)
+		if err != nil {
+			log.Printf("Error loading user %d at login: %v", userID, err)
+			handleError(w, errLoginFailed, http.StatusInternalServerError)
+			return
+		}
+		if !stored.EmailVerified {
+			// Пароль верный, поэтому попытка не считается перебором
+			s.releaseLoginAttempt(r.Context(), req.Username, ip)
+			s.recordLoginFailure(r.Context(), req.Username, &userID, ip, loginFailedUnverified)
+			handleError(w, fmt.Errorf("email is not verified"), http.StatusForbidden)
+			return
+		}
+	}
+
+	// С подключённой 2FA пароль — только первый шаг: выдаётся токен для обмена на код
+	totp, err := s.twoFactor.GetTOTP(r.Context(), userID)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		log.Printf("Error loading TOTP secret of user %d at login: %v", userID, err)
+		handleError(w, errLoginFailed, http.StatusInternalServerError)
+		return
+	}
+	if totp.Confirmed {
+		s.releaseLoginAttempt(r.Context(), req.Username, ip)
+		challenge, _, err := generatePurposeToken(userID, purposeLoginChallenge, loginChallengeTTL)
+		if err != nil {
+			log.Printf("Error issuing login challenge for user %d: %v", userID, err)
+			handleError(w, errLoginFailed, http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"twoFactorRequired": true, "challengeToken": challenge})
 		return
 	}
 
+	// С 2FA счётчик аккаунта сбрасывается только после второго шага: иначе коды можно было бы
+	// перебирать, каждый раз заново вводя известный пароль
+	s.resetLoginFailures(r.Context(), req.Username, ip)
+	s.startSession(w, r, userID)
+}
+
+// Выдача access-токена и refresh-токена новой сессии в ответ на успешный вход
+func (s *server) startSession(w http.ResponseWriter, r *http.Request, userID int) {
 	accessToken, err := generateAccessToken(strconv.Itoa(userID))
 	if err != nil {
 		handleError(w, err, http.StatusBadRequest)
 		return
 	}
 
-	refreshToken, err := generateRefreshToken(strconv.Itoa(userID))
+	// Новая сессия: refresh-токен сохраняется в базе и отдаётся только в HttpOnly куке
+	refreshToken, err := s.issueRefreshToken(r.Context(), userID)
 	if err != nil {
-		handleError(w, err, http.StatusBadRequest)
+		handleError(w, err, http.StatusInternalServerError)
 		return
 	}
-	http.SetCookie(w, &http.Cookie{
-		Name:     "refreshToken",
-		Value:    refreshToken,
-		Path:     "/",
-		HttpOnly: false,
-	})
-	log.Printf("Set refresh token: %s", refreshToken)
+	setRefreshCookie(w, refreshToken)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Access-Control-Allow-Credentials", "true")
 	fmt.Fprintf(w, `{"accessToken": "%s"}`, accessToken)
 }
 
-func refreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+func (s *server) refreshTokenHandler(w http.ResponseWriter, r *http.Request) {
 	// 1. Получение refresh-токена из куков
-	refreshCookie, err := r.Cookie("refreshToken")
+	refreshCookie, err := r.Cookie(refreshCookieName)
 	if err != nil {
 		http.Error(w, "Refresh token is missing", http.StatusUnauthorized)
-		log.Printf("ошибка 1 ")
 		return
 	}
-	refreshToken := refreshCookie.Value
 
-	// 2. Проверка refresh-токена
-	claims, err := validateToken(refreshToken, refreshSecret)
+	// 2. Ротация: старый токен становится недействительным, выдаётся новый из той же сессии
+	newRefreshToken, userID, err := s.rotateRefreshToken(r.Context(), refreshCookie.Value)
 	if err != nil {
-		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
-		return
-	}
-
-	// 3. Получение userID из claims
-	userID, ok := claims["userID"].(string)
-	if !ok {
-		http.Error(w, "Invalid claims in refresh token", http.StatusUnauthorized)
+		clearRefreshCookie(w)
+		if errors.Is(err, ErrRefreshTokenInvalid) || errors.Is(err, ErrRefreshTokenReused) {
+			http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		} else {
+			log.Printf("Error rotating refresh token: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
 		return
 	}
 
-	// 4. Генерация нового access-токена
-	newAccessToken, err := generateAccessToken(userID)
+	// 3. Генерация нового access-токена
+	newAccessToken, err := generateAccessToken(strconv.Itoa(userID))
 	if err != nil {
 		http.Error(w, "Failed to generate access token", http.StatusInternalServerError)
 		return
 	}
 
-	// 5. Генерация нового refresh-токена
-	newRefreshToken, err := generateRefreshToken(userID)
-	if err != nil {
-		http.Error(w, "Failed to generate refresh token", http.StatusInternalServerError)
-		return
-	}
-
-	// 6. Обновление refresh-токена в куках
-	http.SetCookie(w, &http.Cookie{
-		Name:     "refreshToken",
-		Value:    newRefreshToken,
-		Path:     "/",
-		HttpOnly: false,
-		Secure:   false, // Убедись, что используешь HTTPS
-		SameSite: http.SameSiteNoneMode,
-	})
+	// 4. Обновление refresh-токена в куках
+	setRefreshCookie(w, newRefreshToken)
 
-	// 7. Отправка нового access-токена клиенту
+	// 5. Отправка нового access-токена клиенту
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("X-Content-Type-Options", "nosniff")
 	w.Header().Set("X-Frame-Options", "DENY")
@@ -200,43 +239,51 @@ func refreshTokenHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
-// Handler для получения блокнотов пользователя
-func getNotebooksHandler(w http.ResponseWriter, r *http.Request) {
-	// Извлекаем токен из заголовка Authorization
-	tokenString := r.Header.Get("Authorization")
-	if tokenString == "" {
-		http.Error(w, "Missing Authorization header", http.StatusUnauthorized)
-		return
-	}
-
-	// Убираем "Bearer " из начала строки, если он есть
-	if strings.HasPrefix(tokenString, "Bearer ") {
-		tokenString = tokenString[len("Bearer "):]
+// Выход: отзыв текущей сессии и удаление куки
+func (s *server) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	if refreshCookie, err := r.Cookie(refreshCookieName); err == nil {
+		if err := s.sessions.RevokeRefreshFamily(r.Context(), hashToken(refreshCookie.Value)); err != nil {
+			log.Printf("Error revoking session: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
 	}
+	clearRefreshCookie(w)
+	w.WriteHeader(http.StatusNoContent)
+}
 
-	// Проверяем и валидируем токен
-	claims, err := validateToken(tokenString, accessSecret)
+// Выход на всех устройствах: отзыв всех сессий пользователя
+func (s *server) logoutAllHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := userIDFromContext(r)
 	if err != nil {
-		http.Error(w, "Invalid token: "+err.Error(), http.StatusUnauthorized)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
-
-	// Извлекаем userID из токена
-	userIDString, ok := claims["userID"].(string)
-	if !ok {
-		http.Error(w, "Invalid userID in token", http.StatusUnauthorized)
+	if err := s.sessions.RevokeUserRefreshTokens(r.Context(), userID); err != nil {
+		log.Printf("Error revoking sessions of user %d: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
+	clearRefreshCookie(w)
+	w.WriteHeader(http.StatusNoContent)
+}
 
-	// Преобразуем userID из строки в int
-	userID, err := strconv.Atoi(userIDString)
+// Handler для получения блокнотов пользователя
+func (s *server) getNotebooksHandler(w http.ResponseWriter, r *http.Request) {
+	// Получаем userID, который tokenAuthMiddleware положил в контекст
+	userID, err := userIDFromContext(r)
 	if err != nil {
-		http.Error(w, "Invalid userID format", http.StatusUnauthorized)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
-	// Получаем блокноты пользователя
-	notebooks, err := getNotebooksByUserID(userID)
+	workspace, ok := s.requestWorkspace(w, r, userID)
+	if !ok {
+		return
+	}
+
+	// Получаем блокноты пользователя в пространстве
+	notebooks, err := s.notebooks.ListNotebooks(r.Context(), userID, workspace.ID)
 	if err != nil {
 		log.Println("Error fetching notebooks:", err) // Логируем ошибку
 		http.Error(w, "Failed to fetch notebooks: "+err.Error(), http.StatusInternalServerError)
@@ -250,43 +297,18 @@ func getNotebooksHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // createNotebookHandler — обработчик для создания нового блокнота
-func createNotebookHandler(w http.ResponseWriter, r *http.Request) {
-	// Извлекаем токен из заголовка Authorization
-	tokenString := r.Header.Get("Authorization")
-	if tokenString == "" {
-		http.Error(w, "Missing Authorization header", http.StatusUnauthorized)
-		return
-	}
-
-	// Убираем "Bearer " из начала строки, если он есть
-	if strings.HasPrefix(tokenString, "Bearer ") {
-		tokenString = tokenString[len("Bearer "):]
-	}
-
-	// Проверяем и валидируем токен
-	claims, err := validateToken(tokenString, accessSecret)
-	if err != nil {
-		http.Error(w, "Invalid token: "+err.Error(), http.StatusUnauthorized)
-		return
-	}
-
-	// Извлекаем userID из токена
-	userIDString, ok := claims["userID"].(string)
-	if !ok {
-		http.Error(w, "Invalid userID in token", http.StatusUnauthorized)
-		return
-	}
-
-	// Преобразуем userID из строки в int
-	userID, err := strconv.Atoi(userIDString)
+func (s *server) createNotebookHandler(w http.ResponseWriter, r *http.Request) {
+	// Получаем userID, который tokenAuthMiddleware положил в контекст
+	userID, err := userIDFromContext(r)
 	if err != nil {
-		http.Error(w, "Invalid userID format", http.StatusUnauthorized)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
 	// Парсим данные о блокноте из тела запроса
 	var notebook struct {
-		Name string `json:"name"`
+		Name        string `json:"name"`
+		WorkspaceID int    `json:"workspace_id"` // по умолчанию — выбранное пространство
 	}
 	if err := json.NewDecoder(r.Body).Decode(&notebook); err != nil {
 		http.Error(w, "Invalid request data", http.StatusBadRequest)
@@ -299,37 +321,49 @@ func createNotebookHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Создаем структуру для вставки в базу данных
+	// Создавать блокноты может любой участник пространства
+	if notebook.WorkspaceID == 0 {
+		current, err := s.workspaces.CurrentWorkspace(r.Context(), userID)
+		if err != nil {
+			http.Error(w, "Failed to load current workspace: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		notebook.WorkspaceID = current.ID
+	} else if _, err := s.authorizeWorkspace(r.Context(), userID, notebook.WorkspaceID, workspaceMember); err != nil {
+		writeAuthzError(w, err)
+		return
+	}
+
+	// Создаем структуру для вставки в базу данных; id и время создания проставит база
 	notebookToInsert := Notebook{
-		UserID:    userID, // Используем преобразованный userID как int
-		Name:      notebook.Name,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+		UserID:      userID, // Используем преобразованный userID как int
+		WorkspaceID: notebook.WorkspaceID,
+		Name:        notebook.Name,
 	}
 
 	// Вставляем блокнот в базу данных
-	err = insertNotebook(notebookToInsert)
+	created, err := s.notebooks.CreateNotebook(r.Context(), notebookToInsert)
 	if err != nil {
 		http.Error(w, "Failed to create notebook: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	s.publish(r.Context(), created.ID, "notebook", eventCreated, created.ID, created)
 
-	// Отправляем успешный ответ
+	// Отправляем успешный ответ с сохранённым блокнотом
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", fmt.Sprintf("/api/notebooks/%d", created.ID))
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(struct {
 		Message string `json:"message"`
-		ID      int    `json:"id"`
-		Name    string `json:"name"`
+		Notebook
 	}{
-		Message: "Notebook created successfully",
-		ID:      notebookToInsert.ID, // ID блока после вставки
-		Name:    notebookToInsert.Name,
+		Message:  "Notebook created successfully",
+		Notebook: created,
 	})
 }
 
 // Обработчик для обновления блокнота
-func updateNotebookHandler(w http.ResponseWriter, r *http.Request) {
+func (s *server) updateNotebookHandler(w http.ResponseWriter, r *http.Request) {
 	// Получаем идентификатор блокнота из URL
 	notebookIDStr := r.URL.Path[len("/api/notebooks/"):]
 
@@ -344,6 +378,18 @@ func updateNotebookHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Проверяем, что блокнот принадлежит пользователю
+	userID, err := userIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	access, err := s.authorizeNotebook(r.Context(), userID, notebookID, roleEditor)
+	if err != nil {
+		writeAuthzError(w, err)
+		return
+	}
+
 	// Читаем данные из тела запроса
 	notebook := Notebook{}
 	err = json.NewDecoder(r.Body).Decode(&notebook)
@@ -354,18 +400,77 @@ func updateNotebookHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Выполняем обновление в базе данных
-	err = UpdateNotebook(notebook)
+	updated, err := s.notebooks.UpdateNotebook(r.Context(), notebook)
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Failed to update notebook: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	s.publish(r.Context(), access.NotebookID, "notebook", eventUpdated, updated.ID, updated)
 
-	// Возвращаем успешный ответ
+	// Возвращаем обновлённый блокнот
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Notebook updated"})
+	json.NewEncoder(w).Encode(struct {
+		Message string `json:"message"`
+		Notebook
+	}{
+		Message:  "Notebook updated",
+		Notebook: updated,
+	})
 }
 
-func deleteNotebookHandler(w http.ResponseWriter, r *http.Request) {
+// PATCH /api/notebooks/{id}: меняются только переданные поля
+func (s *server) patchNotebookHandler(w http.ResponseWriter, r *http.Request) {
+	notebookID, err := strconv.Atoi(r.URL.Path[len("/api/notebooks/"):])
+	if err != nil {
+		http.Error(w, "Invalid notebook_id format", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := userIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	access, err := s.authorizeNotebook(r.Context(), userID, notebookID, roleEditor)
+	if err != nil {
+		writeAuthzError(w, err)
+		return
+	}
+
+	var patch NotebookPatch
+	if err := decodePatch(r.Body, &patch); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	patched, err := s.notebooks.PatchNotebook(r.Context(), notebookID, patch)
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to update notebook: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.publish(r.Context(), access.NotebookID, "notebook", eventUpdated, patched.ID, patched)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(struct {
+		Message string `json:"message"`
+		Notebook
+	}{
+		Message:  "Notebook updated",
+		Notebook: patched,
+	})
+}
+
+func (s *server) deleteNotebookHandler(w http.ResponseWriter, r *http.Request) {
 	// Получаем идентификатор блокнота из URL
 	notebookIDStr := r.URL.Path[len("/api/notebooks/"):]
 
@@ -380,6 +485,18 @@ func deleteNotebookHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Проверяем, что блокнот принадлежит пользователю
+	userID, err := userIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	access, err := s.authorizeNotebook(r.Context(), userID, notebookID, roleOwner)
+	if err != nil {
+		writeAuthzError(w, err)
+		return
+	}
+
 	// Читаем данные из тела запроса
 	notebook := Notebook{}
 	//err = json.NewDecoder(r.Body).Decode(&notebook)
@@ -389,12 +506,16 @@ func deleteNotebookHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Участники блокнота узнают об удалении, поэтому список получателей собирается заранее
+	audience := s.notebookAudience(r.Context(), access.NotebookID)
+
 	// Выполняем обновление в базе данных
-	err = DeleteNotebook(notebook)
+	err = s.notebooks.DeleteNotebook(r.Context(), notebook.ID)
 	if err != nil {
 		http.Error(w, "Failed to update notebook: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	s.publishTo(r.Context(), audience, "notebook", eventDeleted, notebook.ID, nil)
 
 	// Возвращаем успешный ответ
 	w.WriteHeader(http.StatusOK)
@@ -402,7 +523,99 @@ func deleteNotebookHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // Handler для получения страниц блокнота
-func getPagesHandler(w http.ResponseWriter, r *http.Request) {
+// Адреса отдельных страниц и задач. GET /api/pages/{id} и /api/tasks/{id} исторически возвращают
+// страницы блокнота и задачи страницы, поэтому для одной записи — отдельный путь.
+const (
+	pageByIDPrefix = "/api/pages/by-id/"
+	taskByIDPrefix = "/api/tasks/by-id/"
+)
+
+// GET /api/notebooks/{id} — блокнот с ролью текущего пользователя
+func (s *server) getNotebookHandler(w http.ResponseWriter, r *http.Request) {
+	notebookID, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/api/notebooks/"))
+	if err != nil {
+		http.Error(w, "Invalid notebook ID", http.StatusBadRequest)
+		return
+	}
+	userID, err := userIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	access, err := s.authorizeNotebook(r.Context(), userID, notebookID, roleViewer)
+	if err != nil {
+		writeAuthzError(w, err)
+		return
+	}
+	notebook, err := s.notebooks.GetNotebook(r.Context(), notebookID)
+	if err != nil {
+		writeAuthzError(w, err)
+		return
+	}
+	notebook.Role = access.Role
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(notebook)
+}
+
+// GET /api/pages/by-id/{id} — одна страница
+func (s *server) getPageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	pageID, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, pageByIDPrefix))
+	if err != nil {
+		http.Error(w, "Invalid page ID", http.StatusBadRequest)
+		return
+	}
+	userID, err := userIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if _, err := s.authorizePage(r.Context(), userID, pageID, roleViewer); err != nil {
+		writeAuthzError(w, err)
+		return
+	}
+	page, err := s.pages.GetPage(r.Context(), pageID)
+	if err != nil {
+		writeAuthzError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+// GET /api/tasks/by-id/{id} — одна задача
+func (s *server) getTaskHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	taskID, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, taskByIDPrefix))
+	if err != nil {
+		http.Error(w, "Invalid task ID", http.StatusBadRequest)
+		return
+	}
+	userID, err := userIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if _, err := s.authorizeTask(r.Context(), userID, taskID, roleViewer); err != nil {
+		writeAuthzError(w, err)
+		return
+	}
+	task, err := s.tasks.GetTask(r.Context(), taskID)
+	if err != nil {
+		writeAuthzError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(task)
+}
+
+func (s *server) getPagesHandler(w http.ResponseWriter, r *http.Request) {
 	urlPath := r.URL.Path
 	parts := strings.Split(urlPath, "/")
 
@@ -419,9 +632,32 @@ func getPagesHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Проверяем, что блокнот принадлежит пользователю
+	userID, err := userIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if _, err := s.authorizeNotebook(r.Context(), userID, notebookID, roleViewer); err != nil {
+		writeAuthzError(w, err)
+		return
+	}
+
+	// ?labels=1,2&label_mode=any|all — только страницы с метками
+	labels, err := parseLabelFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	log.Printf("Fetching pages for notebook ID: %d", notebookID)
 
-	pages, err := getPagesByNotebookID(notebookID)
+	var pages []Page
+	if len(labels.IDs) > 0 {
+		pages, err = s.pages.ListPagesByLabels(r.Context(), notebookID, labels)
+	} else {
+		pages, err = s.pages.ListPages(r.Context(), notebookID)
+	}
 	if err != nil {
 		log.Printf("Error fetching pages for notebook ID %d: %v", notebookID, err)
 		http.Error(w, fmt.Sprintf("Error fetching pages: %v", err), http.StatusInternalServerError)
@@ -442,7 +678,7 @@ func getPagesHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // createPageHandler — обработчик для создания страницы
-func createPageHandler(w http.ResponseWriter, r *http.Request) {
+func (s *server) createPageHandler(w http.ResponseWriter, r *http.Request) {
 	// Получаем notebookID из URL
 	notebookIDStr := r.URL.Query().Get("notebook_id")
 	if notebookIDStr == "" {
@@ -456,6 +692,18 @@ func createPageHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Проверяем, что блокнот принадлежит пользователю
+	userID, err := userIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	access, err := s.authorizeNotebook(r.Context(), userID, notebookID, roleEditor)
+	if err != nil {
+		writeAuthzError(w, err)
+		return
+	}
+
 	// Парсим данные страницы из тела запроса
 	var page struct {
 		Title   string `json:"title"`
@@ -471,35 +719,31 @@ func createPageHandler(w http.ResponseWriter, r *http.Request) {
 		NotebookID: notebookID, // Используем полученный notebookID
 		Title:      page.Title,
 		Content:    page.Content,
-		CreatedAt:  time.Now(),
-		UpdatedAt:  time.Now(),
 	}
 
 	// Вставляем страницу в базу данных
-	err = insertPage(pageToInsert)
+	created, err := s.pages.CreatePage(r.Context(), pageToInsert)
 	if err != nil {
 		http.Error(w, "Failed to create page: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	s.publish(r.Context(), access.NotebookID, "page", eventCreated, created.ID, created)
 
-	// Отправляем успешный ответ
+	// Отправляем успешный ответ с сохранённой страницей
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", fmt.Sprintf("%s%d", pageByIDPrefix, created.ID))
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(struct {
 		Message string `json:"message"`
-		ID      int    `json:"id"`
-		Title   string `json:"title"`
-		Content string `json:"content"`
+		Page
 	}{
 		Message: "Page created successfully",
-		ID:      pageToInsert.ID,
-		Title:   pageToInsert.Title,
-		Content: pageToInsert.Content,
+		Page:    created,
 	})
 }
 
 // Обработчик для обновления блокнота
-func updatePagesHandler(w http.ResponseWriter, r *http.Request) {
+func (s *server) updatePagesHandler(w http.ResponseWriter, r *http.Request) {
 	// Получаем идентификатор блокнота из URL
 	pageIDStr := r.URL.Path[len("/api/pages/"):]
 
@@ -514,6 +758,18 @@ func updatePagesHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Проверяем, что страница принадлежит пользователю
+	userID, err := userIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	access, err := s.authorizePage(r.Context(), userID, pageID, roleEditor)
+	if err != nil {
+		writeAuthzError(w, err)
+		return
+	}
+
 	// Читаем данные из тела запроса
 	page := Page{}
 	err = json.NewDecoder(r.Body).Decode(&page)
@@ -524,19 +780,78 @@ func updatePagesHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Выполняем обновление в базе данных
-	err = UpdatePage(page)
+	updated, err := s.pages.UpdatePage(r.Context(), page)
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Failed to update page: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	s.publish(r.Context(), access.NotebookID, "page", eventUpdated, updated.ID, updated)
 
-	// Возвращаем успешный ответ
+	// Возвращаем обновлённую страницу
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(struct {
+		Message string `json:"message"`
+		Page
+	}{
+		Message: "Page updated",
+		Page:    updated,
+	})
+}
+
+// PATCH /api/pages/{id}: меняются только переданные поля
+func (s *server) patchPageHandler(w http.ResponseWriter, r *http.Request) {
+	pageID, err := strconv.Atoi(r.URL.Path[len("/api/pages/"):])
+	if err != nil {
+		http.Error(w, "Invalid page_id format", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := userIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	access, err := s.authorizePage(r.Context(), userID, pageID, roleEditor)
+	if err != nil {
+		writeAuthzError(w, err)
+		return
+	}
+
+	var patch PagePatch
+	if err := decodePatch(r.Body, &patch); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	patched, err := s.pages.PatchPage(r.Context(), pageID, patch)
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to update page: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.publish(r.Context(), access.NotebookID, "page", eventUpdated, patched.ID, patched)
+
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Page updated"})
+	json.NewEncoder(w).Encode(struct {
+		Message string `json:"message"`
+		Page
+	}{
+		Message: "Page updated",
+		Page:    patched,
+	})
 }
 
 // Handler для удаления страницы
-func deletePagesHandler(w http.ResponseWriter, r *http.Request) {
+func (s *server) deletePagesHandler(w http.ResponseWriter, r *http.Request) {
 	// Получаем идентификатор блокнота из URL
 	pageIDStr := r.URL.Path[len("/api/pages/"):]
 
@@ -551,6 +866,18 @@ func deletePagesHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Проверяем, что страница принадлежит пользователю
+	userID, err := userIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	access, err := s.authorizePage(r.Context(), userID, pageID, roleEditor)
+	if err != nil {
+		writeAuthzError(w, err)
+		return
+	}
+
 	// Читаем данные из тела запроса
 	page := Page{}
 	//err = json.NewDecoder(r.Body).Decode(&page)
@@ -561,11 +888,12 @@ func deletePagesHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Выполняем обновление в базе данных
-	err = DeletePage(page)
+	err = s.pages.DeletePage(r.Context(), page.ID)
 	if err != nil {
 		http.Error(w, "Failed to update page: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	s.publish(r.Context(), access.NotebookID, "page", eventDeleted, page.ID, nil)
 
 	// Возвращаем успешный ответ
 	w.WriteHeader(http.StatusOK)
@@ -573,7 +901,7 @@ func deletePagesHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // Handler для получения задач страницы
-func getTasksHandler(w http.ResponseWriter, r *http.Request) {
+func (s *server) getTasksHandler(w http.ResponseWriter, r *http.Request) {
 	urlPath := r.URL.Path
 	parts := strings.Split(urlPath, "/")
 
@@ -588,10 +916,21 @@ func getTasksHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Проверяем, что страница принадлежит пользователю
+	userID, err := userIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if _, err := s.authorizePage(r.Context(), userID, pageID, roleViewer); err != nil {
+		writeAuthzError(w, err)
+		return
+	}
+
 	log.Printf("Fetching tasks for page ID: %d", pageID)
 
 	// Получаем задачи для страницы из базы данных
-	tasks, err := getTasksByPageID(pageID)
+	tasks, err := s.tasks.ListTasks(r.Context(), pageID)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Error fetching tasks: %v", err), http.StatusInternalServerError)
 		return
@@ -599,6 +938,22 @@ func getTasksHandler(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("Found %d tasks for page ID %d", len(tasks), pageID)
 
+	// ?tree=true — задачи верхнего уровня с вложенными подзадачами, чек-листами и прогрессом
+	if r.URL.Query().Get("tree") == "true" {
+		taskIDs := make([]int, len(tasks))
+		for i, t := range tasks {
+			taskIDs[i] = t.ID
+		}
+		items, err := s.checklists.ListChecklistItems(r.Context(), taskIDs)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error fetching checklists: %v", err), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(buildTaskTree(tasks, items, taskWorkflow))
+		return
+	}
+
 	// Если задач нет, возвращаем пустой массив
 	if len(tasks) == 0 {
 		w.Header().Set("Content-Type", "application/json")
@@ -613,7 +968,61 @@ func getTasksHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(tasks)
 }
 
-func createTaskHandler(w http.ResponseWriter, r *http.Request) {
+// GET /api/tasks: задачи пользователя по блокнотам пространства с фильтрами, сортировкой и курсором.
+// Ответ: {"tasks": [...], "next_cursor": "..."}; next_cursor пуст на последней странице.
+func (s *server) listTasksHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := userIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	filter, err := parseTaskFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter.UserID = userID
+	workspace, ok := s.requestWorkspace(w, r, userID)
+	if !ok {
+		return
+	}
+	filter.WorkspaceID = workspace.ID
+
+	// «Сегодня» и «просрочено» считаются в часовом поясе пользователя
+	if filter.Due != "" {
+		loc, err := s.userLocation(r.Context(), userID)
+		if err != nil {
+			http.Error(w, "Failed to load user time zone: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		filter.DueWindow = newDueWindow(time.Now(), loc)
+	}
+
+	// Запрашиваем на одну задачу больше, чтобы узнать, есть ли следующая страница
+	limit := filter.Limit
+	filter.Limit++
+	tasks, err := s.tasks.ListUserTasks(r.Context(), filter)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error fetching tasks: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	var nextCursor string
+	if len(tasks) > limit {
+		tasks = tasks[:limit]
+		nextCursor = encodeTaskCursor(tasks[limit-1], filter.Sort)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(struct {
+		Tasks      []Task `json:"tasks"`
+		NextCursor string `json:"next_cursor,omitempty"`
+	}{tasks, nextCursor})
+}
+
+func (s *server) createTaskHandler(w http.ResponseWriter, r *http.Request) {
 	// Получаем ID страницы из URL
 	pageIDStr := r.URL.Query().Get("page_id")
 	if pageIDStr == "" {
@@ -628,6 +1037,18 @@ func createTaskHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Проверяем, что страница принадлежит пользователю
+	userID, err := userIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	access, err := s.authorizePage(r.Context(), userID, pageID, roleEditor)
+	if err != nil {
+		writeAuthzError(w, err)
+		return
+	}
+
 	// Декодируем тело запроса в структуру Task
 	var task Task
 	if err := json.NewDecoder(r.Body).Decode(&task); err != nil {
@@ -639,20 +1060,53 @@ func createTaskHandler(w http.ResponseWriter, r *http.Request) {
 	// Присваиваем полученное PageID
 	task.PageID = pageID
 
+	// Статус задаётся рабочим процессом: пустой — начальный, неизвестный — ошибка
+	if task.Status == "" {
+		task.Status = taskWorkflow.Initial
+	} else if !taskWorkflow.Valid(task.Status) {
+		http.Error(w, fmt.Sprintf("status: must be one of %v", taskWorkflow.Statuses()), http.StatusBadRequest)
+		return
+	}
+	if task.Recurrence, err = normalizeRecurrence(task.Recurrence); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Срок необязателен; у срока без времени остаётся только дата
+	if task.DueDate, err = normalizeDue(task.DueDate, task.DueAllDay); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Подзадача: родитель на той же странице, вложенность ограничена
+	if task.ParentID != nil {
+		if err := s.checkParentTask(r.Context(), pageID, *task.ParentID); err != nil {
+			var verr *validationError
+			if errors.As(err, &verr) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			http.Error(w, "Failed to create task: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
 	// Вставка задачи в базу данных
-	if err := insertTask(task); err != nil {
+	created, err := s.tasks.CreateTask(r.Context(), task, userID)
+	if err != nil {
 		log.Printf("Error inserting task: %v", err)
 		http.Error(w, "Failed to create task", http.StatusInternalServerError)
 		return
 	}
+	s.publish(r.Context(), access.NotebookID, "task", eventCreated, created.ID, created)
 
-	// Ответ клиенту с данными задачи
+	// Ответ клиенту с сохранённой задачей
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", fmt.Sprintf("%s%d", taskByIDPrefix, created.ID))
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(task)
+	json.NewEncoder(w).Encode(created)
 }
 
-func updateTasksHandler(w http.ResponseWriter, r *http.Request) {
+func (s *server) updateTasksHandler(w http.ResponseWriter, r *http.Request) {
 	// Получаем идентификатор блокнота из URL
 	taskIDStr := r.URL.Path[len("/api/tasks/"):]
 
@@ -667,6 +1121,18 @@ func updateTasksHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Проверяем, что задача принадлежит пользователю
+	userID, err := userIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	access, err := s.authorizeTask(r.Context(), userID, taskID, roleEditor)
+	if err != nil {
+		writeAuthzError(w, err)
+		return
+	}
+
 	// Читаем данные из тела запроса
 	task := Task{}
 	err = json.NewDecoder(r.Body).Decode(&task)
@@ -677,18 +1143,175 @@ func updateTasksHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Выполняем обновление в базе данных
-	err = UpdateTask(task)
+	updated, err := s.tasks.UpdateTask(r.Context(), task)
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Failed to update task: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	s.publish(r.Context(), access.NotebookID, "task", eventUpdated, updated.ID, updated)
 
-	// Возвращаем успешный ответ
+	// Возвращаем обновлённую задачу
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Page updated"})
+	json.NewEncoder(w).Encode(updated)
 }
 
-func deleteTasksHandler(w http.ResponseWriter, r *http.Request) {
+// PATCH /api/tasks/{id}: меняются только переданные поля; null в description очищает описание
+func (s *server) patchTaskHandler(w http.ResponseWriter, r *http.Request) {
+	taskID, err := strconv.Atoi(r.URL.Path[len("/api/tasks/"):])
+	if err != nil {
+		http.Error(w, "Invalid task_id format", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := userIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	access, err := s.authorizeTask(r.Context(), userID, taskID, roleEditor)
+	if err != nil {
+		writeAuthzError(w, err)
+		return
+	}
+
+	var patch TaskPatch
+	if err := decodePatch(r.Body, &patch); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if patch.Recurrence.Set {
+		patch.Recurrence.Value, _ = normalizeRecurrence(patch.Recurrence.Value) // уже проверено в Validate
+	}
+
+	var current Task
+	if patch.Status.Set || patch.DueDate.Set || patch.DueAllDay.Set {
+		if current, err = s.tasks.GetTask(r.Context(), taskID); err != nil {
+			writeAuthzError(w, err)
+			return
+		}
+	}
+
+	// Срок и флаг «без времени» проверяются вместе и сохраняются уже нормализованными
+	if patch.DueDate.Set || patch.DueAllDay.Set {
+		patched := current
+		patch.apply(&patched)
+		due, err := normalizeDue(patched.DueDate, patched.DueAllDay)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		patch.DueDate = optional[time.Time]{Set: true, Null: due == nil}
+		if due != nil {
+			patch.DueDate.Value = *due
+		}
+		patch.DueAllDay = optional[bool]{Set: true, Value: patched.DueAllDay}
+	}
+
+	// Смена статуса проверяется по рабочему процессу; хранилище повторно сверит статус в транзакции
+	if patch.Status.Set {
+		if err := taskWorkflow.CheckTransition(current.Status, patch.Status.Value); err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		patch.FromStatus = current.Status
+		patch.ChangedBy = userID
+
+		// Выполнение повторяющейся задачи создаёт следующее повторение
+		if patch.Status.Value == taskWorkflow.Completed {
+			next := current
+			patch.apply(&next)
+			if next.Recurrence != "" {
+				rule, err := parseRecurrence(next.Recurrence)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				loc, err := s.userLocation(r.Context(), userID)
+				if err != nil {
+					http.Error(w, "Failed to load user time zone: "+err.Error(), http.StatusInternalServerError)
+					return
+				}
+				due, allDay := rule.nextDue(next, time.Now(), loc)
+				next.ID = 0
+				next.Status = taskWorkflow.Initial
+				next.Recurrence = rule.String()
+				next.DueDate, next.DueAllDay = &due, allDay
+				patch.Next = &next
+			}
+		}
+	}
+
+	// ?recursive=true при завершении задачи завершает и все подзадачи, кроме отменённых
+	if r.URL.Query().Get("recursive") == "true" {
+		if !patch.Status.Set || patch.Status.Value != taskWorkflow.Completed {
+			http.Error(w, fmt.Sprintf("recursive: only allowed when setting status to %q", taskWorkflow.Completed), http.StatusBadRequest)
+			return
+		}
+		patch.Cascade = true
+		if taskWorkflow.Cancelled != "" {
+			patch.CascadeSkip = []string{taskWorkflow.Cancelled}
+		}
+	}
+
+	patched, err := s.tasks.PatchTask(r.Context(), taskID, patch)
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, ErrStatusConflict) {
+		http.Error(w, "Task status was changed by another request, retry", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to update task: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.publish(r.Context(), access.NotebookID, "task", eventUpdated, patched.ID, patched)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(patched)
+}
+
+// GET /api/tasks/{id}/history: история смен статуса задачи
+func (s *server) getTaskHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	taskIDStr := strings.TrimSuffix(r.URL.Path[len("/api/tasks/"):], "/history")
+	taskID, err := strconv.Atoi(taskIDStr)
+	if err != nil {
+		http.Error(w, "Invalid task_id format", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := userIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if _, err := s.authorizeTask(r.Context(), userID, taskID, roleViewer); err != nil {
+		writeAuthzError(w, err)
+		return
+	}
+
+	history, err := s.tasks.TaskStatusHistory(r.Context(), taskID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error fetching task history: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if history == nil {
+		history = []TaskStatusChange{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(history)
+}
+
+func (s *server) deleteTasksHandler(w http.ResponseWriter, r *http.Request) {
 	// Получаем идентификатор блокнота из URL
 	taskIDStr := r.URL.Path[len("/api/tasks/"):]
 
@@ -703,48 +1326,81 @@ func deleteTasksHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Читаем данные из тела запроса
-	task := Task{}
-	//err = json.NewDecoder(r.Body).Decode(&task)
-	task.ID = taskID
+	// Проверяем, что задача принадлежит пользователю
+	userID, err := userIDFromContext(r)
 	if err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	access, err := s.authorizeTask(r.Context(), userID, taskID, roleEditor)
+	if err != nil {
+		writeAuthzError(w, err)
 		return
 	}
 
+	// Задачу с подзадачами удаляем только явно, вместе с подзадачами (?recursive=true)
+	if r.URL.Query().Get("recursive") != "true" {
+		task, err := s.tasks.GetTask(r.Context(), taskID)
+		if err != nil {
+			writeAuthzError(w, err)
+			return
+		}
+		has, err := s.hasSubtasks(r.Context(), task)
+		if err != nil {
+			http.Error(w, "Failed to delete task: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if has {
+			http.Error(w, "Task has subtasks; use recursive=true to delete them too", http.StatusConflict)
+			return
+		}
+	}
+
 	// Выполняем обновление в базе данных
-	err = DeleteTask(task)
+	err = s.tasks.DeleteTask(r.Context(), taskID)
 	if err != nil {
 		http.Error(w, "Failed to delete task: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	s.publish(r.Context(), access.NotebookID, "task", eventDeleted, taskID, nil)
 
 	// Возвращаем успешный ответ
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"message": "Task deleted"})
 }
 
-/*func profileHandler(w http.ResponseWriter, r *http.Request) {
-	// Получение токена из заголовка
-	userID, err := validateAuthorization(r)
+// GET /api/search?q=: поиск по блокнотам, страницам и задачам пользователя в пространстве
+func (s *server) searchHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := userIDFromContext(r)
 	if err != nil {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
-	// Извлечение данных пользователя из базы данных
-	user, err := findUserByID(userID)
-	if err != nil {
-		http.Error(w, "User not found", http.StatusNotFound)
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		http.Error(w, "Missing q in query parameters", http.StatusBadRequest)
 		return
 	}
+	limit := defaultSearchLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 || limit > maxSearchLimit {
+			http.Error(w, fmt.Sprintf("limit: must be an integer from 1 to %d", maxSearchLimit), http.StatusBadRequest)
+			return
+		}
+	}
 
-	// Ответ с данными профиля
-	response := map[string]interface{}{
-		"username":   user.Username,
-		"email":      user.Email,
-		"created_at": user.CreatedAt,
+	workspace, ok := s.requestWorkspace(w, r, userID)
+	if !ok {
+		return
 	}
-	json.NewEncoder(w).Encode(response)
+	results, err := s.search.Search(r.Context(), userID, workspace.ID, query, limit)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error searching: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(results)
 }
-*/
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	maxLabelNameLength = 64
+	defaultLabelColor  = "#9e9e9e"
+)
+
+var labelColorRe = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+func validateLabelName(name string) error {
+	if strings.TrimSpace(name) == "" || utf8.RuneCountInString(name) > maxLabelNameLength {
+		return &validationError{"name", fmt.Sprintf("must be a non-empty string of at most %d characters", maxLabelNameLength)}
+	}
+	return nil
+}
+
+// Фильтр списков задач и страниц по меткам: any — есть хотя бы одна из меток, all — есть все.
+// Пустой IDs означает «без ограничения».
+type LabelFilter struct {
+	IDs      []int
+	MatchAll bool
+}
+
+// Разбор labels=1,2&label_mode=any|all
+func parseLabelFilter(q url.Values) (LabelFilter, error) {
+	var f LabelFilter
+	seen := map[int]bool{}
+	if v := q.Get("labels"); v != "" {
+		for _, part := range strings.Split(v, ",") {
+			id, err := strconv.Atoi(strings.TrimSpace(part))
+			if err != nil {
+				return f, &validationError{"labels", "must be a comma-separated list of label IDs"}
+			}
+			// Повторы убираем: для all число совпавших меток сравнивается с len(IDs)
+			if !seen[id] {
+				seen[id] = true
+				f.IDs = append(f.IDs, id)
+			}
+		}
+	}
+	switch q.Get("label_mode") {
+	case "", "any":
+	case "all":
+		f.MatchAll = true
+	default:
+		return f, &validationError{"label_mode", "must be one of [any all]"}
+	}
+	return f, nil
+}
+
+// Подходит ли набор меток записи под фильтр — для хранилища в памяти
+func (f LabelFilter) matches(labels map[int]bool) bool {
+	if len(f.IDs) == 0 {
+		return true
+	}
+	for _, id := range f.IDs {
+		if labels[id] && !f.MatchAll {
+			return true
+		}
+		if !labels[id] && f.MatchAll {
+			return false
+		}
+	}
+	return f.MatchAll
+}
+
+// Проверка, что метка принадлежит пользователю
+func (s *server) authorizeLabel(ctx context.Context, userID, labelID int) error {
+	ownerID, err := s.labels.LabelOwnerID(ctx, labelID)
+	return checkOwner(userID, ownerID, err)
+}
+
+// GET /api/labels — метки пользователя, POST /api/labels — новая метка
+func (s *server) labelsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := userIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	switch r.Method {
+	case http.MethodGet:
+		labels, err := s.labels.ListLabels(r.Context(), userID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error fetching labels: %v", err), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(labels)
+
+	case http.MethodPost:
+		var label Label
+		if err := json.NewDecoder(r.Body).Decode(&label); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if label.Color == "" {
+			label.Color = defaultLabelColor
+		}
+		if err := validateLabelName(label.Name); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !labelColorRe.MatchString(label.Color) {
+			http.Error(w, "color: must be a #rrggbb hex color", http.StatusBadRequest)
+			return
+		}
+		label.UserID = userID
+
+		created, err := s.labels.CreateLabel(r.Context(), label)
+		if errors.Is(err, ErrDuplicateKey) {
+			http.Error(w, "Label with this name already exists", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			log.Printf("Error inserting label: %v", err)
+			http.Error(w, "Failed to create label", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Location", fmt.Sprintf("/api/labels/%d", created.ID))
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(created)
+
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// PATCH и DELETE /api/labels/{id}
+func (s *server) labelHandler(w http.ResponseWriter, r *http.Request) {
+	labelID, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/api/labels/"))
+	if err != nil {
+		http.Error(w, "Invalid label_id format", http.StatusBadRequest)
+		return
+	}
+	if r.Method != http.MethodPatch && r.Method != http.MethodDelete {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := userIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if err := s.authorizeLabel(r.Context(), userID, labelID); err != nil {
+		writeAuthzError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method == http.MethodDelete {
+		if err := s.labels.DeleteLabel(r.Context(), labelID); err != nil {
+			http.Error(w, "Failed to delete label: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"message": "Label deleted"})
+		return
+	}
+
+	var patch LabelPatch
+	if err := decodePatch(r.Body, &patch); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	patched, err := s.labels.PatchLabel(r.Context(), labelID, patch)
+	if errors.Is(err, ErrDuplicateKey) {
+		http.Error(w, "Label with this name already exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		writeAuthzError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(patched)
+}
+
+// GET и PUT /api/tasks/{id}/labels
+func (s *server) taskLabelsHandler(w http.ResponseWriter, r *http.Request) {
+	s.linkedLabelsHandler(w, r, "/api/tasks/", s.authorizeTask, s.labels.TaskLabels, s.labels.SetTaskLabels)
+}
+
+// GET и PUT /api/pages/{id}/labels
+func (s *server) pageLabelsHandler(w http.ResponseWriter, r *http.Request) {
+	s.linkedLabelsHandler(w, r, "/api/pages/", s.authorizePage, s.labels.PageLabels, s.labels.SetPageLabels)
+}
+
+// Метки задачи или страницы: GET — список, PUT {"label_ids": [...]} — замена набора меток.
+// Привязывать можно только свои метки. Метки личные, поэтому в общем блокноте
+// менять свои метки может и участник с ролью viewer.
+func (s *server) linkedLabelsHandler(
+	w http.ResponseWriter, r *http.Request, prefix string,
+	authorize func(ctx context.Context, userID, id int, need string) (Access, error),
+	list func(ctx context.Context, userID, id int) ([]Label, error),
+	set func(ctx context.Context, userID, id int, labelIDs []int) error,
+) {
+	id, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, prefix), "/labels"))
+	if err != nil {
+		http.Error(w, "Invalid ID format", http.StatusBadRequest)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodPut {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := userIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if _, err := authorize(r.Context(), userID, id, roleViewer); err != nil {
+		writeAuthzError(w, err)
+		return
+	}
+
+	if r.Method == http.MethodPut {
+		var req struct {
+			LabelIDs []int `json:"label_ids"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		for _, labelID := range req.LabelIDs {
+			if err := s.authorizeLabel(r.Context(), userID, labelID); errors.Is(err, ErrNotFound) {
+				http.Error(w, fmt.Sprintf("label_ids: label %d not found", labelID), http.StatusBadRequest)
+				return
+			} else if err != nil {
+				writeAuthzError(w, err)
+				return
+			}
+		}
+		if err := set(r.Context(), userID, id, req.LabelIDs); err != nil {
+			http.Error(w, "Failed to update labels: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	labels, err := list(r.Context(), userID, id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error fetching labels: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(labels)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/url"
+	"testing"
+)
+
+func TestParseLabelFilter(t *testing.T) {
+	q, err := url.ParseQuery("labels=3,1,3&label_mode=all")
+	require.NoError(t, err)
+	f, err := parseLabelFilter(q)
+	require.NoError(t, err)
+	assert.Equal(t, []int{3, 1}, f.IDs, "Повторы убираются")
+	assert.True(t, f.MatchAll)
+
+	f, err = parseLabelFilter(url.Values{})
+	require.NoError(t, err)
+	assert.Empty(t, f.IDs)
+	assert.False(t, f.MatchAll)
+
+	for _, bad := range []string{"labels=bug", "labels=1,", "label_mode=none"} {
+		q, _ := url.ParseQuery(bad)
+		_, err := parseLabelFilter(q)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestLabelFilterMatches(t *testing.T) {
+	set := map[int]bool{1: true, 2: true}
+	tests := []struct {
+		filter LabelFilter
+		want   bool
+	}{
+		{LabelFilter{}, true},
+		{LabelFilter{IDs: []int{2, 3}}, true},
+		{LabelFilter{IDs: []int{3}}, false},
+		{LabelFilter{IDs: []int{1, 2}, MatchAll: true}, true},
+		{LabelFilter{IDs: []int{1, 3}, MatchAll: true}, false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, tt.filter.matches(set), "%+v", tt.filter)
+	}
+	assert.False(t, LabelFilter{IDs: []int{1}}.matches(nil))
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Способы отправки писем (mail.driver)
+const (
+	mailDriverSMTP = "smtp"
+	mailDriverLog  = "log"
+)
+
+// Отправка писем пользователям: подтверждение адреса, сброс пароля
+type Mailer interface {
+	Send(ctx context.Context, to, subject, body string) error
+}
+
+// Выбор реализации по конфигурации; SMTP-сервер общий с напоминаниями
+func newMailer(cfg Config) Mailer {
+	if cfg.Mail.Driver == mailDriverSMTP {
+		return newSMTPMailer(cfg.Reminders.SMTP)
+	}
+	return &logMailer{path: cfg.Mail.File}
+}
+
+// Предельное время одной отправки, если у ctx нет более раннего срока: зависший SMTP-сервер
+// не должен задерживать планировщик напоминаний и фоновые письма
+const smtpTimeout = 30 * time.Second
+
+// Отправка через SMTP
+type smtpMailer struct {
+	cfg  SMTPConfig
+	send func(ctx context.Context, addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+func newSMTPMailer(cfg SMTPConfig) smtpMailer {
+	return smtpMailer{cfg: cfg, send: sendMail}
+}
+
+func (m smtpMailer) Send(ctx context.Context, to, subject, body string) error {
+	ctx, cancel := context.WithTimeout(ctx, smtpTimeout)
+	defer cancel()
+
+	var auth smtp.Auth
+	if m.cfg.Username != "" {
+		auth = smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.cfg.Host)
+	}
+	// В конверте нужен голый адрес, в заголовке From — как в конфигурации, с именем
+	from, err := mail.ParseAddress(m.cfg.From)
+	if err != nil {
+		return err
+	}
+	addr := net.JoinHostPort(m.cfg.Host, strconv.Itoa(m.cfg.Port))
+	return m.send(ctx, addr, auth, from.Address, []string{to}, buildEmail(m.cfg.From, to, subject, body))
+}
+
+// То же, что smtp.SendMail, но с учётом ctx: соединение открывается через DialContext,
+// срок ctx становится дедлайном всего обмена, а отмена ctx закрывает соединение
+func sendMail(ctx context.Context, addr string, a smtp.Auth, from string, to []string, msg []byte) (err error) {
+	if strings.ContainsAny(from, "\r\n") {
+		return errors.New("smtp: адрес отправителя содержит перевод строки")
+	}
+	for _, rcpt := range to {
+		if strings.ContainsAny(rcpt, "\r\n") {
+			return errors.New("smtp: адрес получателя содержит перевод строки")
+		}
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	// Ошибка чтения из закрытого соединения менее понятна, чем причина отмены
+	defer func() {
+		if err != nil && ctx.Err() != nil {
+			err = ctx.Err()
+		}
+	}()
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if err := c.Hello("localhost"); err != nil {
+		return err
+	}
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if a != nil {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return errors.New("smtp: сервер не поддерживает AUTH")
+		}
+		if err := c.Auth(a); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		if err := c.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// Для разработки: письма выводятся в журнал или дописываются в файл path.
+// Вне окружения development конфигурация такой способ не допускает.
+type logMailer struct {
+	path string
+	mu   sync.Mutex
+}
+
+func (m *logMailer) Send(ctx context.Context, to, subject, body string) error {
+	if m.path == "" {
+		log.Printf("Письмо для %s: %s\n%s", to, subject, body)
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, err := os.OpenFile(m.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("ошибка открытия файла писем: %v", err)
+	}
+	defer f.Close()
+	_, err = fmt.Fprintf(f, "Date: %s\n%s\n\n", time.Now().Format(time.RFC1123Z), buildEmail("TaskFlow", to, subject, body))
+	return err
+}
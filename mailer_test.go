@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogMailerFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mail.log")
+	m := newMailer(Config{Mail: MailConfig{Driver: mailDriverLog, File: path}})
+
+	require.NoError(t, m.Send(context.Background(), "first@example.com", "Сброс пароля", "Ссылка: https://example.com/?token=a"))
+	require.NoError(t, m.Send(context.Background(), "second@example.com", "Подтверждение", "Ссылка: https://example.com/?token=b"))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	content := string(data)
+	assert.Contains(t, content, "To: first@example.com")
+	assert.Contains(t, content, "To: second@example.com", "Письма дописываются в конец файла")
+	assert.True(t, strings.Index(content, "token=a") < strings.Index(content, "token=b"))
+}
+
+func TestSMTPMailerHonoursContext(t *testing.T) {
+	// Сервер принимает соединение, но так и не присылает приветствие
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	m := newSMTPMailer(SMTPConfig{Host: "127.0.0.1", Port: ln.Addr().(*net.TCPAddr).Port, From: "TaskFlow <noreply@example.com>"})
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = m.Send(ctx, "user@example.com", "Сброс пароля", "Ссылка")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 5*time.Second, "Отправка не ждёт дольше срока ctx")
+}
@@ -1,5 +1,97 @@
 package main
 
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+)
+
 func main() {
-	startServer()
+	configPath := flag.String("config", os.Getenv("TASKFLOW_CONFIG"), "путь к YAML-файлу конфигурации")
+	flag.Parse()
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		log.Fatalf("Ошибка конфигурации:\n%v", err)
+	}
+	applyConfig(cfg)
+
+	switch flag.Arg(0) {
+	case "", "serve":
+		log.Printf("Действующая конфигурация:\n%s", cfg)
+		startServer(cfg)
+	case "config":
+		// Вывод действующей конфигурации без секретов
+		fmt.Print(cfg)
+	case "migrate":
+		// migrate up | down [N] | status
+		migrateCommand(flag.Args()[1:])
+	case "hash-passwords":
+		// Одноразовая миграция паролей, хранящихся открытым текстом
+		hashPasswordsCommand()
+	default:
+		log.Fatalf("Неизвестная команда: %s", flag.Arg(0))
+	}
+}
+
+func hashPasswordsCommand() {
+	pool, err := initDB()
+	if err != nil {
+		log.Fatalf("Ошибка подключения к базе данных: %v", err)
+	}
+	defer pool.Close()
+
+	migrated, err := migratePlaintextPasswords(context.Background(), newPgStore(pool))
+	if err != nil {
+		log.Fatalf("Ошибка миграции паролей (обработано %d): %v", migrated, err)
+	}
+	log.Printf("Хешировано паролей: %d", migrated)
+}
+
+func migrateCommand(args []string) {
+	pool, err := initDB()
+	if err != nil {
+		log.Fatalf("Ошибка подключения к базе данных: %v", err)
+	}
+	defer pool.Close()
+	ctx := context.Background()
+
+	action := "up"
+	if len(args) > 0 {
+		action = args[0]
+	}
+
+	switch action {
+	case "up":
+		applied, err := migrateUp(ctx, pool)
+		if err != nil {
+			log.Fatalf("Ошибка миграции (применено %d): %v", applied, err)
+		}
+		log.Printf("Применено миграций: %d", applied)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				log.Fatalf("Некорректное число шагов отката: %s", args[1])
+			}
+			steps = n
+		}
+		reverted, err := migrateDown(ctx, pool, steps)
+		if err != nil {
+			log.Fatalf("Ошибка отката (откачено %d): %v", reverted, err)
+		}
+		log.Printf("Откачено миграций: %d", reverted)
+	case "status":
+		status, err := migrationStatus(ctx, pool)
+		if err != nil {
+			log.Fatalf("Ошибка получения состояния миграций: %v", err)
+		}
+		fmt.Print(status)
+	default:
+		log.Fatalf("Неизвестное действие migrate: %s (ожидается up, down или status)", action)
+	}
 }
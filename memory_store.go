@@ -0,0 +1,1949 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Хранилище в памяти: для тестов и локального запуска без PostgreSQL.
+// Повторяет поведение pgStore, включая уникальность пользователей и каскадное удаление.
+type memoryStore struct {
+	mu                   sync.Mutex
+	*memoryLoginThrottle // счётчики попыток входа, со своей блокировкой
+
+	nextID         map[string]int
+	users          map[int]User
+	profiles       map[int]Profile                // userID → display_name и locale; остальные поля берутся из users
+	refreshTokens  map[string]*memoryRefreshToken // по хешу токена
+	emailTokens    map[string]*memoryEmailToken   // по хешу токена
+	totp           map[int]TOTPSecret
+	recoveryCodes  map[int]map[string]bool // userID → хеш кода → использован
+	usedChallenges map[string]time.Time    // jti погашенного токена второго шага → срок действия
+	accessTokens   map[int]AccessToken
+	notebooks      map[int]Notebook
+	members        map[int]map[int]NotebookMember // notebookID → userID → участник (без владельца)
+	workspaces     map[int]Workspace
+	wsMembers      map[int]map[int]WorkspaceMember // workspaceID → userID → участник
+	personalWS     map[int]int                     // userID → личное пространство
+	currentWS      map[int]int                     // userID → выбранное пространство
+	pages          map[int]Page
+	tasks          map[int]Task
+	statusHistory  []TaskStatusChange
+	checklistItems map[int]ChecklistItem
+	labels         map[int]Label
+	taskLabels     map[int]map[int]bool // taskID → набор labelID
+	pageLabels     map[int]map[int]bool // pageID → набор labelID
+	reminders      map[int]Reminder
+	notifications  map[int]Notification
+	loginAudit     []LoginAuditEntry
+}
+
+type memoryRefreshToken struct {
+	RefreshToken
+	used    bool
+	revoked bool
+}
+
+type memoryEmailToken struct {
+	EmailToken
+	used bool
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		nextID:         map[string]int{},
+		users:          map[int]User{},
+		profiles:       map[int]Profile{},
+		refreshTokens:  map[string]*memoryRefreshToken{},
+		emailTokens:    map[string]*memoryEmailToken{},
+		totp:           map[int]TOTPSecret{},
+		recoveryCodes:  map[int]map[string]bool{},
+		usedChallenges: map[string]time.Time{},
+		accessTokens:   map[int]AccessToken{},
+		notebooks:      map[int]Notebook{},
+		members:        map[int]map[int]NotebookMember{},
+		workspaces:     map[int]Workspace{},
+		wsMembers:      map[int]map[int]WorkspaceMember{},
+		personalWS:     map[int]int{},
+		currentWS:      map[int]int{},
+		pages:          map[int]Page{},
+		tasks:          map[int]Task{},
+		checklistItems: map[int]ChecklistItem{},
+		labels:         map[int]Label{},
+		taskLabels:     map[int]map[int]bool{},
+		pageLabels:     map[int]map[int]bool{},
+		reminders:      map[int]Reminder{},
+		notifications:  map[int]Notification{},
+
+		memoryLoginThrottle: newMemoryLoginThrottle(),
+	}
+}
+
+// Аналог SERIAL: отдельная последовательность для каждой таблицы
+func (m *memoryStore) newID(table string) int {
+	m.nextID[table]++
+	return m.nextID[table]
+}
+
+func (m *memoryStore) CreateUser(ctx context.Context, user User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, u := range m.users {
+		if u.Email == user.Email {
+			return fmt.Errorf("email already exists: %w", ErrDuplicateKey)
+		}
+		if u.Username == user.Username {
+			return fmt.Errorf("username already exists: %w", ErrDuplicateKey)
+		}
+	}
+	user.ID = m.newID("users")
+	if user.TimeZone == "" {
+		user.TimeZone = "UTC"
+	}
+	user.CreatedAt = time.Now().Format(time.RFC3339)
+	m.users[user.ID] = user
+	m.profiles[user.ID] = Profile{Locale: defaultLocale}
+
+	// Личное пространство, как в pgStore
+	personal := m.createWorkspaceLocked(Workspace{Name: personalWorkspaceName, DefaultRole: roleNone, Personal: true}, user.ID)
+	m.personalWS[user.ID] = personal.ID
+	return nil
+}
+
+func (m *memoryStore) GetUserByUsername(ctx context.Context, username string) (User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, u := range m.users {
+		if u.Username == username {
+			return u, nil
+		}
+	}
+	return User{}, ErrNotFound
+}
+
+func (m *memoryStore) GetUser(ctx context.Context, userID int) (User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.users[userID]
+	if !ok {
+		return User{}, ErrNotFound
+	}
+	u.Password = ""
+	return u, nil
+}
+
+func (m *memoryStore) GetUserByEmail(ctx context.Context, email string) (User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var found User
+	for _, u := range m.users {
+		if strings.EqualFold(u.Email, email) && (found.ID == 0 || u.ID < found.ID) {
+			found = u
+		}
+	}
+	if found.ID == 0 {
+		return User{}, ErrNotFound
+	}
+	found.Password = ""
+	return found, nil
+}
+
+func (m *memoryStore) UpdateUserTimeZone(ctx context.Context, userID int, timeZone string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.users[userID]
+	if !ok {
+		return ErrNotFound
+	}
+	u.TimeZone = timeZone
+	m.users[userID] = u
+	return nil
+}
+
+func (m *memoryStore) UpdatePasswordHash(ctx context.Context, userID int, oldHash, newHash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.users[userID]
+	if !ok || u.Password != oldHash {
+		return ErrNotFound
+	}
+	u.Password = newHash
+	m.users[userID] = u
+	return nil
+}
+
+func (m *memoryStore) profileLocked(userID int) Profile {
+	u := m.users[userID]
+	p := m.profiles[userID]
+	p.ID, p.Username, p.Email, p.TimeZone, p.EmailVerified = u.ID, u.Username, u.Email, u.TimeZone, u.EmailVerified
+	p.TwoFactorEnabled = m.totp[userID].Confirmed
+	p.CreatedAt, _ = time.Parse(time.RFC3339, u.CreatedAt)
+	return p
+}
+
+func (m *memoryStore) GetProfile(ctx context.Context, userID int) (Profile, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[userID]; !ok {
+		return Profile{}, ErrNotFound
+	}
+	return m.profileLocked(userID), nil
+}
+
+func (m *memoryStore) PatchProfile(ctx context.Context, userID int, patch ProfilePatch) (Profile, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.users[userID]
+	if !ok {
+		return Profile{}, ErrNotFound
+	}
+	for _, other := range m.users {
+		if other.ID == userID {
+			continue
+		}
+		if patch.Email.Set && other.Email == patch.Email.Value {
+			return Profile{}, fmt.Errorf("email already exists: %w", ErrDuplicateKey)
+		}
+		if patch.Username.Set && other.Username == patch.Username.Value {
+			return Profile{}, fmt.Errorf("username already exists: %w", ErrDuplicateKey)
+		}
+	}
+	p := m.profileLocked(userID)
+	patch.apply(&p)
+	if p.Email != u.Email {
+		// Новый адрес нужно подтвердить заново
+		p.EmailVerified = false
+	}
+	u.Username, u.Email, u.TimeZone, u.EmailVerified = p.Username, p.Email, p.TimeZone, p.EmailVerified
+	m.users[userID] = u
+	m.profiles[userID] = Profile{DisplayName: p.DisplayName, Locale: p.Locale}
+	return p, nil
+}
+
+func (m *memoryStore) DeleteUser(ctx context.Context, userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[userID]; !ok {
+		return ErrNotFound
+	}
+	for wsID, members := range m.wsMembers {
+		if _, ok := members[userID]; !ok {
+			continue
+		}
+		delete(members, userID)
+		if len(members) == 0 || m.workspaces[wsID].Personal {
+			delete(m.workspaces, wsID)
+			delete(m.wsMembers, wsID)
+			for id, n := range m.notebooks {
+				if n.WorkspaceID == wsID {
+					m.deleteNotebookLocked(id)
+				}
+			}
+			continue
+		}
+		// Последний администратор уходит — администратором становится самый ранний участник
+		var next *WorkspaceMember
+		for _, member := range members {
+			if member.Role == workspaceAdmin {
+				next = nil
+				break
+			}
+			if next == nil || member.CreatedAt.Before(next.CreatedAt) ||
+				member.CreatedAt.Equal(next.CreatedAt) && member.UserID < next.UserID {
+				next = &member
+			}
+		}
+		if next != nil {
+			next.Role = workspaceAdmin
+			members[next.UserID] = *next
+		}
+	}
+	for id, n := range m.notebooks {
+		if n.UserID == userID {
+			m.deleteNotebookLocked(id)
+		}
+	}
+	for notebookID, members := range m.members {
+		delete(members, userID)
+		for id, member := range members {
+			if member.InvitedBy != nil && *member.InvitedBy == userID {
+				member.InvitedBy = nil
+				m.members[notebookID][id] = member
+			}
+		}
+	}
+	for id, l := range m.labels {
+		if l.UserID == userID {
+			delete(m.labels, id)
+			for _, set := range m.taskLabels {
+				delete(set, id)
+			}
+			for _, set := range m.pageLabels {
+				delete(set, id)
+			}
+		}
+	}
+	for id, r := range m.reminders {
+		if r.UserID == userID {
+			delete(m.reminders, id)
+		}
+	}
+	for id, n := range m.notifications {
+		if n.UserID == userID {
+			delete(m.notifications, id)
+		}
+	}
+	for hash, t := range m.refreshTokens {
+		if t.UserID == userID {
+			delete(m.refreshTokens, hash)
+		}
+	}
+	for hash, t := range m.emailTokens {
+		if t.UserID == userID {
+			delete(m.emailTokens, hash)
+		}
+	}
+	for id, t := range m.accessTokens {
+		if t.UserID == userID {
+			delete(m.accessTokens, id)
+		}
+	}
+	for i, c := range m.statusHistory {
+		if c.UserID != nil && *c.UserID == userID {
+			m.statusHistory[i].UserID = nil
+		}
+	}
+	for i, e := range m.loginAudit {
+		if e.UserID != nil && *e.UserID == userID {
+			m.loginAudit[i].UserID = nil
+		}
+	}
+	delete(m.totp, userID)
+	delete(m.recoveryCodes, userID)
+	delete(m.users, userID)
+	delete(m.profiles, userID)
+	delete(m.personalWS, userID)
+	delete(m.currentWS, userID)
+	return nil
+}
+
+func (m *memoryStore) MarkEmailVerified(ctx context.Context, userID int, email string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.users[userID]
+	if !ok || u.Email != email {
+		return ErrNotFound
+	}
+	u.EmailVerified = true
+	m.users[userID] = u
+	return nil
+}
+
+func (m *memoryStore) CreateEmailToken(ctx context.Context, token EmailToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.emailTokens[token.TokenHash] = &memoryEmailToken{EmailToken: token}
+	return nil
+}
+
+func (m *memoryStore) ConsumeEmailToken(ctx context.Context, purpose, tokenHash string) (EmailToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.emailTokens[tokenHash]
+	if !ok || t.used || t.Purpose != purpose || !t.ExpiresAt.After(time.Now()) {
+		return EmailToken{}, ErrNotFound
+	}
+	for _, other := range m.emailTokens {
+		if other.UserID == t.UserID && other.Purpose == purpose {
+			other.used = true
+		}
+	}
+	return t.EmailToken, nil
+}
+
+func (m *memoryStore) GetTOTP(ctx context.Context, userID int) (TOTPSecret, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.totp[userID]
+	if !ok {
+		return TOTPSecret{}, ErrNotFound
+	}
+	return t, nil
+}
+
+func (m *memoryStore) SetTOTPSecret(ctx context.Context, userID int, secret string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.totp[userID].Confirmed {
+		return ErrDuplicateKey
+	}
+	m.totp[userID] = TOTPSecret{UserID: userID, Secret: secret}
+	return nil
+}
+
+func (m *memoryStore) setRecoveryCodesLocked(userID int, recoveryHashes []string) {
+	codes := make(map[string]bool, len(recoveryHashes))
+	for _, hash := range recoveryHashes {
+		codes[hash] = false
+	}
+	m.recoveryCodes[userID] = codes
+}
+
+func (m *memoryStore) ConfirmTOTP(ctx context.Context, userID int, recoveryHashes []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.totp[userID]
+	if !ok || t.Confirmed {
+		return ErrNotFound
+	}
+	t.Confirmed = true
+	m.totp[userID] = t
+	m.setRecoveryCodesLocked(userID, recoveryHashes)
+	return nil
+}
+
+func (m *memoryStore) UseTOTPStep(ctx context.Context, userID int, step int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.totp[userID]
+	if !ok || t.LastUsedStep >= step {
+		return ErrNotFound
+	}
+	t.LastUsedStep = step
+	m.totp[userID] = t
+	return nil
+}
+
+func (m *memoryStore) UseRecoveryCode(ctx context.Context, userID int, codeHash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	used, ok := m.recoveryCodes[userID][codeHash]
+	if !ok || used {
+		return ErrNotFound
+	}
+	m.recoveryCodes[userID][codeHash] = true
+	return nil
+}
+
+func (m *memoryStore) UseLoginChallenge(ctx context.Context, jti string, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for used, exp := range m.usedChallenges {
+		if exp.Before(now) {
+			delete(m.usedChallenges, used)
+		}
+	}
+	if _, ok := m.usedChallenges[jti]; ok {
+		return ErrNotFound
+	}
+	m.usedChallenges[jti] = expiresAt
+	return nil
+}
+
+func (m *memoryStore) ReplaceRecoveryCodes(ctx context.Context, userID int, recoveryHashes []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.setRecoveryCodesLocked(userID, recoveryHashes)
+	return nil
+}
+
+func (m *memoryStore) DeleteTOTP(ctx context.Context, userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.totp[userID]; !ok {
+		return ErrNotFound
+	}
+	delete(m.totp, userID)
+	delete(m.recoveryCodes, userID)
+	return nil
+}
+
+func (m *memoryStore) CreateAccessToken(ctx context.Context, token AccessToken) (AccessToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	token.ID = m.newID("access_tokens")
+	token.Scopes = append([]string(nil), token.Scopes...)
+	token.LastUsedAt = nil
+	token.CreatedAt = time.Now()
+	m.accessTokens[token.ID] = token
+	return token, nil
+}
+
+func (m *memoryStore) ListAccessTokens(ctx context.Context, userID int) ([]AccessToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tokens := []AccessToken{}
+	for _, t := range m.accessTokens {
+		if t.UserID == userID {
+			tokens = append(tokens, t)
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].ID > tokens[j].ID })
+	return tokens, nil
+}
+
+func (m *memoryStore) UseAccessToken(ctx context.Context, tokenHash string) (AccessToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for id, t := range m.accessTokens {
+		if t.TokenHash != tokenHash {
+			continue
+		}
+		if t.ExpiresAt != nil && !t.ExpiresAt.After(now) {
+			return AccessToken{}, ErrNotFound
+		}
+		t.LastUsedAt = &now
+		m.accessTokens[id] = t
+		return t, nil
+	}
+	return AccessToken{}, ErrNotFound
+}
+
+func (m *memoryStore) DeleteAccessToken(ctx context.Context, userID, tokenID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if t, ok := m.accessTokens[tokenID]; !ok || t.UserID != userID {
+		return ErrNotFound
+	}
+	delete(m.accessTokens, tokenID)
+	return nil
+}
+
+func (m *memoryStore) DeleteUserAccessTokens(ctx context.Context, userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, t := range m.accessTokens {
+		if t.UserID == userID {
+			delete(m.accessTokens, id)
+		}
+	}
+	return nil
+}
+
+func (m *memoryStore) AddLoginAudit(ctx context.Context, entry LoginAuditEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry.ID = int64(m.newID("login_audit"))
+	entry.CreatedAt = time.Now()
+	m.loginAudit = append(m.loginAudit, entry)
+	return nil
+}
+
+func (m *memoryStore) ListLoginAudit(ctx context.Context, userID, limit int) ([]LoginAuditEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entries := []LoginAuditEntry{}
+	for i := len(m.loginAudit) - 1; i >= 0 && len(entries) < limit; i-- {
+		if e := m.loginAudit[i]; e.UserID != nil && *e.UserID == userID {
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
+
+func (m *memoryStore) CreateRefreshToken(ctx context.Context, token RefreshToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.refreshTokens[token.TokenHash] = &memoryRefreshToken{RefreshToken: token}
+	return nil
+}
+
+func (m *memoryStore) RotateRefreshToken(ctx context.Context, oldHash string, next RefreshToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	old, ok := m.refreshTokens[oldHash]
+	if !ok || old.UserID != next.UserID || old.FamilyID != next.FamilyID || old.revoked || old.ExpiresAt.Before(time.Now()) {
+		return ErrRefreshTokenInvalid
+	}
+	if old.used {
+		for _, t := range m.refreshTokens {
+			if t.FamilyID == old.FamilyID {
+				t.revoked = true
+			}
+		}
+		return ErrRefreshTokenReused
+	}
+	old.used = true
+	m.refreshTokens[next.TokenHash] = &memoryRefreshToken{RefreshToken: next}
+	return nil
+}
+
+func (m *memoryStore) RevokeRefreshFamily(ctx context.Context, tokenHash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	token, ok := m.refreshTokens[tokenHash]
+	if !ok {
+		return nil
+	}
+	for _, t := range m.refreshTokens {
+		if t.FamilyID == token.FamilyID {
+			t.revoked = true
+		}
+	}
+	return nil
+}
+
+func (m *memoryStore) RevokeUserRefreshTokens(ctx context.Context, userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, t := range m.refreshTokens {
+		if t.UserID == userID {
+			t.revoked = true
+		}
+	}
+	return nil
+}
+
+func (m *memoryStore) ListNotebooks(ctx context.Context, userID, workspaceID int) ([]Notebook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var notebooks []Notebook
+	for _, n := range m.notebooks {
+		if n.Role = m.roleLocked(n.ID, userID); n.Role != "" && m.inWorkspaceLocked(n, workspaceID, userID) {
+			notebooks = append(notebooks, n)
+		}
+	}
+	sort.Slice(notebooks, func(i, j int) bool { return notebooks[i].ID < notebooks[j].ID })
+	return notebooks, nil
+}
+
+func (m *memoryStore) GetNotebook(ctx context.Context, notebookID int) (Notebook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n, ok := m.notebooks[notebookID]
+	if !ok {
+		return Notebook{}, ErrNotFound
+	}
+	return n, nil
+}
+
+func (m *memoryStore) CreateNotebook(ctx context.Context, notebook Notebook) (Notebook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[notebook.UserID]; !ok {
+		return Notebook{}, fmt.Errorf("Ошибка при добавлении блокнота: пользователь %d не найден", notebook.UserID)
+	}
+	if notebook.WorkspaceID == 0 {
+		notebook.WorkspaceID = m.personalWS[notebook.UserID]
+	}
+	if _, ok := m.workspaces[notebook.WorkspaceID]; !ok {
+		return Notebook{}, fmt.Errorf("Ошибка при добавлении блокнота: пространство %d не найдено", notebook.WorkspaceID)
+	}
+	now := time.Now()
+	notebook.ID = m.newID("notebooks")
+	notebook.CreatedAt, notebook.UpdatedAt = now, now
+	m.notebooks[notebook.ID] = notebook
+	return notebook, nil
+}
+
+func (m *memoryStore) UpdateNotebook(ctx context.Context, notebook Notebook) (Notebook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.notebooks[notebook.ID]
+	if !ok {
+		return Notebook{}, ErrNotFound
+	}
+	stored.Name = notebook.Name
+	stored.UpdatedAt = time.Now()
+	m.notebooks[notebook.ID] = stored
+	return stored, nil
+}
+
+func (m *memoryStore) PatchNotebook(ctx context.Context, notebookID int, patch NotebookPatch) (Notebook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.notebooks[notebookID]
+	if !ok {
+		return Notebook{}, ErrNotFound
+	}
+	patch.apply(&stored)
+	stored.UpdatedAt = time.Now()
+	m.notebooks[notebookID] = stored
+	return stored, nil
+}
+
+func (m *memoryStore) DeleteNotebook(ctx context.Context, notebookID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.deleteNotebookLocked(notebookID)
+	return nil
+}
+
+func (m *memoryStore) deleteNotebookLocked(notebookID int) {
+	delete(m.notebooks, notebookID)
+	delete(m.members, notebookID)
+	for id, p := range m.pages {
+		if p.NotebookID == notebookID {
+			m.deletePageLocked(id)
+		}
+	}
+}
+
+func (m *memoryStore) NotebookOwnerID(ctx context.Context, notebookID int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n, ok := m.notebooks[notebookID]
+	if !ok {
+		return 0, ErrNotFound
+	}
+	return n.UserID, nil
+}
+
+// Роль пользователя в блокноте; пустая, если доступа нет
+func (m *memoryStore) roleLocked(notebookID, userID int) string {
+	n, ok := m.notebooks[notebookID]
+	switch {
+	case !ok:
+		return ""
+	case n.UserID == userID:
+		return roleOwner
+	}
+	role := m.members[notebookID][userID].Role
+	if _, ok := m.wsMembers[n.WorkspaceID][userID]; ok {
+		if def := m.workspaces[n.WorkspaceID].DefaultRole; def != roleNone && roleRank[def] > roleRank[role] {
+			role = def
+		}
+	}
+	return role
+}
+
+// Показывается ли блокнот в пространстве workspaceID (см. NotebookStore)
+func (m *memoryStore) inWorkspaceLocked(n Notebook, workspaceID, userID int) bool {
+	if n.WorkspaceID == workspaceID {
+		return true
+	}
+	_, member := m.wsMembers[n.WorkspaceID][userID]
+	return workspaceID == m.personalWS[userID] && !member
+}
+
+func (m *memoryStore) accessLocked(notebookID, userID int) (Access, error) {
+	role := m.roleLocked(notebookID, userID)
+	if role == "" {
+		return Access{}, ErrNotFound
+	}
+	return Access{NotebookID: notebookID, Role: role}, nil
+}
+
+func (m *memoryStore) NotebookAccess(ctx context.Context, notebookID, userID int) (Access, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.accessLocked(notebookID, userID)
+}
+
+func (m *memoryStore) ListNotebookMembers(ctx context.Context, notebookID int) ([]NotebookMember, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n, ok := m.notebooks[notebookID]
+	if !ok {
+		return nil, nil
+	}
+	var members []NotebookMember
+	for _, member := range m.members[notebookID] {
+		member.Username = m.users[member.UserID].Username
+		members = append(members, member)
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if !members[i].CreatedAt.Equal(members[j].CreatedAt) {
+			return members[i].CreatedAt.Before(members[j].CreatedAt)
+		}
+		return members[i].UserID < members[j].UserID
+	})
+	owner := NotebookMember{NotebookID: n.ID, UserID: n.UserID, Username: m.users[n.UserID].Username, Role: roleOwner, CreatedAt: n.CreatedAt}
+	return append([]NotebookMember{owner}, members...), nil
+}
+
+func (m *memoryStore) AddNotebookMember(ctx context.Context, member NotebookMember) (NotebookMember, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[member.UserID]; !ok {
+		return NotebookMember{}, fmt.Errorf("Ошибка при добавлении участника: пользователь %d не найден", member.UserID)
+	}
+	n, ok := m.notebooks[member.NotebookID]
+	if !ok || n.UserID == member.UserID {
+		return NotebookMember{}, ErrDuplicateKey // как и в pgStore: вставка не выполняется
+	}
+	if _, ok := m.members[member.NotebookID][member.UserID]; ok {
+		return NotebookMember{}, ErrDuplicateKey
+	}
+	member.CreatedAt = time.Now()
+	member.Username = m.users[member.UserID].Username
+	if m.members[member.NotebookID] == nil {
+		m.members[member.NotebookID] = map[int]NotebookMember{}
+	}
+	m.members[member.NotebookID][member.UserID] = member
+	return member, nil
+}
+
+func (m *memoryStore) UpdateNotebookMemberRole(ctx context.Context, notebookID, userID int, role string) (NotebookMember, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	member, ok := m.members[notebookID][userID]
+	if !ok {
+		return NotebookMember{}, ErrNotFound
+	}
+	member.Role = role
+	m.members[notebookID][userID] = member
+	member.Username = m.users[userID].Username
+	return member, nil
+}
+
+func (m *memoryStore) RemoveNotebookMember(ctx context.Context, notebookID, userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.members[notebookID][userID]; !ok {
+		return ErrNotFound
+	}
+	delete(m.members[notebookID], userID)
+
+	// Напоминания и метки бывшего участника в блокноте
+	for id, r := range m.reminders {
+		if r.UserID == userID && m.pages[m.tasks[r.TaskID].PageID].NotebookID == notebookID {
+			delete(m.reminders, id)
+		}
+	}
+	unlink := func(links map[int]bool) {
+		for labelID := range links {
+			if m.labels[labelID].UserID == userID {
+				delete(links, labelID)
+			}
+		}
+	}
+	for taskID, links := range m.taskLabels {
+		if m.pages[m.tasks[taskID].PageID].NotebookID == notebookID {
+			unlink(links)
+		}
+	}
+	for pageID, links := range m.pageLabels {
+		if m.pages[pageID].NotebookID == notebookID {
+			unlink(links)
+		}
+	}
+	return nil
+}
+
+func (m *memoryStore) TransferNotebookOwnership(ctx context.Context, notebookID, fromUserID, toUserID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n, ok := m.notebooks[notebookID]
+	if !ok || n.UserID != fromUserID {
+		return ErrNotFound
+	}
+	if _, ok := m.members[notebookID][toUserID]; !ok {
+		return ErrNotFound
+	}
+	delete(m.members[notebookID], toUserID)
+	m.members[notebookID][fromUserID] = NotebookMember{NotebookID: notebookID, UserID: fromUserID, Role: roleEditor, InvitedBy: &toUserID, CreatedAt: time.Now()}
+	n.UserID = toUserID
+	n.UpdatedAt = time.Now()
+	m.notebooks[notebookID] = n
+	return nil
+}
+
+func (m *memoryStore) createWorkspaceLocked(workspace Workspace, creatorID int) Workspace {
+	now := time.Now()
+	workspace.ID = m.newID("workspaces")
+	workspace.CreatedAt, workspace.UpdatedAt = now, now
+	m.workspaces[workspace.ID] = workspace
+	m.wsMembers[workspace.ID] = map[int]WorkspaceMember{
+		creatorID: {WorkspaceID: workspace.ID, UserID: creatorID, Role: workspaceAdmin, CreatedAt: now},
+	}
+	workspace.Role = workspaceAdmin
+	return workspace
+}
+
+func (m *memoryStore) ListWorkspaces(ctx context.Context, userID int) ([]Workspace, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var workspaces []Workspace
+	for id, members := range m.wsMembers {
+		if member, ok := members[userID]; ok {
+			w := m.workspaces[id]
+			w.Role = member.Role
+			workspaces = append(workspaces, w)
+		}
+	}
+	sort.Slice(workspaces, func(i, j int) bool {
+		if workspaces[i].Personal != workspaces[j].Personal {
+			return workspaces[i].Personal
+		}
+		return workspaces[i].ID < workspaces[j].ID
+	})
+	return workspaces, nil
+}
+
+func (m *memoryStore) GetWorkspace(ctx context.Context, workspaceID int) (Workspace, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	w, ok := m.workspaces[workspaceID]
+	if !ok {
+		return Workspace{}, ErrNotFound
+	}
+	return w, nil
+}
+
+func (m *memoryStore) WorkspaceRole(ctx context.Context, workspaceID, userID int) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	member, ok := m.wsMembers[workspaceID][userID]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return member.Role, nil
+}
+
+func (m *memoryStore) CreateWorkspace(ctx context.Context, workspace Workspace, creatorID int) (Workspace, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[creatorID]; !ok {
+		return Workspace{}, fmt.Errorf("Ошибка при создании пространства: пользователь %d не найден", creatorID)
+	}
+	workspace.Personal = false
+	return m.createWorkspaceLocked(workspace, creatorID), nil
+}
+
+func (m *memoryStore) PatchWorkspace(ctx context.Context, workspaceID int, patch WorkspacePatch) (Workspace, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.workspaces[workspaceID]
+	if !ok {
+		return Workspace{}, ErrNotFound
+	}
+	patch.apply(&stored)
+	stored.UpdatedAt = time.Now()
+	m.workspaces[workspaceID] = stored
+	return stored, nil
+}
+
+func (m *memoryStore) DeleteWorkspace(ctx context.Context, workspaceID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if w, ok := m.workspaces[workspaceID]; !ok || w.Personal {
+		return ErrNotFound
+	}
+	delete(m.workspaces, workspaceID)
+	delete(m.wsMembers, workspaceID)
+	for id, n := range m.notebooks {
+		if n.WorkspaceID == workspaceID {
+			m.deleteNotebookLocked(id)
+		}
+	}
+	return nil
+}
+
+func (m *memoryStore) ListWorkspaceMembers(ctx context.Context, workspaceID int) ([]WorkspaceMember, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var members []WorkspaceMember
+	for _, member := range m.wsMembers[workspaceID] {
+		member.Username = m.users[member.UserID].Username
+		members = append(members, member)
+	}
+	sort.Slice(members, func(i, j int) bool {
+		a, b := members[i], members[j]
+		if (a.Role == workspaceAdmin) != (b.Role == workspaceAdmin) {
+			return a.Role == workspaceAdmin
+		}
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+		return a.UserID < b.UserID
+	})
+	return members, nil
+}
+
+func (m *memoryStore) AddWorkspaceMember(ctx context.Context, member WorkspaceMember) (WorkspaceMember, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[member.UserID]; !ok {
+		return WorkspaceMember{}, fmt.Errorf("Ошибка при добавлении участника пространства: пользователь %d не найден", member.UserID)
+	}
+	if _, ok := m.workspaces[member.WorkspaceID]; !ok {
+		return WorkspaceMember{}, fmt.Errorf("Ошибка при добавлении участника пространства: пространство %d не найдено", member.WorkspaceID)
+	}
+	if _, ok := m.wsMembers[member.WorkspaceID][member.UserID]; ok {
+		return WorkspaceMember{}, ErrDuplicateKey
+	}
+	member.CreatedAt = time.Now()
+	m.wsMembers[member.WorkspaceID][member.UserID] = member
+	member.Username = m.users[member.UserID].Username
+	return member, nil
+}
+
+func (m *memoryStore) UpdateWorkspaceMemberRole(ctx context.Context, workspaceID, userID int, role string) (WorkspaceMember, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	member, ok := m.wsMembers[workspaceID][userID]
+	if !ok {
+		return WorkspaceMember{}, ErrNotFound
+	}
+	member.Role = role
+	m.wsMembers[workspaceID][userID] = member
+	member.Username = m.users[userID].Username
+	return member, nil
+}
+
+func (m *memoryStore) RemoveWorkspaceMember(ctx context.Context, workspaceID, userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.wsMembers[workspaceID][userID]; !ok {
+		return ErrNotFound
+	}
+	delete(m.wsMembers[workspaceID], userID)
+	return nil
+}
+
+func (m *memoryStore) CurrentWorkspace(ctx context.Context, userID int) (Workspace, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := m.currentWS[userID]
+	member, ok := m.wsMembers[id][userID]
+	if !ok {
+		id = m.personalWS[userID]
+		if member, ok = m.wsMembers[id][userID]; !ok {
+			return Workspace{}, ErrNotFound
+		}
+	}
+	w := m.workspaces[id]
+	w.Role = member.Role
+	return w, nil
+}
+
+func (m *memoryStore) SetCurrentWorkspace(ctx context.Context, userID, workspaceID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.wsMembers[workspaceID][userID]; !ok {
+		return ErrNotFound
+	}
+	m.currentWS[userID] = workspaceID
+	return nil
+}
+
+func (m *memoryStore) ListPages(ctx context.Context, notebookID int) ([]Page, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var pages []Page
+	for _, p := range m.pages {
+		if p.NotebookID == notebookID {
+			pages = append(pages, p)
+		}
+	}
+	sort.Slice(pages, func(i, j int) bool { return pages[i].ID < pages[j].ID })
+	return pages, nil
+}
+
+func (m *memoryStore) GetPage(ctx context.Context, pageID int) (Page, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p, ok := m.pages[pageID]
+	if !ok {
+		return Page{}, ErrNotFound
+	}
+	return p, nil
+}
+
+func (m *memoryStore) CreatePage(ctx context.Context, page Page) (Page, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.notebooks[page.NotebookID]; !ok {
+		return Page{}, fmt.Errorf("Ошибка при добавлении страницы: блокнот %d не найден", page.NotebookID)
+	}
+	now := time.Now()
+	page.ID = m.newID("pages")
+	page.CreatedAt, page.UpdatedAt = now, now
+	m.pages[page.ID] = page
+	return page, nil
+}
+
+func (m *memoryStore) UpdatePage(ctx context.Context, page Page) (Page, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.pages[page.ID]
+	if !ok {
+		return Page{}, ErrNotFound
+	}
+	stored.Title = page.Title
+	stored.Content = page.Content
+	stored.UpdatedAt = time.Now()
+	m.pages[page.ID] = stored
+	return stored, nil
+}
+
+func (m *memoryStore) PatchPage(ctx context.Context, pageID int, patch PagePatch) (Page, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.pages[pageID]
+	if !ok {
+		return Page{}, ErrNotFound
+	}
+	patch.apply(&stored)
+	stored.UpdatedAt = time.Now()
+	m.pages[pageID] = stored
+	return stored, nil
+}
+
+func (m *memoryStore) DeletePage(ctx context.Context, pageID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.deletePageLocked(pageID)
+	return nil
+}
+
+// Удаление страницы вместе с задачами (ON DELETE CASCADE)
+func (m *memoryStore) deletePageLocked(pageID int) {
+	delete(m.pages, pageID)
+	delete(m.pageLabels, pageID)
+	for id, t := range m.tasks {
+		if t.PageID == pageID {
+			m.deleteTaskLocked(id)
+		}
+	}
+}
+
+// Удаление задачи вместе с подзадачами, чек-листом и напоминаниями (ON DELETE CASCADE);
+// у уведомлений ссылка на задачу обнуляется (ON DELETE SET NULL)
+func (m *memoryStore) deleteTaskLocked(taskID int) {
+	for _, id := range m.subtreeLocked(taskID) {
+		m.deleteTaskLocked(id)
+	}
+	delete(m.tasks, taskID)
+	delete(m.taskLabels, taskID)
+	for id, item := range m.checklistItems {
+		if item.TaskID == taskID {
+			delete(m.checklistItems, id)
+		}
+	}
+	for id, r := range m.reminders {
+		if r.TaskID == taskID {
+			delete(m.reminders, id)
+		}
+	}
+	for id, n := range m.notifications {
+		if n.TaskID != nil && *n.TaskID == taskID {
+			n.TaskID = nil
+			m.notifications[id] = n
+		}
+	}
+}
+
+func (m *memoryStore) PageOwnerID(ctx context.Context, pageID int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p, ok := m.pages[pageID]
+	if !ok {
+		return 0, ErrNotFound
+	}
+	return m.notebooks[p.NotebookID].UserID, nil
+}
+
+func (m *memoryStore) PageAccess(ctx context.Context, pageID, userID int) (Access, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p, ok := m.pages[pageID]
+	if !ok {
+		return Access{}, ErrNotFound
+	}
+	return m.accessLocked(p.NotebookID, userID)
+}
+
+func (m *memoryStore) ListTasks(ctx context.Context, pageID int) ([]Task, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var tasks []Task
+	for _, t := range m.tasks {
+		if t.PageID == pageID {
+			tasks = append(tasks, t)
+		}
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].ID < tasks[j].ID })
+	return tasks, nil
+}
+
+func (m *memoryStore) GetTask(ctx context.Context, taskID int) (Task, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.tasks[taskID]
+	if !ok {
+		return Task{}, ErrNotFound
+	}
+	return t, nil
+}
+
+func (m *memoryStore) ListUserTasks(ctx context.Context, filter TaskFilter) ([]Task, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tasks := []Task{}
+	for _, t := range m.tasks {
+		notebook := m.notebooks[m.pages[t.PageID].NotebookID]
+		if m.roleLocked(notebook.ID, filter.UserID) == "" || (filter.NotebookID != 0 && notebook.ID != filter.NotebookID) {
+			continue
+		}
+		if filter.WorkspaceID != 0 && !m.inWorkspaceLocked(notebook, filter.WorkspaceID, filter.UserID) {
+			continue
+		}
+		if !filter.matches(t) || !filter.Labels.matches(m.taskLabels[t.ID]) {
+			continue
+		}
+		if filter.After != nil && compareTaskToKeys(t, filter.Sort, filter.After) <= 0 {
+			continue
+		}
+		tasks = append(tasks, t)
+	}
+	sort.Slice(tasks, func(i, j int) bool {
+		return compareTaskToKeys(tasks[i], filter.Sort, taskKeyValues(tasks[j], filter.Sort)) < 0
+	})
+	if len(tasks) > filter.Limit {
+		tasks = tasks[:filter.Limit]
+	}
+	return tasks, nil
+}
+
+func (m *memoryStore) CreateTask(ctx context.Context, task Task, createdBy int) (Task, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.pages[task.PageID]; !ok {
+		return Task{}, fmt.Errorf("Ошибка при добавлении задачи: страница %d не найдена", task.PageID)
+	}
+	now := time.Now()
+	task.ID = m.newID("tasks")
+	task.CreatedAt, task.UpdatedAt = now, now
+	m.tasks[task.ID] = task
+	m.addStatusChangeLocked(task.ID, createdBy, nil, task.Status)
+	return task, nil
+}
+
+func (m *memoryStore) addStatusChangeLocked(taskID, userID int, from *string, to string) {
+	m.statusHistory = append(m.statusHistory, TaskStatusChange{
+		ID:         int64(m.newID("task_status_history")),
+		TaskID:     taskID,
+		UserID:     &userID,
+		FromStatus: from,
+		ToStatus:   to,
+		ChangedAt:  time.Now(),
+	})
+}
+
+func (m *memoryStore) UpdateTask(ctx context.Context, task Task) (Task, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.tasks[task.ID]
+	if !ok {
+		return Task{}, ErrNotFound
+	}
+	stored.Title = task.Title
+	stored.Description = task.Description
+	stored.UpdatedAt = time.Now()
+	m.tasks[task.ID] = stored
+	return stored, nil
+}
+
+func (m *memoryStore) PatchTask(ctx context.Context, taskID int, patch TaskPatch) (Task, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.tasks[taskID]
+	if !ok {
+		return Task{}, ErrNotFound
+	}
+	from := stored.Status
+	statusChanged := patch.Status.Set && patch.Status.Value != from
+	if statusChanged && from != patch.FromStatus {
+		return Task{}, ErrStatusConflict
+	}
+	patch.apply(&stored)
+	if statusChanged && patch.Next != nil {
+		stored.Recurrence = ""
+	}
+	stored.UpdatedAt = time.Now()
+	m.tasks[taskID] = stored
+	if patch.DueDate.Set || patch.DueAllDay.Set {
+		m.refreshReminderFireAtLocked(taskID)
+	}
+	if statusChanged {
+		m.addStatusChangeLocked(taskID, patch.ChangedBy, &from, stored.Status)
+	}
+	if patch.Cascade && patch.Status.Set {
+		for _, id := range m.subtreeLocked(taskID) {
+			t := m.tasks[id]
+			if t.Status == patch.Status.Value || containsString(patch.CascadeSkip, t.Status) {
+				continue
+			}
+			old := t.Status
+			t.Status = patch.Status.Value
+			t.UpdatedAt = stored.UpdatedAt
+			m.tasks[id] = t
+			m.addStatusChangeLocked(id, patch.ChangedBy, &old, t.Status)
+		}
+	}
+	if statusChanged && patch.Next != nil {
+		next := *patch.Next
+		next.ID = m.newID("tasks")
+		next.CreatedAt, next.UpdatedAt = stored.UpdatedAt, stored.UpdatedAt
+		m.tasks[next.ID] = next
+		m.addStatusChangeLocked(next.ID, patch.ChangedBy, nil, next.Status)
+		if labels := m.taskLabels[taskID]; len(labels) > 0 {
+			m.taskLabels[next.ID] = map[int]bool{}
+			for id := range labels {
+				m.taskLabels[next.ID][id] = true
+			}
+		}
+		// Напоминания относительно срока переходят к следующему повторению
+		for _, r := range m.remindersLocked(taskID) {
+			if r.MinutesBefore != nil {
+				m.insertReminderLocked(Reminder{TaskID: next.ID, UserID: r.UserID, MinutesBefore: r.MinutesBefore, Channel: r.Channel, WebhookURL: r.WebhookURL})
+			}
+		}
+	}
+	return stored, nil
+}
+
+// ID всех потомков задачи
+func (m *memoryStore) subtreeLocked(taskID int) []int {
+	var ids []int
+	for id, t := range m.tasks {
+		if t.ParentID != nil && *t.ParentID == taskID {
+			ids = append(ids, id)
+			ids = append(ids, m.subtreeLocked(id)...)
+		}
+	}
+	return ids
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *memoryStore) ListDueTasks(ctx context.Context, from, to time.Time) ([]Task, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var tasks []Task
+	for _, t := range m.tasks {
+		if t.DueDate != nil && !t.DueDate.Before(from) && t.DueDate.Before(to) && !taskWorkflow.Closed(t.Status) {
+			tasks = append(tasks, t)
+		}
+	}
+	sort.Slice(tasks, func(i, j int) bool {
+		if !tasks[i].DueDate.Equal(*tasks[j].DueDate) {
+			return tasks[i].DueDate.Before(*tasks[j].DueDate)
+		}
+		return tasks[i].ID < tasks[j].ID
+	})
+	return tasks, nil
+}
+
+func (m *memoryStore) DeleteTask(ctx context.Context, taskID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.deleteTaskLocked(taskID)
+	return nil
+}
+
+func (m *memoryStore) TaskOwnerID(ctx context.Context, taskID int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.tasks[taskID]
+	if !ok {
+		return 0, ErrNotFound
+	}
+	return m.notebooks[m.pages[t.PageID].NotebookID].UserID, nil
+}
+
+func (m *memoryStore) TaskAccess(ctx context.Context, taskID, userID int) (Access, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.tasks[taskID]
+	if !ok {
+		return Access{}, ErrNotFound
+	}
+	return m.accessLocked(m.pages[t.PageID].NotebookID, userID)
+}
+
+func (m *memoryStore) TaskStatusHistory(ctx context.Context, taskID int) ([]TaskStatusChange, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var history []TaskStatusChange
+	for _, c := range m.statusHistory {
+		if c.TaskID == taskID {
+			history = append(history, c)
+		}
+	}
+	return history, nil
+}
+
+func (m *memoryStore) ListChecklistItems(ctx context.Context, taskIDs []int) ([]ChecklistItem, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var items []ChecklistItem
+	for _, item := range m.checklistItems {
+		for _, id := range taskIDs {
+			if item.TaskID == id {
+				items = append(items, item)
+			}
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		a, b := items[i], items[j]
+		if a.TaskID != b.TaskID {
+			return a.TaskID < b.TaskID
+		}
+		if a.Position != b.Position {
+			return a.Position < b.Position
+		}
+		return a.ID < b.ID
+	})
+	return items, nil
+}
+
+func (m *memoryStore) CreateChecklistItem(ctx context.Context, item ChecklistItem) (ChecklistItem, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.tasks[item.TaskID]; !ok {
+		return ChecklistItem{}, fmt.Errorf("Ошибка при добавлении пункта чек-листа: задача %d не найдена", item.TaskID)
+	}
+	item.Position = 0
+	for _, other := range m.checklistItems {
+		if other.TaskID == item.TaskID && other.Position >= item.Position {
+			item.Position = other.Position + 1
+		}
+	}
+	now := time.Now()
+	item.ID = m.newID("task_checklist_items")
+	item.CreatedAt, item.UpdatedAt = now, now
+	m.checklistItems[item.ID] = item
+	return item, nil
+}
+
+func (m *memoryStore) PatchChecklistItem(ctx context.Context, taskID, itemID int, patch ChecklistItemPatch) (ChecklistItem, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	item, ok := m.checklistItems[itemID]
+	if !ok || item.TaskID != taskID {
+		return ChecklistItem{}, ErrNotFound
+	}
+	patch.apply(&item)
+	item.UpdatedAt = time.Now()
+	m.checklistItems[itemID] = item
+	return item, nil
+}
+
+func (m *memoryStore) DeleteChecklistItem(ctx context.Context, taskID, itemID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	item, ok := m.checklistItems[itemID]
+	if !ok || item.TaskID != taskID {
+		return ErrNotFound
+	}
+	delete(m.checklistItems, itemID)
+	return nil
+}
+
+func (m *memoryStore) ListPagesByLabels(ctx context.Context, notebookID int, labels LabelFilter) ([]Page, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	pages := []Page{}
+	for _, p := range m.pages {
+		if p.NotebookID == notebookID && labels.matches(m.pageLabels[p.ID]) {
+			pages = append(pages, p)
+		}
+	}
+	sort.Slice(pages, func(i, j int) bool { return pages[i].ID < pages[j].ID })
+	return pages, nil
+}
+
+func (m *memoryStore) ListLabels(ctx context.Context, userID int) ([]Label, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	labels := []Label{}
+	for _, l := range m.labels {
+		if l.UserID == userID {
+			labels = append(labels, l)
+		}
+	}
+	sortLabels(labels)
+	return labels, nil
+}
+
+func sortLabels(labels []Label) {
+	sort.Slice(labels, func(i, j int) bool {
+		if labels[i].Name != labels[j].Name {
+			return labels[i].Name < labels[j].Name
+		}
+		return labels[i].ID < labels[j].ID
+	})
+}
+
+// Имя уже занято другой меткой пользователя (UNIQUE (user_id, name))
+func (m *memoryStore) labelNameTakenLocked(label Label) bool {
+	for _, l := range m.labels {
+		if l.ID != label.ID && l.UserID == label.UserID && l.Name == label.Name {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *memoryStore) CreateLabel(ctx context.Context, label Label) (Label, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[label.UserID]; !ok {
+		return Label{}, fmt.Errorf("Ошибка при добавлении метки: пользователь %d не найден", label.UserID)
+	}
+	if m.labelNameTakenLocked(label) {
+		return Label{}, fmt.Errorf("label name already exists: %w", ErrDuplicateKey)
+	}
+	now := time.Now()
+	label.ID = m.newID("labels")
+	label.CreatedAt, label.UpdatedAt = now, now
+	m.labels[label.ID] = label
+	return label, nil
+}
+
+func (m *memoryStore) PatchLabel(ctx context.Context, labelID int, patch LabelPatch) (Label, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.labels[labelID]
+	if !ok {
+		return Label{}, ErrNotFound
+	}
+	patch.apply(&stored)
+	if m.labelNameTakenLocked(stored) {
+		return Label{}, fmt.Errorf("label name already exists: %w", ErrDuplicateKey)
+	}
+	stored.UpdatedAt = time.Now()
+	m.labels[labelID] = stored
+	return stored, nil
+}
+
+func (m *memoryStore) DeleteLabel(ctx context.Context, labelID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.labels, labelID)
+	for _, set := range m.taskLabels {
+		delete(set, labelID)
+	}
+	for _, set := range m.pageLabels {
+		delete(set, labelID)
+	}
+	return nil
+}
+
+func (m *memoryStore) LabelOwnerID(ctx context.Context, labelID int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	l, ok := m.labels[labelID]
+	if !ok {
+		return 0, ErrNotFound
+	}
+	return l.UserID, nil
+}
+
+func (m *memoryStore) TaskLabels(ctx context.Context, userID, taskID int) ([]Label, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.linkedLabelsLocked(userID, m.taskLabels[taskID]), nil
+}
+
+func (m *memoryStore) SetTaskLabels(ctx context.Context, userID, taskID int, labelIDs []int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.tasks[taskID]; !ok {
+		return fmt.Errorf("Ошибка при добавлении меток: задача %d не найдена", taskID)
+	}
+	return m.setLabelLinksLocked(m.taskLabels, userID, taskID, labelIDs)
+}
+
+func (m *memoryStore) PageLabels(ctx context.Context, userID, pageID int) ([]Label, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.linkedLabelsLocked(userID, m.pageLabels[pageID]), nil
+}
+
+func (m *memoryStore) SetPageLabels(ctx context.Context, userID, pageID int, labelIDs []int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.pages[pageID]; !ok {
+		return fmt.Errorf("Ошибка при добавлении меток: страница %d не найдена", pageID)
+	}
+	return m.setLabelLinksLocked(m.pageLabels, userID, pageID, labelIDs)
+}
+
+func (m *memoryStore) linkedLabelsLocked(userID int, set map[int]bool) []Label {
+	labels := []Label{}
+	for id := range set {
+		if m.labels[id].UserID == userID {
+			labels = append(labels, m.labels[id])
+		}
+	}
+	sortLabels(labels)
+	return labels
+}
+
+// Замена меток пользователя; метки других участников блокнота остаются
+func (m *memoryStore) setLabelLinksLocked(links map[int]map[int]bool, userID, id int, labelIDs []int) error {
+	set := map[int]bool{}
+	for labelID := range links[id] {
+		if m.labels[labelID].UserID != userID {
+			set[labelID] = true
+		}
+	}
+	for _, labelID := range labelIDs {
+		if _, ok := m.labels[labelID]; !ok {
+			return fmt.Errorf("Ошибка при добавлении меток: метка %d не найдена", labelID)
+		}
+		set[labelID] = true
+	}
+	links[id] = set
+	return nil
+}
+
+func (m *memoryStore) ListReminders(ctx context.Context, taskID, userID int) ([]Reminder, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var reminders []Reminder
+	for _, r := range m.remindersLocked(taskID) {
+		if r.UserID == userID {
+			reminders = append(reminders, r)
+		}
+	}
+	return reminders, nil
+}
+
+func (m *memoryStore) remindersLocked(taskID int) []Reminder {
+	var reminders []Reminder
+	for _, r := range m.reminders {
+		if r.TaskID == taskID {
+			reminders = append(reminders, r)
+		}
+	}
+	sort.Slice(reminders, func(i, j int) bool { return reminders[i].ID < reminders[j].ID })
+	return reminders
+}
+
+func (m *memoryStore) CreateReminder(ctx context.Context, reminder Reminder) (Reminder, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.tasks[reminder.TaskID]; !ok {
+		return Reminder{}, fmt.Errorf("Ошибка при добавлении напоминания: задача %d не найдена", reminder.TaskID)
+	}
+	return m.insertReminderLocked(reminder), nil
+}
+
+func (m *memoryStore) insertReminderLocked(r Reminder) Reminder {
+	now := time.Now()
+	r.ID = m.newID("reminders")
+	r.Status, r.Attempts, r.LastError, r.SentAt = reminderPending, 0, "", nil
+	r.NextAttemptAt, r.CreatedAt = now, now
+	r.FireAt = r.RemindAt
+	m.reminders[r.ID] = r
+	m.refreshReminderFireAtLocked(r.TaskID)
+	return m.reminders[r.ID]
+}
+
+// Пересчёт fire_at относительных напоминаний задачи после смены срока;
+// изменившиеся напоминания снова ждут отправки
+func (m *memoryStore) refreshReminderFireAtLocked(taskID int) {
+	task := m.tasks[taskID]
+	for id, r := range m.reminders {
+		if r.TaskID != taskID || r.MinutesBefore == nil {
+			continue
+		}
+		fireAt := relativeFireAt(task, *r.MinutesBefore, userLocation(m.users[r.UserID].TimeZone))
+		if sameTime(fireAt, r.FireAt) {
+			continue
+		}
+		r.FireAt = fireAt
+		r.Status, r.Attempts, r.LastError, r.SentAt = reminderPending, 0, "", nil
+		r.NextAttemptAt = time.Now()
+		m.reminders[id] = r
+	}
+}
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+func (m *memoryStore) DeleteReminder(ctx context.Context, taskID, userID, reminderID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	r, ok := m.reminders[reminderID]
+	if !ok || r.TaskID != taskID || r.UserID != userID {
+		return ErrNotFound
+	}
+	delete(m.reminders, reminderID)
+	return nil
+}
+
+func (m *memoryStore) ClaimDueReminders(ctx context.Context, now time.Time, limit int, lease time.Duration) ([]Reminder, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var due []Reminder
+	for _, r := range m.reminders {
+		if r.Status == reminderPending && r.FireAt != nil && !r.FireAt.After(now) && !r.NextAttemptAt.After(now) {
+			due = append(due, r)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		if !due[i].FireAt.Equal(*due[j].FireAt) {
+			return due[i].FireAt.Before(*due[j].FireAt)
+		}
+		return due[i].ID < due[j].ID
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	for i := range due {
+		due[i].Attempts++
+		due[i].NextAttemptAt = now.Add(lease)
+		m.reminders[due[i].ID] = due[i]
+	}
+	return due, nil
+}
+
+func (m *memoryStore) RecordReminderAttempt(ctx context.Context, reminder Reminder) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.reminders[reminder.ID]
+	if !ok || !sameTime(stored.FireAt, reminder.FireAt) {
+		return nil
+	}
+	stored.Status, stored.LastError, stored.SentAt = reminder.Status, reminder.LastError, reminder.SentAt
+	stored.NextAttemptAt = reminder.NextAttemptAt
+	m.reminders[reminder.ID] = stored
+	return nil
+}
+
+func (m *memoryStore) CreateNotification(ctx context.Context, n Notification) (Notification, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if n.DedupeKey != "" {
+		for _, other := range m.notifications {
+			if other.UserID == n.UserID && other.DedupeKey == n.DedupeKey {
+				return Notification{}, fmt.Errorf("notification %q already exists: %w", n.DedupeKey, ErrDuplicateKey)
+			}
+		}
+	}
+	n.ID = m.newID("notifications")
+	n.CreatedAt, n.ReadAt = time.Now(), nil
+	m.notifications[n.ID] = n
+	return n, nil
+}
+
+func (m *memoryStore) ListNotifications(ctx context.Context, filter NotificationFilter) ([]Notification, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var notifications []Notification
+	for _, n := range m.notifications {
+		if n.UserID != filter.UserID || (filter.UnreadOnly && n.ReadAt != nil) || (filter.BeforeID != 0 && n.ID >= filter.BeforeID) {
+			continue
+		}
+		notifications = append(notifications, n)
+	}
+	sort.Slice(notifications, func(i, j int) bool { return notifications[i].ID > notifications[j].ID })
+	if len(notifications) > filter.Limit {
+		notifications = notifications[:filter.Limit]
+	}
+	return notifications, nil
+}
+
+func (m *memoryStore) UnreadNotificationCount(ctx context.Context, userID int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	count := 0
+	for _, n := range m.notifications {
+		if n.UserID == userID && n.ReadAt == nil {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *memoryStore) MarkNotificationRead(ctx context.Context, userID, notificationID int) (Notification, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n, ok := m.notifications[notificationID]
+	if !ok || n.UserID != userID {
+		return Notification{}, ErrNotFound
+	}
+	if n.ReadAt == nil {
+		now := time.Now()
+		n.ReadAt = &now
+		m.notifications[notificationID] = n
+	}
+	return n, nil
+}
+
+func (m *memoryStore) MarkAllNotificationsRead(ctx context.Context, userID int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	marked := 0
+	for id, n := range m.notifications {
+		if n.UserID == userID && n.ReadAt == nil {
+			n.ReadAt = &now
+			m.notifications[id] = n
+			marked++
+		}
+	}
+	return marked, nil
+}
+
+func (m *memoryStore) Search(ctx context.Context, userID, workspaceID int, query string, limit int) ([]SearchResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	visible := func(n Notebook) bool {
+		return m.roleLocked(n.ID, userID) != "" && (workspaceID == 0 || m.inWorkspaceLocked(n, workspaceID, userID))
+	}
+	terms := searchTerms(query)
+	results := []SearchResult{}
+	add := func(r SearchResult, text string) {
+		if rank, snippet, ok := matchTerms(text, terms); ok {
+			r.Rank, r.Snippet = rank, snippet
+			results = append(results, r)
+		}
+	}
+	for _, n := range m.notebooks {
+		if visible(n) {
+			add(SearchResult{Type: "notebook", ID: n.ID, Title: n.Name, NotebookID: n.ID, NotebookName: n.Name}, n.Name)
+		}
+	}
+	for _, p := range m.pages {
+		n := m.notebooks[p.NotebookID]
+		if visible(n) {
+			add(SearchResult{Type: "page", ID: p.ID, Title: p.Title, NotebookID: n.ID, NotebookName: n.Name}, p.Title+"\n"+p.Content)
+		}
+	}
+	for _, t := range m.tasks {
+		p := m.pages[t.PageID]
+		n := m.notebooks[p.NotebookID]
+		if visible(n) {
+			pageID := p.ID
+			add(SearchResult{Type: "task", ID: t.ID, Title: t.Title, NotebookID: n.ID, NotebookName: n.Name, PageID: &pageID, PageTitle: p.Title}, t.Title+"\n"+t.Description)
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Rank != results[j].Rank {
+			return results[i].Rank > results[j].Rank
+		}
+		if results[i].Type != results[j].Type {
+			return results[i].Type < results[j].Type
+		}
+		return results[i].ID < results[j].ID
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
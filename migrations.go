@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// SQL-миграции встроены в бинарник: migrations/NNNN_name.up.sql и NNNN_name.down.sql
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Ключ advisory lock, чтобы два экземпляра не мигрировали базу одновременно
+const migrationLockKey = 7_451_302_118
+
+type migration struct {
+	Version  int
+	Name     string
+	Up       string
+	Down     string
+	Checksum string // SHA-256 up-скрипта
+}
+
+// Запись о применённой миграции
+type appliedMigration struct {
+	Version   int
+	Name      string
+	Checksum  string
+	AppliedAt time.Time
+}
+
+// Чтение встроенных миграций, отсортированных по версии
+func loadMigrations(fsys fs.FS) ([]migration, error) {
+	entries, err := fs.ReadDir(fsys, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения миграций: %v", err)
+	}
+
+	byVersion := map[int]*migration{}
+	for _, entry := range entries {
+		fileName := entry.Name()
+		var direction string
+		switch {
+		case strings.HasSuffix(fileName, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(fileName, ".down.sql"):
+			direction = "down"
+		default:
+			return nil, fmt.Errorf("миграция %s: ожидается суффикс .up.sql или .down.sql", fileName)
+		}
+
+		base := strings.TrimSuffix(fileName, "."+direction+".sql")
+		versionStr, name, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("миграция %s: ожидается имя вида 0001_name", fileName)
+		}
+		version, err := strconv.Atoi(versionStr)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("миграция %s: некорректная версия", fileName)
+		}
+
+		data, err := fs.ReadFile(fsys, path.Join("migrations", fileName))
+		if err != nil {
+			return nil, fmt.Errorf("ошибка чтения миграции %s: %v", fileName, err)
+		}
+
+		m := byVersion[version]
+		if m == nil {
+			m = &migration{Version: version, Name: name}
+			byVersion[version] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf("версия %d используется миграциями %s и %s", version, m.Name, name)
+		}
+		if direction == "up" {
+			m.Up = string(data)
+			sum := sha256.Sum256(data)
+			m.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			m.Down = string(data)
+		}
+	}
+
+	migrations := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("миграция %04d_%s: нужны оба файла, up и down", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("пропущена миграция с версией %d", i+1)
+		}
+	}
+	return migrations, nil
+}
+
+// Выполнение fn на отдельном соединении под advisory lock
+func withMigrationLock(ctx context.Context, pool *pgxpool.Pool, fn func(conn *pgx.Conn) error) error {
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("ошибка получения соединения: %v", err)
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1)", migrationLockKey); err != nil {
+		return fmt.Errorf("ошибка получения блокировки миграций: %v", err)
+	}
+	defer conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockKey)
+
+	_, err = conn.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		name       TEXT        NOT NULL,
+		checksum   TEXT        NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`)
+	if err != nil {
+		return fmt.Errorf("ошибка создания таблицы schema_migrations: %v", err)
+	}
+
+	return fn(conn.Conn())
+}
+
+func getAppliedMigrations(ctx context.Context, conn *pgx.Conn) ([]appliedMigration, error) {
+	rows, err := conn.Query(ctx, "SELECT version, name, checksum, applied_at FROM schema_migrations ORDER BY version")
+	if err != nil {
+		return nil, fmt.Errorf("Ошибка при получении применённых миграций: %v", err)
+	}
+	defer rows.Close()
+
+	var applied []appliedMigration
+	for rows.Next() {
+		var a appliedMigration
+		if err := rows.Scan(&a.Version, &a.Name, &a.Checksum, &a.AppliedAt); err != nil {
+			return nil, fmt.Errorf("Ошибка при сканировании миграции: %v", err)
+		}
+		applied = append(applied, a)
+	}
+	return applied, rows.Err()
+}
+
+// Применённые миграции должны совпадать со встроенными — иначе скрипт изменили задним числом
+func verifyMigrations(migrations []migration, applied []appliedMigration) error {
+	for i, a := range applied {
+		if a.Version != i+1 {
+			return fmt.Errorf("в базе пропущена миграция %d", i+1)
+		}
+		if a.Version > len(migrations) {
+			return fmt.Errorf("в базе применена миграция %d, неизвестная этой версии приложения", a.Version)
+		}
+		m := migrations[a.Version-1]
+		if m.Checksum != a.Checksum {
+			return fmt.Errorf("контрольная сумма миграции %04d_%s не совпадает с применённой", m.Version, m.Name)
+		}
+	}
+	return nil
+}
+
+// Применение всех ещё не применённых миграций
+func migrateUp(ctx context.Context, pool *pgxpool.Pool) (int, error) {
+	migrations, err := loadMigrations(migrationFiles)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	err = withMigrationLock(ctx, pool, func(conn *pgx.Conn) error {
+		applied, err := getAppliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if err := verifyMigrations(migrations, applied); err != nil {
+			return err
+		}
+
+		for _, m := range migrations[len(applied):] {
+			err := pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+				if _, err := tx.Exec(ctx, m.Up); err != nil {
+					return err
+				}
+				_, err := tx.Exec(ctx, "INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3)", m.Version, m.Name, m.Checksum)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("ошибка применения миграции %04d_%s: %v", m.Version, m.Name, err)
+			}
+			log.Printf("Applied migration %04d_%s", m.Version, m.Name)
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// Откат последних steps миграций
+func migrateDown(ctx context.Context, pool *pgxpool.Pool, steps int) (int, error) {
+	migrations, err := loadMigrations(migrationFiles)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	err = withMigrationLock(ctx, pool, func(conn *pgx.Conn) error {
+		applied, err := getAppliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if err := verifyMigrations(migrations, applied); err != nil {
+			return err
+		}
+
+		for i := len(applied) - 1; i >= 0 && count < steps; i-- {
+			m := migrations[applied[i].Version-1]
+			err := pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+				if _, err := tx.Exec(ctx, m.Down); err != nil {
+					return err
+				}
+				_, err := tx.Exec(ctx, "DELETE FROM schema_migrations WHERE version = $1", m.Version)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("ошибка отката миграции %04d_%s: %v", m.Version, m.Name, err)
+			}
+			log.Printf("Rolled back migration %04d_%s", m.Version, m.Name)
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// Состояние миграций в виде текста для команды migrate status
+func migrationStatus(ctx context.Context, pool *pgxpool.Pool) (string, error) {
+	migrations, err := loadMigrations(migrationFiles)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	err = withMigrationLock(ctx, pool, func(conn *pgx.Conn) error {
+		applied, err := getAppliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+		checkErr := verifyMigrations(migrations, applied)
+
+		for _, m := range migrations {
+			state := "pending"
+			if m.Version <= len(applied) {
+				state = "applied " + applied[m.Version-1].AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(&b, "%04d_%-30s %s\n", m.Version, m.Name, state)
+		}
+		if checkErr != nil {
+			fmt.Fprintf(&b, "ERROR: %v\n", checkErr)
+		}
+		return nil
+	})
+	return b.String(), err
+}
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS tasks;
+DROP TABLE IF EXISTS pages;
+DROP TABLE IF EXISTS notebooks;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,47 @@
+-- Базовая схема: пользователи → блокноты → страницы → задачи.
+-- IF NOT EXISTS позволяет подключить миграции к базе, созданной до их появления.
+
+CREATE TABLE IF NOT EXISTS users (
+    id         SERIAL PRIMARY KEY,
+    email      TEXT        NOT NULL,
+    username   TEXT        NOT NULL,
+    password   TEXT        NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CONSTRAINT users_email_key UNIQUE (email),
+    CONSTRAINT users_username_key UNIQUE (username)
+);
+
+CREATE TABLE IF NOT EXISTS notebooks (
+    id         SERIAL PRIMARY KEY,
+    user_id    INTEGER     NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name       TEXT        NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS notebooks_user_id_idx ON notebooks (user_id);
+
+CREATE TABLE IF NOT EXISTS pages (
+    id          SERIAL PRIMARY KEY,
+    notebook_id INTEGER     NOT NULL REFERENCES notebooks (id) ON DELETE CASCADE,
+    title       TEXT        NOT NULL DEFAULT '',
+    content     TEXT        NOT NULL DEFAULT '',
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS pages_notebook_id_idx ON pages (notebook_id);
+
+CREATE TABLE IF NOT EXISTS tasks (
+    id          SERIAL PRIMARY KEY,
+    page_id     INTEGER     NOT NULL REFERENCES pages (id) ON DELETE CASCADE,
+    title       TEXT        NOT NULL DEFAULT '',
+    description TEXT        NOT NULL DEFAULT '',
+    status      TEXT        NOT NULL DEFAULT '',
+    priority    INTEGER     NOT NULL DEFAULT 0,
+    due_date    TIMESTAMPTZ NOT NULL DEFAULT now(),
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS tasks_page_id_idx ON tasks (page_id);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS task_status_history;
+ALTER TABLE tasks ALTER COLUMN status SET DEFAULT '';
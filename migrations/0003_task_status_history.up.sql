@@ -0,0 +1,16 @@
+-- Рабочий процесс статусов задач: история смен статуса.
+-- Задачи, созданные до появления рабочего процесса, получают начальный статус todo.
+
+UPDATE tasks SET status = 'todo' WHERE status = '';
+ALTER TABLE tasks ALTER COLUMN status SET DEFAULT 'todo';
+
+CREATE TABLE IF NOT EXISTS task_status_history (
+    id          BIGSERIAL PRIMARY KEY,
+    task_id     INTEGER     NOT NULL REFERENCES tasks (id) ON DELETE CASCADE,
+    user_id     INTEGER     REFERENCES users (id) ON DELETE SET NULL,
+    from_status TEXT, -- NULL для записи о создании задачи
+    to_status   TEXT        NOT NULL,
+    changed_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS task_status_history_task_id_idx ON task_status_history (task_id, changed_at);
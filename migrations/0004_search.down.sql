@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS tasks_search_idx;
+DROP INDEX IF EXISTS pages_search_idx;
+DROP INDEX IF EXISTS notebooks_search_idx;
+ALTER TABLE tasks DROP COLUMN IF EXISTS search_vector;
+ALTER TABLE pages DROP COLUMN IF EXISTS search_vector;
+ALTER TABLE notebooks DROP COLUMN IF EXISTS search_vector;
@@ -0,0 +1,25 @@
+-- Полнотекстовый поиск: контент смешанный, поэтому вектор строится по русской и английской конфигурациям.
+-- Заголовки весят больше текста (A и B).
+
+ALTER TABLE notebooks ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('russian', name), 'A') ||
+    setweight(to_tsvector('english', name), 'A')
+) STORED;
+
+ALTER TABLE pages ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('russian', title), 'A') ||
+    setweight(to_tsvector('english', title), 'A') ||
+    setweight(to_tsvector('russian', content), 'B') ||
+    setweight(to_tsvector('english', content), 'B')
+) STORED;
+
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('russian', title), 'A') ||
+    setweight(to_tsvector('english', title), 'A') ||
+    setweight(to_tsvector('russian', description), 'B') ||
+    setweight(to_tsvector('english', description), 'B')
+) STORED;
+
+CREATE INDEX IF NOT EXISTS notebooks_search_idx ON notebooks USING GIN (search_vector);
+CREATE INDEX IF NOT EXISTS pages_search_idx ON pages USING GIN (search_vector);
+CREATE INDEX IF NOT EXISTS tasks_search_idx ON tasks USING GIN (search_vector);
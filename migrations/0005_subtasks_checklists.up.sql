@@ -0,0 +1,17 @@
+-- Подзадачи (иерархия через parent_task_id) и пункты чек-листов задач
+
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS parent_task_id INTEGER REFERENCES tasks (id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS tasks_parent_task_id_idx ON tasks (parent_task_id);
+
+CREATE TABLE IF NOT EXISTS task_checklist_items (
+    id         SERIAL PRIMARY KEY,
+    task_id    INTEGER     NOT NULL REFERENCES tasks (id) ON DELETE CASCADE,
+    title      TEXT        NOT NULL,
+    done       BOOLEAN     NOT NULL DEFAULT false,
+    position   INTEGER     NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS task_checklist_items_task_id_idx ON task_checklist_items (task_id, position);
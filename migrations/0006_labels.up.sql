@@ -0,0 +1,27 @@
+-- Метки пользователя и их связи с задачами и страницами (многие-ко-многим)
+
+CREATE TABLE IF NOT EXISTS labels (
+    id         SERIAL PRIMARY KEY,
+    user_id    INTEGER     NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name       TEXT        NOT NULL,
+    color      TEXT        NOT NULL DEFAULT '#9e9e9e',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CONSTRAINT labels_user_id_name_key UNIQUE (user_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS task_labels (
+    task_id  INTEGER NOT NULL REFERENCES tasks (id) ON DELETE CASCADE,
+    label_id INTEGER NOT NULL REFERENCES labels (id) ON DELETE CASCADE,
+    PRIMARY KEY (task_id, label_id)
+);
+
+CREATE INDEX IF NOT EXISTS task_labels_label_id_idx ON task_labels (label_id);
+
+CREATE TABLE IF NOT EXISTS page_labels (
+    page_id  INTEGER NOT NULL REFERENCES pages (id) ON DELETE CASCADE,
+    label_id INTEGER NOT NULL REFERENCES labels (id) ON DELETE CASCADE,
+    PRIMARY KEY (page_id, label_id)
+);
+
+CREATE INDEX IF NOT EXISTS page_labels_label_id_idx ON page_labels (label_id);
@@ -0,0 +1,3 @@
+-- Правило повторения задачи (подмножество RRULE); пустая строка — задача не повторяется
+
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS recurrence TEXT NOT NULL DEFAULT '';
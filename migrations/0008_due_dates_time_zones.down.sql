@@ -0,0 +1,5 @@
+ALTER TABLE users DROP COLUMN IF EXISTS time_zone;
+ALTER TABLE tasks DROP COLUMN IF EXISTS due_all_day;
+UPDATE tasks SET due_date = created_at WHERE due_date IS NULL;
+ALTER TABLE tasks ALTER COLUMN due_date SET DEFAULT now();
+ALTER TABLE tasks ALTER COLUMN due_date SET NOT NULL;
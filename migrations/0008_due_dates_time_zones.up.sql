@@ -0,0 +1,11 @@
+-- Необязательный срок задачи, срок без времени и часовой пояс пользователя
+
+ALTER TABLE tasks ALTER COLUMN due_date DROP NOT NULL;
+ALTER TABLE tasks ALTER COLUMN due_date DROP DEFAULT;
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS due_all_day BOOLEAN NOT NULL DEFAULT false;
+
+-- Раньше задаче без срока подставлялся момент создания: такие сроки совпадают с created_at
+-- с точностью до секунды. Снимаем их, иначе все эти задачи считаются просроченными.
+UPDATE tasks SET due_date = NULL WHERE abs(extract(epoch FROM due_date - created_at)) < 1;
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS time_zone TEXT NOT NULL DEFAULT 'UTC';
@@ -0,0 +1,36 @@
+-- Напоминания о задачах и уведомления в приложении
+
+CREATE TABLE IF NOT EXISTS reminders (
+    id              SERIAL PRIMARY KEY,
+    task_id         INTEGER     NOT NULL REFERENCES tasks (id) ON DELETE CASCADE,
+    user_id         INTEGER     NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    remind_at       TIMESTAMPTZ,          -- абсолютное время
+    minutes_before  INTEGER,              -- или за сколько минут до срока задачи
+    channel         TEXT        NOT NULL DEFAULT 'in_app',
+    webhook_url     TEXT        NOT NULL DEFAULT '',
+    fire_at         TIMESTAMPTZ,          -- NULL: относительное напоминание у задачи без срока
+    status          TEXT        NOT NULL DEFAULT 'pending',
+    attempts        INTEGER     NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_error      TEXT        NOT NULL DEFAULT '',
+    sent_at         TIMESTAMPTZ,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CONSTRAINT reminders_time_check CHECK ((remind_at IS NULL) <> (minutes_before IS NULL))
+);
+
+CREATE INDEX IF NOT EXISTS reminders_task_id_idx ON reminders (task_id);
+-- Выборка планировщика: только ожидающие напоминания
+CREATE INDEX IF NOT EXISTS reminders_pending_fire_at_idx ON reminders (fire_at) WHERE status = 'pending';
+
+CREATE TABLE IF NOT EXISTS notifications (
+    id         SERIAL PRIMARY KEY,
+    user_id    INTEGER     NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    task_id    INTEGER     REFERENCES tasks (id) ON DELETE SET NULL,
+    kind       TEXT        NOT NULL,
+    title      TEXT        NOT NULL,
+    body       TEXT        NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    read_at    TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS notifications_user_id_created_at_idx ON notifications (user_id, created_at DESC);
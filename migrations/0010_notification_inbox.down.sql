@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS notifications_unread_idx;
+DROP INDEX IF EXISTS notifications_user_id_dedupe_key_idx;
+ALTER TABLE notifications DROP COLUMN IF EXISTS dedupe_key;
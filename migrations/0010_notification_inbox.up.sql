@@ -0,0 +1,9 @@
+-- Входящие уведомления: защита от повторов и быстрый подсчёт непрочитанных
+
+ALTER TABLE notifications ADD COLUMN IF NOT EXISTS dedupe_key TEXT;
+
+-- Одно уведомление на событие, даже если его сформировали несколько экземпляров сервера
+CREATE UNIQUE INDEX IF NOT EXISTS notifications_user_id_dedupe_key_idx
+    ON notifications (user_id, dedupe_key) WHERE dedupe_key IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS notifications_unread_idx ON notifications (user_id) WHERE read_at IS NULL;
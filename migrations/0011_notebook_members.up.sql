@@ -0,0 +1,14 @@
+-- Совместный доступ к блокнотам. Владелец по-прежнему хранится в notebooks.user_id,
+-- здесь — остальные участники и их роли.
+
+CREATE TABLE IF NOT EXISTS notebook_members (
+    notebook_id INT NOT NULL REFERENCES notebooks(id) ON DELETE CASCADE,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role TEXT NOT NULL CHECK (role IN ('editor', 'viewer')),
+    invited_by INT REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (notebook_id, user_id)
+);
+
+-- Блокноты, открытые пользователю
+CREATE INDEX IF NOT EXISTS notebook_members_user_id_idx ON notebook_members (user_id);
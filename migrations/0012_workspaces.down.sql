@@ -0,0 +1,4 @@
+ALTER TABLE users DROP COLUMN IF EXISTS current_workspace_id;
+ALTER TABLE notebooks DROP COLUMN IF EXISTS workspace_id;
+DROP TABLE IF EXISTS workspace_members;
+DROP TABLE IF EXISTS workspaces;
@@ -0,0 +1,41 @@
+-- Пространства (workspaces) — уровень над блокнотами. У каждого пользователя есть личное
+-- пространство (personal_user_id); участники пространства получают в его блокнотах default_role.
+
+CREATE TABLE IF NOT EXISTS workspaces (
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    default_role TEXT NOT NULL DEFAULT 'viewer' CHECK (default_role IN ('editor', 'viewer', 'none')),
+    personal_user_id INT UNIQUE REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS workspace_members (
+    workspace_id INT NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role TEXT NOT NULL CHECK (role IN ('admin', 'member')),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (workspace_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS workspace_members_user_id_idx ON workspace_members (user_id);
+
+-- Личные пространства существующих пользователей; их блокноты переезжают туда
+INSERT INTO workspaces (name, default_role, personal_user_id)
+SELECT 'Личное', 'none', u.id FROM users u
+WHERE NOT EXISTS (SELECT 1 FROM workspaces w WHERE w.personal_user_id = u.id);
+
+INSERT INTO workspace_members (workspace_id, user_id, role)
+SELECT w.id, w.personal_user_id, 'admin' FROM workspaces w
+WHERE w.personal_user_id IS NOT NULL
+ON CONFLICT DO NOTHING;
+
+ALTER TABLE notebooks ADD COLUMN IF NOT EXISTS workspace_id INT REFERENCES workspaces(id) ON DELETE CASCADE;
+UPDATE notebooks n SET workspace_id = w.id FROM workspaces w
+WHERE w.personal_user_id = n.user_id AND n.workspace_id IS NULL;
+ALTER TABLE notebooks ALTER COLUMN workspace_id SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS notebooks_workspace_id_idx ON notebooks (workspace_id);
+
+-- Выбранное пространство; NULL — личное
+ALTER TABLE users ADD COLUMN IF NOT EXISTS current_workspace_id INT REFERENCES workspaces(id) ON DELETE SET NULL;
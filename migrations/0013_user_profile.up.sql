@@ -0,0 +1,4 @@
+-- Профиль пользователя: отображаемое имя и язык интерфейса
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS display_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS locale TEXT NOT NULL DEFAULT 'ru';
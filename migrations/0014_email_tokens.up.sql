@@ -0,0 +1,17 @@
+-- Подтверждение email и сброс пароля: одноразовые токены, в базе хранится только SHA-256.
+-- Существующие адреса считаются неподтверждёнными, письмо можно запросить повторно.
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified_at TIMESTAMPTZ;
+
+CREATE TABLE IF NOT EXISTS email_tokens (
+    id         BIGSERIAL PRIMARY KEY,
+    user_id    INTEGER     NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    purpose    TEXT        NOT NULL CHECK (purpose IN ('verify_email', 'reset_password')),
+    email      TEXT        NOT NULL, -- адрес, на который отправлено письмо
+    token_hash TEXT        NOT NULL UNIQUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at    TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS email_tokens_user_id_purpose_idx ON email_tokens (user_id, purpose);
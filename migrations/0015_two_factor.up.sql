@@ -0,0 +1,18 @@
+-- Двухфакторная аутентификация по TOTP (RFC 6238) и одноразовые коды восстановления.
+-- Секрет нужен для проверки кодов, поэтому хранится как есть; от кодов восстановления — только SHA-256.
+
+CREATE TABLE IF NOT EXISTS user_totp (
+    user_id        INTEGER     PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+    secret         TEXT        NOT NULL, -- base32
+    confirmed_at   TIMESTAMPTZ,          -- NULL, пока подключение не подтверждено первым кодом
+    last_used_step BIGINT      NOT NULL DEFAULT 0, -- код не принимается повторно
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    id        BIGSERIAL PRIMARY KEY,
+    user_id   INTEGER     NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    code_hash TEXT        NOT NULL,
+    used_at   TIMESTAMPTZ,
+    CONSTRAINT recovery_codes_user_id_code_hash_key UNIQUE (user_id, code_hash)
+);
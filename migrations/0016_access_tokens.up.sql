@@ -0,0 +1,15 @@
+-- Персональные токены доступа для скриптов и интеграций: токен показывается один раз при создании,
+-- в базе хранится только SHA-256. Права задаются областями вида tasks:read, tasks:write.
+
+CREATE TABLE IF NOT EXISTS access_tokens (
+    id           SERIAL PRIMARY KEY,
+    user_id      INTEGER     NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name         TEXT        NOT NULL,
+    scopes       TEXT[]      NOT NULL CHECK (cardinality(scopes) > 0),
+    token_hash   TEXT        NOT NULL UNIQUE,
+    expires_at   TIMESTAMPTZ,          -- NULL — бессрочный
+    last_used_at TIMESTAMPTZ,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS access_tokens_user_id_idx ON access_tokens (user_id);
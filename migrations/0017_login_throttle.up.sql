@@ -0,0 +1,19 @@
+-- Защита входа от перебора: счётчики неудачных попыток (для auth.login_throttle.store: postgres)
+-- и журнал всех неудачных попыток входа.
+
+CREATE TABLE IF NOT EXISTS login_failures (
+    key             TEXT        PRIMARY KEY, -- account:<имя> или ip:<адрес>
+    failures        INTEGER     NOT NULL,
+    last_failure_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS login_audit (
+    id         BIGSERIAL PRIMARY KEY,
+    username   TEXT        NOT NULL, -- как введено при входе
+    user_id    INTEGER     REFERENCES users (id) ON DELETE SET NULL, -- NULL, если аккаунт не найден
+    ip         TEXT        NOT NULL,
+    reason     TEXT        NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS login_audit_user_id_created_at_idx ON login_audit (user_id, created_at DESC);
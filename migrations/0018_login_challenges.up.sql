@@ -0,0 +1,7 @@
+-- Погашенные токены второго шага входа (jti): каждый токен принимается только один раз.
+-- Записи истёкших токенов больше не нужны и удаляются при погашении следующих.
+
+CREATE TABLE IF NOT EXISTS used_login_challenges (
+    jti        TEXT        PRIMARY KEY,
+    expires_at TIMESTAMPTZ NOT NULL
+);
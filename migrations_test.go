@@ -0,0 +1,56 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"testing/fstest"
+)
+
+func TestEmbeddedMigrations(t *testing.T) {
+	migrations, err := loadMigrations(migrationFiles)
+	require.NoError(t, err, "Встроенные миграции должны загружаться без ошибок")
+	require.NotEmpty(t, migrations)
+	assert.Equal(t, "init", migrations[0].Name)
+	for i, m := range migrations {
+		assert.Equal(t, i+1, m.Version, "Версии миграций должны идти подряд")
+		assert.NotEmpty(t, m.Checksum)
+	}
+}
+
+func TestLoadMigrationsErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		files fstest.MapFS
+	}{
+		{"missing down", fstest.MapFS{
+			"migrations/0001_init.up.sql": {Data: []byte("SELECT 1")},
+		}},
+		{"gap in versions", fstest.MapFS{
+			"migrations/0001_init.up.sql":   {Data: []byte("SELECT 1")},
+			"migrations/0001_init.down.sql": {Data: []byte("SELECT 1")},
+			"migrations/0003_x.up.sql":      {Data: []byte("SELECT 1")},
+			"migrations/0003_x.down.sql":    {Data: []byte("SELECT 1")},
+		}},
+		{"bad name", fstest.MapFS{
+			"migrations/init.up.sql": {Data: []byte("SELECT 1")},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadMigrations(tt.files)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestVerifyMigrationsChecksum(t *testing.T) {
+	migrations, err := loadMigrations(migrationFiles)
+	require.NoError(t, err)
+
+	applied := []appliedMigration{{Version: 1, Name: "init", Checksum: migrations[0].Checksum}}
+	assert.NoError(t, verifyMigrations(migrations, applied))
+
+	applied[0].Checksum = "changed"
+	assert.Error(t, verifyMigrations(migrations, applied), "Изменённая задним числом миграция должна обнаруживаться")
+}
@@ -8,15 +8,64 @@ type User struct {
 	Email     string `json:"email"`
 	Username  string `json:"username"`
 	Password  string `json:"password"`
+	TimeZone  string `json:"time_zone"` // имя из базы IANA; в нём считаются «сегодня» и «просрочено»
 	CreatedAt string `json:"createdAt"`
+
+	EmailVerified bool `json:"email_verified"`
+}
+
+// Профиль пользователя для /api/profile (без хеша пароля)
+type Profile struct {
+	ID               int       `json:"id"`
+	Username         string    `json:"username"`
+	Email            string    `json:"email"`
+	DisplayName      string    `json:"display_name"`
+	TimeZone         string    `json:"time_zone"`
+	Locale           string    `json:"locale"`
+	EmailVerified    bool      `json:"email_verified"`
+	TwoFactorEnabled bool      `json:"two_factor_enabled"`
+	CreatedAt        time.Time `json:"created_at"`
 }
 
 type Notebook struct {
-	ID        int       `json:"id"`
-	UserID    int       `json:"user_id"`
-	Name      string    `json:"name"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID          int       `json:"id"`
+	UserID      int       `json:"user_id"` // владелец
+	WorkspaceID int       `json:"workspace_id"`
+	Name        string    `json:"name"`
+	Role        string    `json:"role,omitempty"` // роль текущего пользователя; заполняется в списке блокнотов
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Участник блокнота. Владелец тоже возвращается в списке участников — с ролью owner.
+type NotebookMember struct {
+	NotebookID int       `json:"notebook_id"`
+	UserID     int       `json:"user_id"`
+	Username   string    `json:"username"`
+	Role       string    `json:"role"` // owner, editor или viewer
+	InvitedBy  *int      `json:"invited_by"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Пространство — группа блокнотов отдела или команды. Участники пространства получают
+// в его блокнотах DefaultRole; явная роль участника блокнота её только повышает.
+type Workspace struct {
+	ID          int       `json:"id"`
+	Name        string    `json:"name"`
+	DefaultRole string    `json:"default_role"`   // editor, viewer или none
+	Personal    bool      `json:"personal"`       // личное пространство пользователя: без участников, не удаляется
+	Role        string    `json:"role,omitempty"` // роль текущего пользователя: admin или member
+	Current     bool      `json:"current"`        // выбрано пользователем; заполняет обработчик
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type WorkspaceMember struct {
+	WorkspaceID int       `json:"workspace_id"`
+	UserID      int       `json:"user_id"`
+	Username    string    `json:"username"`
+	Role        string    `json:"role"` // admin или member
+	CreatedAt   time.Time `json:"created_at"`
 }
 
 type Page struct {
@@ -29,15 +78,162 @@ type Page struct {
 }
 
 type Task struct {
-	ID          int       `json:"id"`
-	PageID      int       `json:"page_id"`
-	Title       string    `json:"title"`
-	Description string    `json:"description"`
-	Status      string    `json:"status"`
-	Priority    int       `json:"priority"`
-	DueDate     time.Time `json:"due_date"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID          int        `json:"id"`
+	PageID      int        `json:"page_id"`
+	ParentID    *int       `json:"parent_task_id"` // nil у задач верхнего уровня
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Status      string     `json:"status"`
+	Priority    int        `json:"priority"`
+	DueDate     *time.Time `json:"due_date"`    // nil — без срока
+	DueAllDay   bool       `json:"due_all_day"` // срок — дата без времени, хранится как полночь UTC этой даты
+	Recurrence  string     `json:"recurrence"`  // правило повторения (recurrence.go), пустое — задача не повторяется
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// Метка пользователя; привязывается к задачам и страницам
+type Label struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	Name      string    `json:"name"`
+	Color     string    `json:"color"` // #rrggbb
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Пункт чек-листа задачи
+type ChecklistItem struct {
+	ID        int       `json:"id"`
+	TaskID    int       `json:"task_id"`
+	Title     string    `json:"title"`
+	Done      bool      `json:"done"`
+	Position  int       `json:"position"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Напоминание о задаче: в абсолютное время (RemindAt) или за MinutesBefore минут до срока.
+// FireAt вычисляется хранилищем и пересчитывается при смене срока; nil — у задачи нет срока.
+type Reminder struct {
+	ID            int        `json:"id"`
+	TaskID        int        `json:"task_id"`
+	UserID        int        `json:"user_id"`
+	RemindAt      *time.Time `json:"remind_at"`
+	MinutesBefore *int       `json:"minutes_before"`
+	Channel       string     `json:"channel"`               // in_app, email или webhook
+	WebhookURL    string     `json:"webhook_url,omitempty"` // только для webhook
+	FireAt        *time.Time `json:"fire_at"`
+	Status        string     `json:"status"` // pending, sent, failed или skipped
+	Attempts      int        `json:"attempts"`
+	NextAttemptAt time.Time  `json:"-"`
+	LastError     string     `json:"last_error,omitempty"`
+	SentAt        *time.Time `json:"sent_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// Уведомление в приложении
+type Notification struct {
+	ID        int        `json:"id"`
+	UserID    int        `json:"user_id"`
+	TaskID    *int       `json:"task_id"` // null, если задача удалена
+	Kind      string     `json:"kind"`    // см. notificationReminder и соседние константы
+	Title     string     `json:"title"`
+	Body      string     `json:"body"`
+	DedupeKey string     `json:"-"` // уведомление с тем же ключом у пользователя уже есть — ErrDuplicateKey
+	CreatedAt time.Time  `json:"created_at"`
+	ReadAt    *time.Time `json:"read_at"`
+}
+
+// Прогресс задачи: выполненные из прямых подзадач (без отменённых) и пунктов чек-листа
+type TaskProgress struct {
+	Done  int `json:"done"`
+	Total int `json:"total"`
+}
+
+// Задача в дереве: подзадачи, чек-лист и прогресс
+type TaskNode struct {
+	Task
+	Checklist []ChecklistItem `json:"checklist"`
+	Subtasks  []*TaskNode     `json:"subtasks"`
+	Progress  TaskProgress    `json:"progress"`
+}
+
+// Запись истории статусов задачи; FromStatus пуст (null) для записи о создании
+type TaskStatusChange struct {
+	ID         int64     `json:"id"`
+	TaskID     int       `json:"task_id"`
+	UserID     *int      `json:"user_id"` // null, если пользователь удалён
+	FromStatus *string   `json:"from_status"`
+	ToStatus   string    `json:"to_status"`
+	ChangedAt  time.Time `json:"changed_at"`
+}
+
+// Результат поиска: найденный объект, сниппет и путь к нему (блокнот → страница)
+type SearchResult struct {
+	Type         string  `json:"type"` // notebook, page или task
+	ID           int     `json:"id"`
+	Title        string  `json:"title"`
+	Snippet      string  `json:"snippet"` // HTML: текст экранирован, совпадения в <mark>
+	Rank         float64 `json:"rank"`
+	NotebookID   int     `json:"notebook_id"`
+	NotebookName string  `json:"notebook_name"`
+	PageID       *int    `json:"page_id,omitempty"` // только для задач
+	PageTitle    string  `json:"page_title,omitempty"`
+}
+
+// Одноразовый токен из письма: подтверждение email или сброс пароля
+type EmailToken struct {
+	UserID    int
+	Purpose   string // emailTokenVerify или emailTokenReset
+	Email     string // адрес, на который отправлено письмо
+	TokenHash string
+	ExpiresAt time.Time
+}
+
+// Секрет TOTP пользователя
+type TOTPSecret struct {
+	UserID       int
+	Secret       string // base32
+	Confirmed    bool   // подключение подтверждено первым кодом; до этого вход не требует второго шага
+	LastUsedStep int64
+}
+
+// Персональный токен доступа; сам токен возвращается только при создании
+type AccessToken struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"user_id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"` // ресурс:read или ресурс:write
+	TokenHash  string     `json:"-"`
+	ExpiresAt  *time.Time `json:"expires_at"` // null — бессрочный
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// Счётчик неудачных попыток входа по ключу (account:<имя> или ip:<адрес>)
+type LoginFailures struct {
+	Key           string
+	Failures      int
+	LastFailureAt time.Time
+}
+
+// Запись журнала неудачных попыток входа
+type LoginAuditEntry struct {
+	ID        int64     `json:"id"`
+	Username  string    `json:"username"` // как введено при входе
+	UserID    *int      `json:"user_id"`  // null, если аккаунт не найден или удалён
+	IP        string    `json:"ip"`
+	Reason    string    `json:"reason"` // loginFailedCredentials и другие причины из throttle.go
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Сохранённый refresh-токен: в хранилище попадает только его хеш
+type RefreshToken struct {
+	UserID    int
+	FamilyID  string
+	TokenHash string
+	ExpiresAt time.Time
 }
 
 // Структура для обработки данных регистрации
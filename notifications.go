@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Виды уведомлений
+const (
+	notificationReminder = "reminder"         // сработало напоминание (канал in_app)
+	notificationDueToday = "due_today"        // срок задачи — сегодня
+	notificationOverdue  = "overdue"          // срок задачи прошёл
+	notificationShared   = "notebook_shared"  // пользователя добавили в блокнот
+	notificationChanged  = "notebook_changed" // в общем блокноте изменили блокнот, страницу или задачу
+)
+
+const (
+	defaultNotificationPageSize = 50
+	maxNotificationPageSize     = 100
+)
+
+// Насколько вперёд искать задачи для уведомлений «срок сегодня»: с запасом в сутки,
+// чтобы покрыть сроки без времени в любом часовом поясе
+const dueNotificationWindow = 48 * time.Hour
+
+// Выборка уведомлений: от новых к старым, BeforeID — id последнего уведомления предыдущей страницы
+type NotificationFilter struct {
+	UserID     int
+	UnreadOnly bool
+	BeforeID   int
+	Limit      int
+}
+
+// Разбор unread=true&before=123&limit=50
+func parseNotificationFilter(q url.Values) (NotificationFilter, error) {
+	f := NotificationFilter{Limit: defaultNotificationPageSize}
+	var err error
+	if v := q.Get("unread"); v != "" {
+		if f.UnreadOnly, err = strconv.ParseBool(v); err != nil {
+			return f, &validationError{"unread", "must be a boolean"}
+		}
+	}
+	if v := q.Get("before"); v != "" {
+		if f.BeforeID, err = strconv.Atoi(v); err != nil || f.BeforeID < 1 {
+			return f, &validationError{"before", "must be a notification ID"}
+		}
+	}
+	if v := q.Get("limit"); v != "" {
+		if f.Limit, err = strconv.Atoi(v); err != nil || f.Limit < 1 || f.Limit > maxNotificationPageSize {
+			return f, &validationError{"limit", fmt.Sprintf("must be an integer from 1 to %d", maxNotificationPageSize)}
+		}
+	}
+	return f, nil
+}
+
+// Уведомление о сроке задачи на момент w.Now: «просрочено» или «сегодня»; ok = false, если ни то ни другое.
+// Ключ повтора включает срок (или дату), поэтому после переноса срока уведомление приходит снова.
+func dueNotification(t Task, w dueWindow) (n Notification, ok bool) {
+	taskID := t.ID
+	switch {
+	case w.isOverdue(t):
+		return Notification{
+			TaskID:    &taskID,
+			Kind:      notificationOverdue,
+			Title:     "Просрочено: " + t.Title,
+			DedupeKey: fmt.Sprintf("%s:%d:%d", notificationOverdue, t.ID, t.DueDate.Unix()),
+		}, true
+	case w.isToday(t):
+		return Notification{
+			TaskID:    &taskID,
+			Kind:      notificationDueToday,
+			Title:     "Срок сегодня: " + t.Title,
+			DedupeKey: fmt.Sprintf("%s:%d:%s", notificationDueToday, t.ID, w.Today.Format(time.DateOnly)),
+		}, true
+	}
+	return Notification{}, false
+}
+
+// Заголовки уведомлений об изменениях в общем блокноте по типу события
+var notebookChangeTitles = map[string]string{
+	"notebook." + eventUpdated: "Изменён блокнот",
+	"page." + eventCreated:     "Новая страница",
+	"page." + eventUpdated:     "Изменена страница",
+	"page." + eventDeleted:     "Удалена страница",
+	"task." + eventCreated:     "Новая задача",
+	"task." + eventUpdated:     "Изменена задача",
+	"task." + eventDeleted:     "Удалена задача",
+}
+
+// Уведомления об изменении в общем блокноте всем, кто его видит, кроме автора изменения.
+// Не больше одного в день на объект и действие: серия правок одной задачи не засыпает участников.
+// Ошибки только журналируются — изменение уже сохранено.
+func (s *server) notifyNotebookChange(ctx context.Context, notebookID int, audience []int, object, action string, id int, data any) {
+	title, ok := notebookChangeTitles[object+"."+action]
+	if !ok || len(audience) < 2 {
+		return
+	}
+	actor, _ := ctx.Value(userIDKey).(string)
+	actorID, _ := strconv.Atoi(actor)
+	notebook, err := s.notebooks.GetNotebook(ctx, notebookID)
+	if err != nil {
+		log.Printf("Ошибка получения блокнота %d для уведомления: %v", notebookID, err)
+		return
+	}
+
+	var taskID *int
+	if object == "task" && action != eventDeleted {
+		taskID = &id
+	}
+	var body string
+	switch v := data.(type) {
+	case Task:
+		body = v.Title
+	case Page:
+		body = v.Title
+	}
+	day := time.Now().UTC().Format(time.DateOnly)
+	for _, userID := range audience {
+		if userID == actorID {
+			continue
+		}
+		n := Notification{
+			UserID:    userID,
+			TaskID:    taskID,
+			Kind:      notificationChanged,
+			Title:     fmt.Sprintf("%s в блокноте «%s»", title, notebook.Name),
+			Body:      body,
+			DedupeKey: fmt.Sprintf("%s:%s:%d:%s:%s", notificationChanged, object, id, action, day),
+		}
+		if err := createNotificationOnce(ctx, s.notifications, n); err != nil {
+			log.Printf("Ошибка создания уведомления об изменении блокнота %d: %v", notebookID, err)
+		}
+	}
+}
+
+// GET /api/notifications: {"notifications": [...], "unread_count": N, "next_before": id};
+// next_before отсутствует на последней странице
+func (s *server) notificationsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	userID, err := userIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	filter, err := parseNotificationFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter.UserID = userID
+
+	// Запрашиваем на одно уведомление больше, чтобы узнать, есть ли следующая страница
+	limit := filter.Limit
+	filter.Limit++
+	notifications, err := s.notifications.ListNotifications(r.Context(), filter)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error fetching notifications: %v", err), http.StatusInternalServerError)
+		return
+	}
+	var nextBefore int
+	if len(notifications) > limit {
+		notifications = notifications[:limit]
+		nextBefore = notifications[limit-1].ID
+	}
+	if notifications == nil {
+		notifications = []Notification{}
+	}
+	unread, err := s.notifications.UnreadNotificationCount(r.Context(), userID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error fetching notifications: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Notifications []Notification `json:"notifications"`
+		UnreadCount   int            `json:"unread_count"`
+		NextBefore    int            `json:"next_before,omitempty"`
+	}{notifications, unread, nextBefore})
+}
+
+// GET /api/notifications/unread-count, POST /api/notifications/read-all
+// и POST /api/notifications/{id}/read
+func (s *server) notificationHandler(w http.ResponseWriter, r *http.Request) {
+	action := strings.TrimPrefix(r.URL.Path, "/api/notifications/")
+	userID, err := userIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch {
+	case action == "unread-count":
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		s.writeUnreadCount(w, r, userID, nil)
+
+	case action == "read-all":
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		marked, err := s.notifications.MarkAllNotificationsRead(r.Context(), userID)
+		if err != nil {
+			http.Error(w, "Failed to mark notifications as read: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		s.writeUnreadCount(w, r, userID, map[string]int{"marked": marked})
+
+	case strings.HasSuffix(action, "/read"):
+		notificationID, err := strconv.Atoi(strings.TrimSuffix(action, "/read"))
+		if err != nil {
+			http.Error(w, "Invalid notification_id format", http.StatusBadRequest)
+			return
+		}
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		n, err := s.notifications.MarkNotificationRead(r.Context(), userID, notificationID)
+		if err != nil {
+			writeAuthzError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(n)
+
+	default:
+		http.Error(w, "Not Found", http.StatusNotFound)
+	}
+}
+
+// Ответ {"unread_count": N} с дополнительными полями extra
+func (s *server) writeUnreadCount(w http.ResponseWriter, r *http.Request, userID int, extra map[string]int) {
+	unread, err := s.notifications.UnreadNotificationCount(r.Context(), userID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error fetching notifications: %v", err), http.StatusInternalServerError)
+		return
+	}
+	resp := map[string]int{"unread_count": unread}
+	for k, v := range extra {
+		resp[k] = v
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// Уведомление, если такого ещё не было; повтор по DedupeKey не считается ошибкой
+func createNotificationOnce(ctx context.Context, st NotificationStore, n Notification) error {
+	if _, err := st.CreateNotification(ctx, n); err != nil && !errors.Is(err, ErrDuplicateKey) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/smtp"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Заголовок и текст напоминания; время срока — в часовом поясе пользователя
+func reminderText(msg ReminderMessage) (title, body string) {
+	title = "Напоминание: " + msg.Task.Title
+	switch due := msg.Task.DueDate; {
+	case due == nil:
+		body = "Срок не задан"
+	case msg.Task.DueAllDay:
+		body = "Срок: " + due.Format("02.01.2006")
+	default:
+		body = "Срок: " + due.In(userLocation(msg.User.TimeZone)).Format("02.01.2006 15:04 MST")
+	}
+	return title, body
+}
+
+// Уведомление в приложении
+type inAppNotifier struct {
+	notifications NotificationStore
+}
+
+func (n inAppNotifier) Notify(ctx context.Context, msg ReminderMessage) error {
+	title, body := reminderText(msg)
+	taskID := msg.Task.ID
+	_, err := n.notifications.CreateNotification(ctx, Notification{
+		UserID: msg.User.ID,
+		TaskID: &taskID,
+		Kind:   notificationReminder,
+		Title:  title,
+		Body:   body,
+	})
+	return err
+}
+
+// Ошибка доставки webhook, которая попадает в last_error. Ответ или ошибка удалённого сервера
+// пишутся только в журнал: иначе через напоминания можно было бы читать внутреннюю сеть.
+var errWebhookDelivery = errors.New("webhook delivery failed")
+
+var errWebhookAddress = errors.New("webhook address is not public")
+
+// Можно ли отправлять webhook на адрес: внутренние, локальные и групповые адреса запрещены
+func isPublicAddr(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return ip.IsValid() && !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified())
+}
+
+// Проверка адреса непосредственно перед соединением, уже после разрешения имени, —
+// так её не обойти подменой DNS-ответа (DNS rebinding)
+func dialPublicOnly(network, address string, c syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil || !isPublicAddr(addrPort.Addr()) {
+		return fmt.Errorf("%w: %s", errWebhookAddress, address)
+	}
+	return nil
+}
+
+// POST JSON на webhook_url напоминания; успех — любой ответ 2xx
+type webhookNotifier struct {
+	client *http.Client
+}
+
+func newWebhookNotifier(timeout time.Duration) webhookNotifier {
+	dialer := &net.Dialer{Timeout: timeout, Control: dialPublicOnly}
+	return webhookNotifier{client: &http.Client{
+		Timeout: timeout,
+		// Без прокси из окружения: иначе проверялся бы адрес прокси, а не получателя
+		Transport: &http.Transport{Proxy: nil, DialContext: dialer.DialContext, TLSHandshakeTimeout: timeout},
+		// Перенаправление не выполняется и считается неуспешным ответом
+		CheckRedirect: func(req *http.Request, via []*http.Request) error { return http.ErrUseLastResponse },
+	}}
+}
+
+func (n webhookNotifier) Notify(ctx context.Context, msg ReminderMessage) error {
+	if err := n.post(ctx, msg); err != nil {
+		log.Printf("Webhook напоминания %d не доставлен: %v", msg.Reminder.ID, err)
+		return errWebhookDelivery
+	}
+	return nil
+}
+
+func (n webhookNotifier) post(ctx context.Context, msg ReminderMessage) error {
+	payload, err := json.Marshal(map[string]any{
+		"event":       "task.reminder",
+		"reminder_id": msg.Reminder.ID,
+		"fire_at":     msg.Reminder.FireAt,
+		"task":        msg.Task,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, msg.Reminder.WebhookURL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded with %s", resp.Status)
+	}
+	return nil
+}
+
+// Письмо на адрес пользователя через SMTP
+type emailNotifier struct {
+	cfg  SMTPConfig
+	send func(ctx context.Context, addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+func newEmailNotifier(cfg SMTPConfig) emailNotifier {
+	return emailNotifier{cfg: cfg, send: sendMail}
+}
+
+func (n emailNotifier) Notify(ctx context.Context, msg ReminderMessage) error {
+	if msg.User.Email == "" {
+		return fmt.Errorf("user %d has no email: %w", msg.User.ID, ErrNotFound)
+	}
+	title, body := reminderText(msg)
+	return smtpMailer{cfg: n.cfg, send: n.send}.Send(ctx, msg.User.Email, title, body)
+}
+
+// Письмо в формате RFC 5322; тема кодируется по RFC 2047, т.к. может содержать кириллицу
+func buildEmail(from, to, subject, body string) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", to)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	b.WriteString("\r\n")
+	return []byte(b.String())
+}
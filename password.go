@@ -0,0 +1,171 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Алгоритмы хеширования паролей
+const (
+	algArgon2id = "argon2id"
+	algBcrypt   = "bcrypt"
+)
+
+// Параметры argon2id, с которыми хешируются новые пароли
+type argon2Params struct {
+	Memory      uint32 // Объём памяти в KiB
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+var (
+	passwordAlgorithm = algArgon2id // Алгоритм для новых хешей
+	passwordArgon2    = argon2Params{
+		Memory:      64 * 1024,
+		Iterations:  1,
+		Parallelism: 4,
+		SaltLength:  16,
+		KeyLength:   32,
+	}
+	passwordBcryptCost = bcrypt.DefaultCost
+
+	ErrInvalidHash = errors.New("invalid password hash format")
+
+	dummyHashOnce sync.Once
+	dummyHash     string
+)
+
+// Хеширование пароля текущим алгоритмом с текущими параметрами.
+// Результат содержит алгоритм и параметры, поэтому его можно проверить и после их смены.
+func hashPassword(password string) (string, error) {
+	switch passwordAlgorithm {
+	case algBcrypt:
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), passwordBcryptCost)
+		if err != nil {
+			return "", fmt.Errorf("ошибка хеширования пароля: %v", err)
+		}
+		return string(hash), nil
+	case algArgon2id:
+		return hashArgon2id(password, passwordArgon2)
+	default:
+		return "", fmt.Errorf("unknown password algorithm: %s", passwordAlgorithm)
+	}
+}
+
+func hashArgon2id(password string, p argon2Params) (string, error) {
+	salt := make([]byte, p.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("ошибка генерации соли: %v", err)
+	}
+	key := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+
+	// Формат PHC: $argon2id$v=19$m=65536,t=1,p=4$<salt>$<hash>
+	return fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		algArgon2id, argon2.Version, p.Memory, p.Iterations, p.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// Проверка пароля по сохранённому значению.
+// needsRehash = true, если хеш сделан другим алгоритмом/параметрами или пароль хранится открытым текстом.
+func verifyPassword(stored, password string) (ok bool, needsRehash bool, err error) {
+	switch {
+	case strings.HasPrefix(stored, "$"+algArgon2id+"$"):
+		p, salt, key, err := decodeArgon2id(stored)
+		if err != nil {
+			return false, false, err
+		}
+		candidate := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, uint32(len(key)))
+		if subtle.ConstantTimeCompare(candidate, key) != 1 {
+			return false, false, nil
+		}
+		return true, passwordAlgorithm != algArgon2id || p != passwordArgon2, nil
+
+	case isPasswordHash(stored): // bcrypt: $2a$, $2b$ или $2y$
+		err := bcrypt.CompareHashAndPassword([]byte(stored), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, false, nil
+		}
+		if err != nil {
+			return false, false, fmt.Errorf("%w: %v", ErrInvalidHash, err)
+		}
+		cost, err := bcrypt.Cost([]byte(stored))
+		if err != nil {
+			return false, false, fmt.Errorf("%w: %v", ErrInvalidHash, err)
+		}
+		return true, passwordAlgorithm != algBcrypt || cost != passwordBcryptCost, nil
+
+	default:
+		// Старые записи с паролем открытым текстом: сравниваем за постоянное время и сразу перехешируем
+		if subtle.ConstantTimeCompare([]byte(stored), []byte(password)) != 1 {
+			return false, false, nil
+		}
+		return true, true, nil
+	}
+}
+
+// Префиксы поддерживаемых хешей. Остальные значения, в том числе начинающиеся с «$»,
+// считаются паролями открытым текстом.
+var passwordHashPrefixes = []string{"$" + algArgon2id + "$", "$2a$", "$2b$", "$2y$"}
+
+// Является ли сохранённое значение хешем (а не паролем открытым текстом)
+func isPasswordHash(stored string) bool {
+	for _, prefix := range passwordHashPrefixes {
+		if strings.HasPrefix(stored, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func decodeArgon2id(encoded string) (argon2Params, []byte, []byte, error) {
+	var p argon2Params
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", salt, hash
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return p, nil, nil, ErrInvalidHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return p, nil, nil, fmt.Errorf("%w: %v", ErrInvalidHash, err)
+	}
+	if version != argon2.Version {
+		return p, nil, nil, fmt.Errorf("%w: unsupported argon2 version %d", ErrInvalidHash, version)
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism); err != nil {
+		return p, nil, nil, fmt.Errorf("%w: %v", ErrInvalidHash, err)
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return p, nil, nil, fmt.Errorf("%w: %v", ErrInvalidHash, err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return p, nil, nil, fmt.Errorf("%w: %v", ErrInvalidHash, err)
+	}
+	p.SaltLength = uint32(len(salt))
+	p.KeyLength = uint32(len(key))
+
+	return p, salt, key, nil
+}
+
+// Фиктивный хеш с текущими параметрами — для проверки пароля несуществующего пользователя
+func dummyPasswordHash() string {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = hashPassword("taskflow-dummy-password")
+	})
+	return dummyHash
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestHashAndVerifyPassword(t *testing.T) {
+	hash, err := hashPassword("secret")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$"), "Хеш должен содержать алгоритм")
+	assert.NotContains(t, hash, "secret")
+
+	ok, needsRehash, err := verifyPassword(hash, "secret")
+	assert.NoError(t, err)
+	assert.True(t, ok, "Верный пароль должен проходить проверку")
+	assert.False(t, needsRehash, "Хеш с текущими параметрами не требует перехеширования")
+
+	ok, _, err = verifyPassword(hash, "wrong")
+	assert.NoError(t, err)
+	assert.False(t, ok, "Неверный пароль не должен проходить проверку")
+}
+
+func TestVerifyPasswordNeedsRehash(t *testing.T) {
+	// Открытый текст из старых записей
+	ok, needsRehash, err := verifyPassword("password123", "password123")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, needsRehash, "Пароль открытым текстом должен быть перехеширован")
+
+	// Смена параметров argon2id
+	old := passwordArgon2
+	passwordArgon2.Iterations = 2
+	hash, err := hashPassword("secret")
+	passwordArgon2 = old
+	require.NoError(t, err)
+	ok, needsRehash, err = verifyPassword(hash, "secret")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, needsRehash, "Хеш со старыми параметрами должен быть перехеширован")
+
+	// Смена алгоритма: bcrypt-хеш при текущем argon2id
+	passwordAlgorithm = algBcrypt
+	hash, err = hashPassword("secret")
+	passwordAlgorithm = algArgon2id
+	require.NoError(t, err)
+	ok, needsRehash, err = verifyPassword(hash, "secret")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, needsRehash, "Хеш другого алгоритма должен быть перехеширован")
+}
+
+func TestIsPasswordHash(t *testing.T) {
+	argon, err := hashArgon2id("secret", passwordArgon2)
+	require.NoError(t, err)
+	assert.True(t, isPasswordHash(argon))
+	assert.True(t, isPasswordHash("$2b$10$abcdefghijklmnopqrstuv"))
+	assert.False(t, isPasswordHash("password123"))
+	assert.False(t, isPasswordHash("$ecret1"), "Пароль, начинающийся с $, — не хеш")
+
+	// Такой пароль проверяется как открытый текст и перехешируется
+	ok, needsRehash, err := verifyPassword("$ecret1", "$ecret1")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, needsRehash)
+}
+
+func TestVerifyPasswordInvalidHash(t *testing.T) {
+	_, _, err := verifyPassword("$argon2id$broken", "secret")
+	assert.ErrorIs(t, err, ErrInvalidHash)
+}
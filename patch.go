@@ -0,0 +1,312 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Поле PATCH-запроса: отличает отсутствующее поле (Set == false) от явного null (Null == true)
+type optional[T any] struct {
+	Set   bool
+	Null  bool
+	Value T
+}
+
+// encoding/json вызывает UnmarshalJSON и для null, поэтому Set выставляется для любого переданного поля
+func (o *optional[T]) UnmarshalJSON(data []byte) error {
+	o.Set = true
+	if string(data) == "null" {
+		o.Null = true
+		return nil
+	}
+	return json.Unmarshal(data, &o.Value)
+}
+
+// Границы приоритета задачи
+const (
+	minTaskPriority = 0
+	maxTaskPriority = 5
+)
+
+// Ошибка проверки PATCH-запроса — отдаётся клиенту как 400
+type validationError struct {
+	Field   string
+	Message string
+}
+
+func (e *validationError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+// Частичное обновление блокнота: применяются только переданные поля
+type NotebookPatch struct {
+	Name optional[string] `json:"name"`
+}
+
+func (p NotebookPatch) Validate() error {
+	if p.Name.Set && (p.Name.Null || p.Name.Value == "") {
+		return &validationError{"name", "must be a non-empty string"}
+	}
+	return nil
+}
+
+func (p NotebookPatch) apply(n *Notebook) {
+	if p.Name.Set {
+		n.Name = p.Name.Value
+	}
+}
+
+// Частичное обновление профиля
+type ProfilePatch struct {
+	Username    optional[string] `json:"username"`
+	Email       optional[string] `json:"email"`
+	DisplayName optional[string] `json:"display_name"`
+	TimeZone    optional[string] `json:"time_zone"`
+	Locale      optional[string] `json:"locale"`
+}
+
+func (p ProfilePatch) Validate() error {
+	if p.Username.Set && (p.Username.Null || strings.TrimSpace(p.Username.Value) == "") {
+		return &validationError{"username", "must be a non-empty string"}
+	}
+	if p.Email.Set && (p.Email.Null || !emailRe.MatchString(p.Email.Value)) {
+		return &validationError{"email", "must be a valid email address"}
+	}
+	if p.DisplayName.Set && (p.DisplayName.Null || utf8.RuneCountInString(p.DisplayName.Value) > maxDisplayNameLength) {
+		return &validationError{"display_name", fmt.Sprintf("must be a string of at most %d characters", maxDisplayNameLength)}
+	}
+	if p.TimeZone.Set {
+		if p.TimeZone.Null {
+			return &validationError{"time_zone", "must be an IANA time zone name"}
+		}
+		if err := validateTimeZone(p.TimeZone.Value); err != nil {
+			return err
+		}
+	}
+	if p.Locale.Set && (p.Locale.Null || !localeRe.MatchString(p.Locale.Value)) {
+		return &validationError{"locale", "must be a language tag such as ru or en-US"}
+	}
+	return nil
+}
+
+func (p ProfilePatch) apply(profile *Profile) {
+	if p.Username.Set {
+		profile.Username = p.Username.Value
+	}
+	if p.Email.Set {
+		profile.Email = p.Email.Value
+	}
+	if p.DisplayName.Set {
+		profile.DisplayName = p.DisplayName.Value
+	}
+	if p.TimeZone.Set {
+		profile.TimeZone = p.TimeZone.Value
+	}
+	if p.Locale.Set {
+		profile.Locale = p.Locale.Value
+	}
+}
+
+// Частичное обновление пространства
+type WorkspacePatch struct {
+	Name        optional[string] `json:"name"`
+	DefaultRole optional[string] `json:"default_role"`
+}
+
+func (p WorkspacePatch) Validate() error {
+	if p.Name.Set && (p.Name.Null || p.Name.Value == "") {
+		return &validationError{"name", "must be a non-empty string"}
+	}
+	if p.DefaultRole.Set && (p.DefaultRole.Null || !validDefaultRole(p.DefaultRole.Value)) {
+		return &validationError{"default_role", "must be one of editor, viewer, none"}
+	}
+	return nil
+}
+
+func (p WorkspacePatch) apply(w *Workspace) {
+	if p.Name.Set {
+		w.Name = p.Name.Value
+	}
+	if p.DefaultRole.Set {
+		w.DefaultRole = p.DefaultRole.Value
+	}
+}
+
+// Частичное обновление страницы; null в content очищает содержимое
+type PagePatch struct {
+	Title   optional[string] `json:"title"`
+	Content optional[string] `json:"content"`
+}
+
+func (p PagePatch) Validate() error {
+	if p.Title.Set && p.Title.Null {
+		return &validationError{"title", "cannot be null"}
+	}
+	return nil
+}
+
+func (p PagePatch) apply(pg *Page) {
+	if p.Title.Set {
+		pg.Title = p.Title.Value
+	}
+	if p.Content.Set {
+		pg.Content = p.Content.Value
+	}
+}
+
+// Частичное обновление задачи; null в description очищает описание
+type TaskPatch struct {
+	Title       optional[string]    `json:"title"`
+	Description optional[string]    `json:"description"`
+	Status      optional[string]    `json:"status"`
+	Priority    optional[int]       `json:"priority"`
+	DueDate     optional[time.Time] `json:"due_date"`    // null снимает срок
+	DueAllDay   optional[bool]      `json:"due_all_day"` // сервер выставляет вместе с due_date уже нормализованными
+	Recurrence  optional[string]    `json:"recurrence"`  // null или "" отключает повторение
+
+	// Заполняются сервером при смене статуса: кто меняет и от какого статуса проверялся переход.
+	// Если статус в базе уже другой, хранилище возвращает ErrStatusConflict.
+	ChangedBy  int    `json:"-"`
+	FromStatus string `json:"-"`
+
+	// Рекурсивное завершение: новый статус получают и все подзадачи, кроме имеющих статус из CascadeSkip
+	Cascade     bool     `json:"-"`
+	CascadeSkip []string `json:"-"`
+
+	// Следующее повторение: создаётся в той же транзакции, если статус действительно сменился.
+	// Правило повторения переходит к новой задаче, у выполненной оно сбрасывается; метки копируются.
+	Next *Task `json:"-"`
+}
+
+func (p TaskPatch) Validate() error {
+	var errs []error
+	if p.Title.Set && (p.Title.Null || p.Title.Value == "") {
+		errs = append(errs, &validationError{"title", "must be a non-empty string"})
+	}
+	if p.Status.Set && (p.Status.Null || !taskWorkflow.Valid(p.Status.Value)) {
+		errs = append(errs, &validationError{"status", fmt.Sprintf("must be one of %v", taskWorkflow.Statuses())})
+	}
+	if p.Priority.Set && (p.Priority.Null || p.Priority.Value < minTaskPriority || p.Priority.Value > maxTaskPriority) {
+		errs = append(errs, &validationError{"priority", fmt.Sprintf("must be an integer from %d to %d", minTaskPriority, maxTaskPriority)})
+	}
+	if p.DueAllDay.Set && p.DueAllDay.Null {
+		errs = append(errs, &validationError{"due_all_day", "cannot be null"})
+	}
+	if p.Recurrence.Set && !p.Recurrence.Null {
+		if _, err := normalizeRecurrence(p.Recurrence.Value); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (p TaskPatch) apply(t *Task) {
+	if p.Title.Set {
+		t.Title = p.Title.Value
+	}
+	if p.Description.Set {
+		t.Description = p.Description.Value
+	}
+	if p.Status.Set {
+		t.Status = p.Status.Value
+	}
+	if p.Priority.Set {
+		t.Priority = p.Priority.Value
+	}
+	if p.DueDate.Set {
+		t.DueDate = p.dueDate()
+	}
+	if p.DueAllDay.Set {
+		t.DueAllDay = p.DueAllDay.Value
+	}
+	if p.Recurrence.Set {
+		t.Recurrence = p.Recurrence.Value
+	}
+}
+
+// Новый срок: nil, если передан null
+func (p TaskPatch) dueDate() *time.Time {
+	if p.DueDate.Null {
+		return nil
+	}
+	d := p.DueDate.Value
+	return &d
+}
+
+// Частичное обновление пункта чек-листа
+type ChecklistItemPatch struct {
+	Title    optional[string] `json:"title"`
+	Done     optional[bool]   `json:"done"`
+	Position optional[int]    `json:"position"`
+}
+
+func (p ChecklistItemPatch) Validate() error {
+	var errs []error
+	if p.Title.Set && (p.Title.Null || p.Title.Value == "") {
+		errs = append(errs, &validationError{"title", "must be a non-empty string"})
+	}
+	if p.Done.Set && p.Done.Null {
+		errs = append(errs, &validationError{"done", "cannot be null"})
+	}
+	if p.Position.Set && (p.Position.Null || p.Position.Value < 0) {
+		errs = append(errs, &validationError{"position", "must be a non-negative integer"})
+	}
+	return errors.Join(errs...)
+}
+
+func (p ChecklistItemPatch) apply(item *ChecklistItem) {
+	if p.Title.Set {
+		item.Title = p.Title.Value
+	}
+	if p.Done.Set {
+		item.Done = p.Done.Value
+	}
+	if p.Position.Set {
+		item.Position = p.Position.Value
+	}
+}
+
+// Частичное обновление метки
+type LabelPatch struct {
+	Name  optional[string] `json:"name"`
+	Color optional[string] `json:"color"`
+}
+
+func (p LabelPatch) Validate() error {
+	var errs []error
+	if p.Name.Set {
+		if p.Name.Null {
+			errs = append(errs, &validationError{"name", "cannot be null"})
+		} else if err := validateLabelName(p.Name.Value); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if p.Color.Set && (p.Color.Null || !labelColorRe.MatchString(p.Color.Value)) {
+		errs = append(errs, &validationError{"color", "must be a #rrggbb hex color"})
+	}
+	return errors.Join(errs...)
+}
+
+func (p LabelPatch) apply(l *Label) {
+	if p.Name.Set {
+		l.Name = p.Name.Value
+	}
+	if p.Color.Set {
+		l.Color = p.Color.Value
+	}
+}
+
+// Разбор тела PATCH-запроса: неизвестные поля — ошибка, чтобы опечатка не превращалась в пустое обновление
+func decodePatch(r io.Reader, patch interface{ Validate() error }) error {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(patch); err != nil {
+		return &validationError{"body", err.Error()}
+	}
+	return patch.Validate()
+}
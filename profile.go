@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"regexp"
+	"unicode/utf8"
+)
+
+const (
+	defaultLocale        = "ru" // Совпадает со значением по умолчанию users.locale
+	maxDisplayNameLength = 100
+	minPasswordLength    = 8
+)
+
+var (
+	emailRe  = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+	localeRe = regexp.MustCompile(`^[a-z]{2,3}(-[A-Z]{2})?$`)
+)
+
+// Страница профиля; данные она запрашивает через /api/profile
+func ProfileGetHandler(w http.ResponseWriter, r *http.Request) {
+	tmpl, err := template.ParseFiles("profile.html")
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	tmpl.Execute(w, nil)
+}
+
+// Проверка текущего пароля пользователя перед чувствительными операциями.
+// При ok = false ответ с ошибкой уже записан.
+func (s *server) checkCurrentPassword(w http.ResponseWriter, r *http.Request, userID int, password string) (User, bool) {
+	stored, err := s.storedUser(r.Context(), userID)
+	if err != nil {
+		writeAuthzError(w, err)
+		return User{}, false
+	}
+	ok, _, err := verifyPassword(stored.Password, password)
+	if err != nil {
+		log.Printf("Error verifying password of user %d: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return User{}, false
+	}
+	if !ok {
+		http.Error(w, "Current password is incorrect", http.StatusForbidden)
+		return User{}, false
+	}
+	return stored, true
+}
+
+// GET, PATCH и DELETE /api/profile
+func (s *server) profileHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := userIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		profile, err := s.users.GetProfile(r.Context(), userID)
+		if err != nil {
+			writeAuthzError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(profile)
+
+	case http.MethodPatch:
+		var patch ProfilePatch
+		if err := decodePatch(r.Body, &patch); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		profile, err := s.users.PatchProfile(r.Context(), userID, patch)
+		if errors.Is(err, ErrDuplicateKey) {
+			http.Error(w, "Account with this username or email already exists", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			writeAuthzError(w, err)
+			return
+		}
+		// Сменённый адрес нужно подтвердить
+		if patch.Email.Set && !profile.EmailVerified {
+			if err := s.sendEmailToken(r.Context(), userID, profile.Email, emailTokenVerify); err != nil {
+				log.Printf("Error sending verification email to user %d: %v", userID, err)
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(profile)
+
+	case http.MethodDelete:
+		var req struct {
+			Password string `json:"password"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if _, ok := s.checkCurrentPassword(w, r, userID, req.Password); !ok {
+			return
+		}
+		if err := s.users.DeleteUser(r.Context(), userID); err != nil {
+			log.Printf("Error deleting user %d: %v", userID, err)
+			writeAuthzError(w, err)
+			return
+		}
+		log.Printf("User %d deleted their account", userID)
+		clearRefreshCookie(w)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// POST /api/profile/password {"current_password": "...", "new_password": "..."}.
+// Остальные сессии завершаются, текущая получает новый refresh-токен.
+func (s *server) changePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	userID, err := userIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if utf8.RuneCountInString(req.NewPassword) < minPasswordLength {
+		http.Error(w, fmt.Sprintf("new_password: must be at least %d characters", minPasswordLength), http.StatusBadRequest)
+		return
+	}
+	stored, ok := s.checkCurrentPassword(w, r, userID, req.CurrentPassword)
+	if !ok {
+		return
+	}
+
+	err = rehashPassword(r.Context(), s.users, userID, stored.Password, req.NewPassword)
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Password was changed concurrently, try again", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error changing password of user %d: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if err := s.sessions.RevokeUserRefreshTokens(r.Context(), userID); err != nil {
+		log.Printf("Error revoking sessions of user %d: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	refreshToken, err := s.issueRefreshToken(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error issuing refresh token for user %d: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	setRefreshCookie(w, refreshToken)
+	w.WriteHeader(http.StatusNoContent)
+}
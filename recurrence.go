@@ -0,0 +1,313 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Предпросмотр повторений GET /api/tasks/{id}/occurrences
+const (
+	defaultOccurrenceLimit = 50
+	maxOccurrenceLimit     = 366
+	defaultOccurrenceRange = 90 * 24 * time.Hour
+	// Защита от бесконечного перебора, если from далеко от срока задачи
+	maxOccurrenceSteps = 100000
+)
+
+// Правило повторения задачи — подмножество RRULE (RFC 5545):
+//
+//	FREQ=DAILY;INTERVAL=2                    — каждые 2 дня
+//	FREQ=WEEKLY;BYDAY=MO,TH                  — по понедельникам и четвергам
+//	FREQ=MONTHLY;BYMONTHDAY=15               — 15-го числа (-1 — последний день месяца)
+//	FREQ=DAILY;INTERVAL=3;X-FROM=COMPLETION  — через 3 дня после выполнения
+//
+// Дни недели и месяца считаются в часовом поясе пользователя, у сроков без времени — по самой дате.
+// Если в месяце нет BYMONTHDAY (31-е в апреле), берётся последний день месяца.
+type Recurrence struct {
+	Freq           string // DAILY, WEEKLY, MONTHLY
+	Interval       int
+	ByDay          []time.Weekday // WEEKLY, по порядку начиная с понедельника
+	ByMonthDay     int            // MONTHLY: 1..31 или -1
+	FromCompletion bool           // только DAILY: отсчёт от момента выполнения, а не от срока
+}
+
+var rruleWeekdays = map[string]time.Weekday{
+	"MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday, "TH": time.Thursday,
+	"FR": time.Friday, "SA": time.Saturday, "SU": time.Sunday,
+}
+
+// Номер дня в неделе, начинающейся с понедельника (WKST=MO)
+func weekdayIndex(d time.Weekday) int {
+	return (int(d) + 6) % 7
+}
+
+func parseRecurrence(s string) (Recurrence, error) {
+	invalid := func(msg string) (Recurrence, error) {
+		return Recurrence{}, &validationError{"recurrence", msg}
+	}
+	r := Recurrence{Interval: 1}
+	seen := map[string]bool{}
+	for _, part := range strings.Split(strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(s)), "RRULE:"), ";") {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok || value == "" {
+			return invalid(fmt.Sprintf("malformed part %q", part))
+		}
+		if seen[key] {
+			return invalid(fmt.Sprintf("duplicate %s", key))
+		}
+		seen[key] = true
+
+		switch key {
+		case "FREQ":
+			if value != "DAILY" && value != "WEEKLY" && value != "MONTHLY" {
+				return invalid("FREQ must be one of DAILY, WEEKLY, MONTHLY")
+			}
+			r.Freq = value
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 || n > 1000 {
+				return invalid("INTERVAL must be an integer from 1 to 1000")
+			}
+			r.Interval = n
+		case "BYDAY":
+			days := map[time.Weekday]bool{}
+			for _, name := range strings.Split(value, ",") {
+				d, ok := rruleWeekdays[name]
+				if !ok {
+					return invalid(fmt.Sprintf("unknown BYDAY value %q", name))
+				}
+				if !days[d] {
+					days[d] = true
+					r.ByDay = append(r.ByDay, d)
+				}
+			}
+			sort.Slice(r.ByDay, func(i, j int) bool { return weekdayIndex(r.ByDay[i]) < weekdayIndex(r.ByDay[j]) })
+		case "BYMONTHDAY":
+			n, err := strconv.Atoi(value)
+			if err != nil || n == 0 || n < -1 || n > 31 {
+				return invalid("BYMONTHDAY must be from 1 to 31 or -1")
+			}
+			r.ByMonthDay = n
+		case "X-FROM":
+			if value != "COMPLETION" {
+				return invalid("X-FROM must be COMPLETION")
+			}
+			r.FromCompletion = true
+		default:
+			return invalid(fmt.Sprintf("unsupported rule part %s", key))
+		}
+	}
+
+	switch {
+	case r.Freq == "":
+		return invalid("FREQ is required")
+	case r.ByDay != nil && r.Freq != "WEEKLY":
+		return invalid("BYDAY is only supported with FREQ=WEEKLY")
+	case r.ByMonthDay != 0 && r.Freq != "MONTHLY":
+		return invalid("BYMONTHDAY is only supported with FREQ=MONTHLY")
+	case r.Freq == "MONTHLY" && r.ByMonthDay == 0:
+		return invalid("FREQ=MONTHLY requires BYMONTHDAY")
+	case r.FromCompletion && r.Freq != "DAILY":
+		return invalid("X-FROM=COMPLETION is only supported with FREQ=DAILY")
+	}
+	return r, nil
+}
+
+// Каноническая запись правила — в таком виде оно хранится в задаче
+func (r Recurrence) String() string {
+	parts := []string{"FREQ=" + r.Freq}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for i, d := range r.ByDay {
+			days[i] = strings.ToUpper(d.String()[:2])
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if r.ByMonthDay != 0 {
+		parts = append(parts, "BYMONTHDAY="+strconv.Itoa(r.ByMonthDay))
+	}
+	if r.FromCompletion {
+		parts = append(parts, "X-FROM=COMPLETION")
+	}
+	return strings.Join(parts, ";")
+}
+
+// Следующее повторение строго после prev; время суток в поясе loc сохраняется.
+// Для X-FROM=COMPLETION считается, что prev выполнено в срок.
+func (r Recurrence) Next(prev time.Time, loc *time.Location) time.Time {
+	prev = prev.In(loc)
+	switch r.Freq {
+	case "WEEKLY":
+		if len(r.ByDay) == 0 {
+			return prev.AddDate(0, 0, 7*r.Interval)
+		}
+		wd := weekdayIndex(prev.Weekday())
+		for _, d := range r.ByDay {
+			if idx := weekdayIndex(d); idx > wd {
+				return prev.AddDate(0, 0, idx-wd)
+			}
+		}
+		// Первый из дней через Interval недель
+		return prev.AddDate(0, 0, -wd+7*r.Interval+weekdayIndex(r.ByDay[0]))
+	case "MONTHLY":
+		if day := monthDay(prev.Year(), prev.Month(), r.ByMonthDay); day > prev.Day() {
+			return prev.AddDate(0, 0, day-prev.Day())
+		}
+		first := time.Date(prev.Year(), prev.Month()+time.Month(r.Interval), 1, prev.Hour(), prev.Minute(), prev.Second(), prev.Nanosecond(), loc)
+		return first.AddDate(0, 0, monthDay(first.Year(), first.Month(), r.ByMonthDay)-1)
+	default:
+		return prev.AddDate(0, 0, r.Interval)
+	}
+}
+
+// День месяца для BYMONTHDAY с учётом длины месяца
+func monthDay(year int, month time.Month, byMonthDay int) int {
+	last := time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	if byMonthDay == -1 || byMonthDay > last {
+		return last
+	}
+	return byMonthDay
+}
+
+// Срок повторения, создаваемого при выполнении задачи со сроком due в момент completedAt.
+// По расписанию берётся первое повторение после момента выполнения (пропущенные не создаются),
+// для X-FROM=COMPLETION — день выполнения плюс Interval дней в то же время суток, что и due.
+func (r Recurrence) NextOccurrence(due, completedAt time.Time, loc *time.Location) time.Time {
+	due, completedAt = due.In(loc), completedAt.In(loc)
+	if r.FromCompletion {
+		day := time.Date(completedAt.Year(), completedAt.Month(), completedAt.Day(), due.Hour(), due.Minute(), due.Second(), due.Nanosecond(), loc)
+		return day.AddDate(0, 0, r.Interval)
+	}
+	next := r.Next(due, loc)
+	for i := 0; i < maxOccurrenceSteps && !next.After(completedAt); i++ {
+		next = r.Next(next, loc)
+	}
+	return next
+}
+
+// Срок следующего повторения задачи t, выполненной в момент now пользователем из пояса loc.
+// Сроки без времени считаются по датам; задача без срока считается назначенной на сегодня без времени.
+func (r Recurrence) nextDue(t Task, now time.Time, loc *time.Location) (due time.Time, allDay bool) {
+	if t.DueDate == nil || t.DueAllDay {
+		today := civilDate(now.In(loc))
+		start := today
+		if t.DueDate != nil {
+			start = *t.DueDate
+		}
+		return r.NextOccurrence(start, today, time.UTC), true
+	}
+	return r.NextOccurrence(*t.DueDate, now, loc), false
+}
+
+// Повторения в интервале [from, to), начиная со срока start, не больше limit
+func (r Recurrence) Occurrences(start, from, to time.Time, limit int, loc *time.Location) []time.Time {
+	occurrences := []time.Time{}
+	t := start.In(loc)
+	for i := 0; i < maxOccurrenceSteps && t.Before(to) && len(occurrences) < limit; i++ {
+		if !t.Before(from) {
+			occurrences = append(occurrences, t)
+		}
+		t = r.Next(t, loc)
+	}
+	return occurrences
+}
+
+// Проверка правила из запроса; возвращает каноническую запись, пустое правило — без повторения
+func normalizeRecurrence(s string) (string, error) {
+	if strings.TrimSpace(s) == "" {
+		return "", nil
+	}
+	r, err := parseRecurrence(s)
+	if err != nil {
+		return "", err
+	}
+	return r.String(), nil
+}
+
+// GET /api/tasks/{id}/occurrences?from=&to=&limit= — ближайшие сроки повторяющейся задачи.
+// По умолчанию from — срок задачи (или текущий момент), to — from плюс 90 дней. У задачи без правила
+// единственное повторение — её срок.
+func (s *server) getTaskOccurrencesHandler(w http.ResponseWriter, r *http.Request) {
+	taskID, err := strconv.Atoi(strings.TrimSuffix(r.URL.Path[len("/api/tasks/"):], "/occurrences"))
+	if err != nil {
+		http.Error(w, "Invalid task_id format", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := userIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if _, err := s.authorizeTask(r.Context(), userID, taskID, roleViewer); err != nil {
+		writeAuthzError(w, err)
+		return
+	}
+	task, err := s.tasks.GetTask(r.Context(), taskID)
+	if err != nil {
+		writeAuthzError(w, err)
+		return
+	}
+
+	loc, err := s.userLocation(r.Context(), userID)
+	if err != nil {
+		http.Error(w, "Failed to load user time zone: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// Сроки без времени повторяются по датам; задача без срока повторяется начиная с сегодняшней даты
+	start := civilDate(time.Now().In(loc))
+	if task.DueDate != nil {
+		start = *task.DueDate
+	}
+	if task.DueDate == nil || task.DueAllDay {
+		loc = time.UTC
+	}
+
+	q := r.URL.Query()
+	from, to := start, time.Time{}
+	for name, dst := range map[string]*time.Time{"from": &from, "to": &to} {
+		if v := q.Get(name); v != "" {
+			if *dst, err = time.Parse(time.RFC3339, v); err != nil {
+				http.Error(w, name+": must be an RFC 3339 timestamp", http.StatusBadRequest)
+				return
+			}
+		}
+	}
+	if to.IsZero() {
+		to = from.Add(defaultOccurrenceRange)
+	}
+	if !to.After(from) {
+		http.Error(w, "to: must be after from", http.StatusBadRequest)
+		return
+	}
+	limit := defaultOccurrenceLimit
+	if v := q.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 || limit > maxOccurrenceLimit {
+			http.Error(w, fmt.Sprintf("limit: must be an integer from 1 to %d", maxOccurrenceLimit), http.StatusBadRequest)
+			return
+		}
+	}
+
+	occurrences := []time.Time{}
+	if task.Recurrence != "" {
+		rule, err := parseRecurrence(task.Recurrence)
+		if err != nil {
+			http.Error(w, "Stored recurrence rule is invalid: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		occurrences = rule.Occurrences(start, from, to, limit, loc)
+	} else if task.DueDate != nil && !task.DueDate.Before(from) && task.DueDate.Before(to) {
+		occurrences = append(occurrences, *task.DueDate)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(occurrences)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestParseRecurrence(t *testing.T) {
+	for in, want := range map[string]string{
+		"FREQ=DAILY":                              "FREQ=DAILY",
+		"rrule:freq=weekly;byday=th,mo,th":        "FREQ=WEEKLY;BYDAY=MO,TH",
+		"FREQ=MONTHLY;INTERVAL=1;BYMONTHDAY=-1":   "FREQ=MONTHLY;BYMONTHDAY=-1",
+		"INTERVAL=3;FREQ=DAILY;X-FROM=COMPLETION": "FREQ=DAILY;INTERVAL=3;X-FROM=COMPLETION",
+	} {
+		r, err := parseRecurrence(in)
+		require.NoError(t, err, in)
+		assert.Equal(t, want, r.String(), in)
+	}
+
+	for _, bad := range []string{
+		"", "FREQ=YEARLY", "INTERVAL=2", "FREQ=DAILY;INTERVAL=0", "FREQ=DAILY;FREQ=DAILY",
+		"FREQ=WEEKLY;BYDAY=XX", "FREQ=DAILY;BYDAY=MO", "FREQ=MONTHLY", "FREQ=MONTHLY;BYMONTHDAY=32",
+		"FREQ=WEEKLY;X-FROM=COMPLETION", "FREQ=DAILY;COUNT=5", "FREQ",
+	} {
+		_, err := parseRecurrence(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestRecurrenceNext(t *testing.T) {
+	day := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 9, 30, 0, 0, time.UTC) }
+	tests := []struct {
+		rule string
+		prev time.Time
+		want time.Time
+	}{
+		{"FREQ=DAILY;INTERVAL=2", day(2030, 1, 31), day(2030, 2, 2)},
+		{"FREQ=WEEKLY", day(2030, 1, 2), day(2030, 1, 9)},
+		{"FREQ=WEEKLY;BYDAY=MO,TH", day(2030, 1, 7), day(2030, 1, 10)},  // пн → чт той же недели
+		{"FREQ=WEEKLY;BYDAY=MO,TH", day(2030, 1, 10), day(2030, 1, 14)}, // чт → пн следующей
+		{"FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH", day(2030, 1, 10), day(2030, 1, 21)},
+		{"FREQ=WEEKLY;BYDAY=MO", day(2030, 1, 13), day(2030, 1, 14)}, // воскресенье — конец недели
+		{"FREQ=MONTHLY;BYMONTHDAY=31", day(2030, 1, 31), day(2030, 2, 28)},
+		{"FREQ=MONTHLY;BYMONTHDAY=31", day(2030, 2, 28), day(2030, 3, 31)},
+		{"FREQ=MONTHLY;BYMONTHDAY=15", day(2030, 1, 5), day(2030, 1, 15)},
+		{"FREQ=MONTHLY;INTERVAL=3;BYMONTHDAY=-1", day(2030, 11, 30), day(2031, 2, 28)},
+	}
+	for _, tt := range tests {
+		r, err := parseRecurrence(tt.rule)
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, r.Next(tt.prev, time.UTC), "%s after %s", tt.rule, tt.prev.Format(time.DateOnly))
+	}
+}
+
+func TestRecurrenceNextOccurrence(t *testing.T) {
+	due := time.Date(2030, 1, 7, 9, 0, 0, 0, time.UTC) // понедельник
+	late := time.Date(2030, 1, 22, 18, 0, 0, 0, time.UTC)
+
+	weekly, _ := parseRecurrence("FREQ=WEEKLY;BYDAY=MO")
+	assert.Equal(t, time.Date(2030, 1, 14, 9, 0, 0, 0, time.UTC), weekly.NextOccurrence(due, due, time.UTC))
+	assert.Equal(t, time.Date(2030, 1, 28, 9, 0, 0, 0, time.UTC), weekly.NextOccurrence(due, late, time.UTC), "Пропущенные повторения не создаются")
+
+	afterCompletion, _ := parseRecurrence("FREQ=DAILY;INTERVAL=3;X-FROM=COMPLETION")
+	assert.Equal(t, time.Date(2030, 1, 25, 9, 0, 0, 0, time.UTC), afterCompletion.NextOccurrence(due, late, time.UTC))
+}
+
+func TestRecurrenceOccurrences(t *testing.T) {
+	r, _ := parseRecurrence("FREQ=WEEKLY;BYDAY=MO,FR")
+	start := time.Date(2030, 1, 7, 9, 0, 0, 0, time.UTC)
+	from := time.Date(2030, 1, 10, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2030, 1, 22, 0, 0, 0, 0, time.UTC)
+
+	got := r.Occurrences(start, from, to, 10, time.UTC)
+	want := []time.Time{
+		time.Date(2030, 1, 11, 9, 0, 0, 0, time.UTC),
+		time.Date(2030, 1, 14, 9, 0, 0, 0, time.UTC),
+		time.Date(2030, 1, 18, 9, 0, 0, 0, time.UTC),
+		time.Date(2030, 1, 21, 9, 0, 0, 0, time.UTC),
+	}
+	assert.Equal(t, want, got)
+	assert.Len(t, r.Occurrences(start, from, to, 2, time.UTC), 2)
+	assert.Empty(t, r.Occurrences(start, to, to.Add(time.Hour), 10, time.UTC))
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Состояния напоминания
+const (
+	reminderPending = "pending" // ждёт срабатывания или повторной попытки
+	reminderSent    = "sent"
+	reminderFailed  = "failed"  // исчерпаны попытки отправки
+	reminderSkipped = "skipped" // задача к моменту срабатывания уже закрыта
+)
+
+// Каналы доставки напоминаний
+const (
+	channelInApp   = "in_app"
+	channelEmail   = "email"
+	channelWebhook = "webhook"
+)
+
+// Не дальше года до срока
+const maxReminderMinutesBefore = 366 * 24 * 60
+
+// Момент срабатывания напоминания за minutesBefore минут до срока задачи; nil, если срока нет.
+// Срок без времени отсчитывается от начала этой даты в часовом поясе пользователя.
+func relativeFireAt(t Task, minutesBefore int, loc *time.Location) *time.Time {
+	if t.DueDate == nil {
+		return nil
+	}
+	due := *t.DueDate
+	if t.DueAllDay {
+		due = time.Date(due.Year(), due.Month(), due.Day(), 0, 0, 0, 0, loc)
+	}
+	at := due.Add(-time.Duration(minutesBefore) * time.Minute)
+	return &at
+}
+
+func validateReminder(r Reminder) error {
+	if (r.RemindAt == nil) == (r.MinutesBefore == nil) {
+		return &validationError{"remind_at", "exactly one of remind_at and minutes_before is required"}
+	}
+	if r.MinutesBefore != nil && (*r.MinutesBefore < 0 || *r.MinutesBefore > maxReminderMinutesBefore) {
+		return &validationError{"minutes_before", fmt.Sprintf("must be between 0 and %d", maxReminderMinutesBefore)}
+	}
+	switch r.Channel {
+	case channelInApp, channelEmail:
+		if r.WebhookURL != "" {
+			return &validationError{"webhook_url", "allowed only for the webhook channel"}
+		}
+	case channelWebhook:
+		u, err := url.Parse(r.WebhookURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return &validationError{"webhook_url", "must be an absolute http or https URL"}
+		}
+		// Имена проверяются при отправке, после разрешения; IP-адрес можно отклонить сразу
+		if ip, err := netip.ParseAddr(strings.Trim(u.Hostname(), "[]")); err == nil && !isPublicAddr(ip) {
+			return &validationError{"webhook_url", "must not point to a private, loopback or link-local address"}
+		}
+	default:
+		return &validationError{"channel", fmt.Sprintf("must be one of [%s %s %s]", channelInApp, channelEmail, channelWebhook)}
+	}
+	return nil
+}
+
+// Обработчик напоминаний задачи:
+// GET и POST — /api/tasks/{id}/reminders, DELETE — /api/tasks/{id}/reminders/{reminderID}
+func (s *server) remindersHandler(w http.ResponseWriter, r *http.Request) {
+	taskID, reminderID, err := parseTaskItemPath(r.URL.Path, "/reminders")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	collection := r.Method == http.MethodGet || r.Method == http.MethodPost
+	if !(reminderID == 0 && collection || reminderID != 0 && r.Method == http.MethodDelete) {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := userIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	// Напоминания личные: участник с ролью viewer тоже может напомнить себе о задаче
+	if _, err := s.authorizeTask(r.Context(), userID, taskID, roleViewer); err != nil {
+		writeAuthzError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	switch r.Method {
+	case http.MethodGet:
+		reminders, err := s.reminders.ListReminders(r.Context(), taskID, userID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error fetching reminders: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if reminders == nil {
+			reminders = []Reminder{}
+		}
+		json.NewEncoder(w).Encode(reminders)
+
+	case http.MethodPost:
+		var req struct {
+			RemindAt      *time.Time `json:"remind_at"`
+			MinutesBefore *int       `json:"minutes_before"`
+			Channel       string     `json:"channel"`
+			WebhookURL    string     `json:"webhook_url"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		reminder := Reminder{
+			TaskID:        taskID,
+			UserID:        userID,
+			RemindAt:      req.RemindAt,
+			MinutesBefore: req.MinutesBefore,
+			Channel:       req.Channel,
+			WebhookURL:    req.WebhookURL,
+		}
+		if reminder.Channel == "" {
+			reminder.Channel = channelInApp
+		}
+		if err := validateReminder(reminder); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		created, err := s.reminders.CreateReminder(r.Context(), reminder)
+		if err != nil {
+			http.Error(w, "Failed to create reminder: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Location", fmt.Sprintf("/api/tasks/%d/reminders/%d", taskID, created.ID))
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(created)
+
+	case http.MethodDelete:
+		if err := s.reminders.DeleteReminder(r.Context(), taskID, userID, reminderID); err != nil {
+			writeAuthzError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"message": "Reminder deleted"})
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// На сколько захваченное напоминание скрывается от других экземпляров сервера.
+// Если экземпляр упал во время отправки, напоминание снова станет доступно по истечении этого срока.
+const reminderLease = 5 * time.Minute
+
+// Задача, пользователь и напоминание, о котором нужно сообщить
+type ReminderMessage struct {
+	Reminder Reminder
+	Task     Task
+	User     User
+}
+
+// Канал доставки напоминаний. Ошибка означает, что попытку нужно повторить позже.
+type Notifier interface {
+	Notify(ctx context.Context, msg ReminderMessage) error
+}
+
+// Фоновый планировщик напоминаний и уведомлений о сроках. Состояние хранится в базе, поэтому
+// переживает перезапуск, а захват строк с FOR UPDATE SKIP LOCKED (и ключи повтора уведомлений)
+// позволяют запускать его на нескольких экземплярах сразу.
+// Доставка «хотя бы один раз»: при падении после отправки напоминание может прийти повторно.
+type reminderScheduler struct {
+	reminders     ReminderStore
+	notifications NotificationStore
+	tasks         TaskStore
+	users         UserStore
+	notebooks     NotebookStore
+	workspaces    WorkspaceStore
+	channels      map[string]Notifier // канал → отправитель; ненастроенный канал сразу даёт failed
+	cfg           RemindersConfig
+	now           func() time.Time
+}
+
+func newReminderScheduler(st Store, cfg RemindersConfig) *reminderScheduler {
+	channels := map[string]Notifier{
+		channelInApp:   inAppNotifier{st},
+		channelWebhook: newWebhookNotifier(cfg.WebhookTimeout),
+	}
+	if cfg.SMTP.Host != "" {
+		channels[channelEmail] = newEmailNotifier(cfg.SMTP)
+	}
+	return &reminderScheduler{reminders: st, notifications: st, tasks: st, users: st, notebooks: st, workspaces: st, channels: channels, cfg: cfg, now: time.Now}
+}
+
+// Опрос наступивших напоминаний до отмены ctx
+func (s *reminderScheduler) Run(ctx context.Context) {
+	log.Printf("Планировщик напоминаний запущен (период %s)", s.cfg.Interval)
+	ticker := time.NewTicker(s.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		// Пока захватывается полная пачка, не ждём следующего тика
+		for {
+			n, err := s.runOnce(ctx)
+			if err != nil {
+				log.Printf("Ошибка планировщика напоминаний: %v", err)
+			}
+			if err != nil || n < s.cfg.BatchSize {
+				break
+			}
+		}
+		if err := s.notifyDueTasks(ctx); err != nil {
+			log.Printf("Ошибка уведомлений о сроках: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Одна пачка: захват и отправка. Возвращает число захваченных напоминаний.
+func (s *reminderScheduler) runOnce(ctx context.Context) (int, error) {
+	claimed, err := s.reminders.ClaimDueReminders(ctx, s.now(), s.cfg.BatchSize, reminderLease)
+	if err != nil {
+		return 0, err
+	}
+	for i := range claimed {
+		r := &claimed[i]
+		s.deliver(ctx, r)
+		if err := s.reminders.RecordReminderAttempt(ctx, *r); err != nil {
+			log.Printf("Ошибка сохранения результата напоминания %d: %v", r.ID, err)
+		}
+	}
+	return len(claimed), nil
+}
+
+// Отправка одного напоминания; результат записывается в r
+func (s *reminderScheduler) deliver(ctx context.Context, r *Reminder) {
+	task, err := s.tasks.GetTask(ctx, r.TaskID)
+	if err == nil && taskWorkflow.Closed(task.Status) {
+		r.Status, r.LastError = reminderSkipped, ""
+		return
+	}
+	// Пользователь мог потерять доступ к задаче: его убрали из пространства или сменили роль по умолчанию
+	if err == nil {
+		if _, err = s.tasks.TaskAccess(ctx, r.TaskID, r.UserID); errors.Is(err, ErrNotFound) {
+			r.Status, r.LastError = reminderSkipped, ""
+			return
+		}
+	}
+	var user User
+	if err == nil {
+		user, err = s.users.GetUser(ctx, r.UserID)
+	}
+	if err == nil {
+		notifier, ok := s.channels[r.Channel]
+		if !ok {
+			r.Status, r.LastError = reminderFailed, fmt.Sprintf("channel %s is not configured", r.Channel)
+			return
+		}
+		err = notifier.Notify(ctx, ReminderMessage{Reminder: *r, Task: task, User: user})
+	}
+
+	switch {
+	case err == nil:
+		now := s.now()
+		r.Status, r.LastError, r.SentAt = reminderSent, "", &now
+	case errors.Is(err, ErrNotFound) || r.Attempts >= s.cfg.MaxAttempts:
+		r.Status, r.LastError = reminderFailed, err.Error()
+		log.Printf("Напоминание %d не отправлено: %v", r.ID, err)
+	default:
+		r.Status, r.LastError = reminderPending, err.Error()
+		r.NextAttemptAt = s.now().Add(retryDelay(s.cfg.RetryDelay, r.Attempts))
+	}
+}
+
+// Уведомления «срок сегодня» и «просрочено» по незакрытым задачам всем, кто видит задачу:
+// владельцу и участникам блокнота. «Сегодня» — в часовом поясе каждого получателя.
+// Каждое уведомление создаётся один раз благодаря ключу повтора.
+func (s *reminderScheduler) notifyDueTasks(ctx context.Context) error {
+	now := s.now()
+	// Нижней границы нет: задачи, просроченные, пока планировщик не работал, тоже получат
+	// уведомление; уже отправленные отсекает ключ повтора
+	tasks, err := s.tasks.ListDueTasks(ctx, time.Time{}, now.Add(dueNotificationWindow))
+	if err != nil {
+		return err
+	}
+	users := map[int]User{}
+	readers := map[int][]int{} // блокнот → получатели
+	for _, t := range tasks {
+		ownerID, err := s.tasks.TaskOwnerID(ctx, t.ID)
+		if errors.Is(err, ErrNotFound) {
+			continue // задачу удалили после выборки
+		}
+		if err != nil {
+			return err
+		}
+		access, err := s.tasks.TaskAccess(ctx, t.ID, ownerID)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		recipients, ok := readers[access.NotebookID]
+		if !ok {
+			if recipients, err = notebookReaders(ctx, s.notebooks, s.workspaces, access.NotebookID); err != nil {
+				return err
+			}
+			readers[access.NotebookID] = recipients
+		}
+
+		for _, userID := range recipients {
+			user, ok := users[userID]
+			if !ok {
+				if user, err = s.users.GetUser(ctx, userID); err != nil {
+					return err
+				}
+				users[userID] = user
+			}
+			n, ok := dueNotification(t, newDueWindow(now, userLocation(user.TimeZone)))
+			if !ok {
+				continue
+			}
+			n.UserID = userID
+			if err := createNotificationOnce(ctx, s.notifications, n); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Экспоненциальная задержка перед попыткой attempts+1: base, 2×base, 4×base... но не больше суток
+func retryDelay(base time.Duration, attempts int) time.Duration {
+	delay := base
+	for i := 1; i < attempts && delay < 24*time.Hour; i++ {
+		delay *= 2
+	}
+	return min(delay, 24*time.Hour)
+}
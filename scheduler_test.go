@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/smtp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Канал, который отвечает ошибками из очереди, а затем успехом
+type fakeNotifier struct {
+	errs []error
+	sent []ReminderMessage
+}
+
+func (n *fakeNotifier) Notify(ctx context.Context, msg ReminderMessage) error {
+	if len(n.errs) > 0 {
+		err := n.errs[0]
+		n.errs = n.errs[1:]
+		return err
+	}
+	n.sent = append(n.sent, msg)
+	return nil
+}
+
+func TestReminderSchedulerRetries(t *testing.T) {
+	ctx := context.Background()
+	st := newMemoryStore()
+	user := seedUser(t, st)
+	task := seedTask(t, st, seedPage(t, st, seedNotebook(t, st, user.ID).ID).ID)
+
+	now := time.Date(2030, 1, 1, 9, 0, 0, 0, time.UTC)
+	at := now.Add(-time.Minute)
+	reminder, err := st.CreateReminder(ctx, Reminder{TaskID: task.ID, UserID: user.ID, RemindAt: &at, Channel: channelWebhook, WebhookURL: "https://example.com/hook"})
+	require.NoError(t, err)
+
+	notifier := &fakeNotifier{errs: []error{errors.New("boom"), errors.New("boom")}}
+	cfg := defaultConfig().Reminders
+	cfg.MaxAttempts = 3
+	s := &reminderScheduler{reminders: st, tasks: st, users: st, channels: map[string]Notifier{channelWebhook: notifier}, cfg: cfg, now: func() time.Time { return now }}
+
+	n, err := s.runOnce(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	stored := st.reminders[reminder.ID]
+	assert.Equal(t, reminderPending, stored.Status)
+	assert.Equal(t, "boom", stored.LastError)
+	assert.Equal(t, now.Add(cfg.RetryDelay), stored.NextAttemptAt)
+
+	n, _ = s.runOnce(ctx)
+	assert.Zero(t, n, "До следующей попытки напоминание не захватывается")
+
+	now = now.Add(time.Hour)
+	s.runOnce(ctx)
+	assert.Equal(t, now.Add(2*cfg.RetryDelay), st.reminders[reminder.ID].NextAttemptAt, "Задержка удваивается")
+
+	now = now.Add(time.Hour)
+	s.runOnce(ctx)
+	stored = st.reminders[reminder.ID]
+	assert.Equal(t, reminderSent, stored.Status)
+	assert.Equal(t, 3, stored.Attempts)
+	require.Len(t, notifier.sent, 1)
+	assert.Equal(t, task.ID, notifier.sent[0].Task.ID)
+	assert.Equal(t, user.ID, notifier.sent[0].User.ID)
+}
+
+func TestReminderSchedulerOutcomes(t *testing.T) {
+	ctx := context.Background()
+	st := newMemoryStore()
+	user := seedUser(t, st)
+	page := seedPage(t, st, seedNotebook(t, st, user.ID).ID)
+	now := time.Date(2030, 1, 1, 9, 0, 0, 0, time.UTC)
+	remind := func(task Task, channel string) Reminder {
+		at := now.Add(-time.Minute)
+		r, err := st.CreateReminder(ctx, Reminder{TaskID: task.ID, UserID: user.ID, RemindAt: &at, Channel: channel})
+		require.NoError(t, err)
+		return r
+	}
+
+	inApp := remind(seedTask(t, st, page.ID), channelInApp)
+	email := remind(seedTask(t, st, page.ID), channelEmail)
+	closedTask := seedTask(t, st, page.ID)
+	_, err := st.PatchTask(ctx, closedTask.ID, TaskPatch{Status: optional[string]{Set: true, Value: taskWorkflow.Completed}, FromStatus: closedTask.Status})
+	require.NoError(t, err)
+	closed := remind(closedTask, channelInApp)
+
+	cfg := defaultConfig().Reminders
+	s := newReminderScheduler(st, cfg) // SMTP не настроен — канала email нет
+	s.now = func() time.Time { return now }
+	n, err := s.runOnce(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+
+	assert.Equal(t, reminderSent, st.reminders[inApp.ID].Status)
+	require.Len(t, st.notifications, 1)
+	for _, notification := range st.notifications {
+		assert.Equal(t, user.ID, notification.UserID)
+		assert.Equal(t, "reminder", notification.Kind)
+		assert.Equal(t, "Напоминание: Test Task", notification.Title)
+	}
+	assert.Equal(t, reminderFailed, st.reminders[email.ID].Status)
+	assert.Contains(t, st.reminders[email.ID].LastError, "not configured")
+	assert.Equal(t, reminderSkipped, st.reminders[closed.ID].Status, "Закрытой задаче напоминание не нужно")
+}
+
+func TestNotifyDueTasks(t *testing.T) {
+	ctx := context.Background()
+	st := newMemoryStore()
+	user, viewer := seedUser(t, st), seedUser(t, st)
+	require.NoError(t, st.UpdateUserTimeZone(ctx, user.ID, "Europe/Moscow"))
+	notebook := seedNotebook(t, st, user.ID)
+	_, err := st.AddNotebookMember(ctx, NotebookMember{NotebookID: notebook.ID, UserID: viewer.ID, Role: roleViewer})
+	require.NoError(t, err)
+	page := seedPage(t, st, notebook.ID)
+	now := time.Date(2030, 3, 1, 22, 0, 0, 0, time.UTC) // в Москве уже 2 марта
+	create := func(title string, due time.Time, allDay bool) Task {
+		task, err := st.CreateTask(ctx, Task{PageID: page.ID, Title: title, Status: "todo", DueDate: &due, DueAllDay: allDay}, user.ID)
+		require.NoError(t, err)
+		return task
+	}
+	overdue := create("Late", now.Add(-time.Hour), false)
+	create("Today", time.Date(2030, 3, 2, 0, 0, 0, 0, time.UTC), true)
+	create("Next week", now.AddDate(0, 0, 7), false)
+	create("Missed during downtime", now.AddDate(0, 0, -5), false)
+
+	s := newReminderScheduler(st, defaultConfig().Reminders)
+	s.now = func() time.Time { return now }
+	require.NoError(t, s.notifyDueTasks(ctx))
+	require.NoError(t, s.notifyDueTasks(ctx), "Повторный запуск не дублирует уведомления")
+
+	notifications, err := st.ListNotifications(ctx, NotificationFilter{UserID: user.ID, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, notifications, 3)
+	kinds := map[string]string{}
+	for _, n := range notifications {
+		kinds[n.Title] = n.Kind
+	}
+	assert.Equal(t, map[string]string{
+		"Просрочено: Late":                   notificationOverdue,
+		"Просрочено: Missed during downtime": notificationOverdue,
+		"Срок сегодня: Today":                notificationDueToday,
+	}, kinds)
+
+	// Участник блокнота тоже получает уведомления; в UTC «Today» наступит только завтра
+	notifications, err = st.ListNotifications(ctx, NotificationFilter{UserID: viewer.ID, Limit: 10})
+	require.NoError(t, err)
+	assert.Len(t, notifications, 2)
+
+	// Перенос срока — новое уведомление, когда задача снова просрочена
+	_, err = st.PatchTask(ctx, overdue.ID, TaskPatch{DueDate: optional[time.Time]{Set: true, Value: now.Add(-time.Minute)}})
+	require.NoError(t, err)
+	require.NoError(t, s.notifyDueTasks(ctx))
+	count, err := st.UnreadNotificationCount(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 4, count)
+}
+
+func TestRetryDelay(t *testing.T) {
+	assert.Equal(t, time.Minute, retryDelay(time.Minute, 1))
+	assert.Equal(t, 4*time.Minute, retryDelay(time.Minute, 3))
+	assert.Equal(t, 24*time.Hour, retryDelay(time.Minute, 100), "Не больше суток")
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	var body string
+	status := http.StatusNoContent
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+		w.WriteHeader(status)
+	}))
+	defer hook.Close()
+
+	// Тестовый сервер слушает 127.0.0.1, поэтому здесь клиент без проверки адресов
+	n := webhookNotifier{client: hook.Client()}
+	msg := ReminderMessage{Reminder: Reminder{ID: 7, WebhookURL: hook.URL}, Task: Task{ID: 3, Title: "Report"}}
+	require.NoError(t, n.Notify(context.Background(), msg))
+	assert.Contains(t, body, `"event":"task.reminder"`)
+	assert.Contains(t, body, `"title":"Report"`)
+
+	status = http.StatusBadGateway
+	err := n.Notify(context.Background(), msg)
+	assert.ErrorIs(t, err, errWebhookDelivery, "Ответ не 2xx — повторить позже")
+	assert.NotContains(t, err.Error(), "502", "Ответ получателя не попадает в last_error")
+}
+
+func TestWebhookNotifierRefusesInternalAddresses(t *testing.T) {
+	calls := 0
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+	}))
+	defer hook.Close()
+
+	n := newWebhookNotifier(time.Second)
+	for _, url := range []string{hook.URL, strings.Replace(hook.URL, "127.0.0.1", "localhost", 1)} {
+		msg := ReminderMessage{Reminder: Reminder{ID: 7, WebhookURL: url}}
+		assert.ErrorIs(t, n.Notify(context.Background(), msg), errWebhookDelivery, url)
+	}
+	assert.Zero(t, calls, "Имя проверяется после разрешения в адрес")
+
+	for addr, public := range map[string]bool{
+		"127.0.0.1": false, "10.1.2.3": false, "192.168.0.1": false, "169.254.169.254": false,
+		"0.0.0.0": false, "224.0.0.1": false, "::1": false, "fe80::1": false, "fd00::1": false,
+		"::ffff:127.0.0.1": false, "93.184.216.34": true, "2606:4700::1111": true,
+	} {
+		assert.Equal(t, public, isPublicAddr(netip.MustParseAddr(addr)), addr)
+	}
+}
+
+func TestWebhookNotifierDoesNotFollowRedirects(t *testing.T) {
+	n := newWebhookNotifier(time.Second)
+	require.NotNil(t, n.client.CheckRedirect)
+	assert.ErrorIs(t, n.client.CheckRedirect(nil, nil), http.ErrUseLastResponse)
+}
+
+func TestEmailNotifier(t *testing.T) {
+	var from string
+	var to []string
+	var message string
+	n := emailNotifier{
+		cfg: SMTPConfig{Host: "smtp.example.com", Port: 587, From: "TaskFlow <noreply@example.com>"},
+		send: func(ctx context.Context, addr string, a smtp.Auth, f string, rcpt []string, msg []byte) error {
+			from, to, message = f, rcpt, string(msg)
+			return nil
+		},
+	}
+	msg := ReminderMessage{Task: Task{Title: "Отчёт\r\nBcc: evil@example.com"}, User: User{ID: 1, Email: "user@example.com"}}
+	require.NoError(t, n.Notify(context.Background(), msg))
+	assert.Equal(t, "noreply@example.com", from, "В конверте — адрес без имени")
+	assert.Equal(t, []string{"user@example.com"}, to)
+	assert.Contains(t, message, "Subject: =?utf-8?q?")
+	assert.NotContains(t, message, "\r\nBcc:", "Перевод строки в названии задачи не добавляет заголовков")
+	assert.True(t, strings.HasSuffix(message, "Срок не задан\r\n"))
+
+	msg.User.Email = ""
+	assert.ErrorIs(t, n.Notify(context.Background(), msg), ErrNotFound)
+}
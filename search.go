@@ -0,0 +1,74 @@
+package main
+
+import (
+	"html"
+	"strings"
+	"unicode"
+)
+
+// Размер выдачи GET /api/search
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+// Маркеры совпадений, которые ts_headline вставляет в сниппет. Это символы из области частного
+// использования, а не теги: сниппет сначала экранируется, потом маркеры заменяются на <mark>,
+// поэтому пользовательский текст не может внедрить в выдачу HTML.
+const (
+	headlineStartSel = "\uE000"
+	headlineStopSel  = "\uE001"
+)
+
+var headlineOptions = "StartSel=" + headlineStartSel + ", StopSel=" + headlineStopSel + ", MaxWords=25, MinWords=8, MaxFragments=2"
+
+// Сниппет ts_headline → HTML: текст экранирован, совпадения в <mark>
+func renderHeadline(s string) string {
+	s = html.EscapeString(s)
+	s = strings.ReplaceAll(s, headlineStartSel, "<mark>")
+	return strings.ReplaceAll(s, headlineStopSel, "</mark>")
+}
+
+// Слова поискового запроса в нижнем регистре — для хранилища в памяти
+func searchTerms(q string) []string {
+	return strings.FieldsFunc(strings.ToLower(q), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// Простейший аналог @@ и ts_headline для хранилища в памяти: все слова запроса должны
+// встречаться в тексте как подстроки; ранг — число вхождений
+func matchTerms(text string, terms []string) (rank float64, snippet string, ok bool) {
+	lower := strings.ToLower(text)
+	if len(terms) == 0 {
+		return 0, "", false
+	}
+	for _, term := range terms {
+		n := strings.Count(lower, term)
+		if n == 0 {
+			return 0, "", false
+		}
+		rank += float64(n)
+	}
+
+	// Выделение совпадений по позициям в исходном тексте
+	var b strings.Builder
+	runes, lowerRunes := []rune(text), []rune(lower)
+	for i := 0; i < len(runes); {
+		matched := 0
+		for _, term := range terms {
+			tr := []rune(term)
+			if i+len(tr) <= len(lowerRunes) && string(lowerRunes[i:i+len(tr)]) == term && len(tr) > matched {
+				matched = len(tr)
+			}
+		}
+		if matched > 0 {
+			b.WriteString(headlineStartSel + string(runes[i:i+matched]) + headlineStopSel)
+			i += matched
+			continue
+		}
+		b.WriteRune(runes[i])
+		i++
+	}
+	return rank, renderHeadline(b.String()), true
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestRenderHeadlineEscapesHTML(t *testing.T) {
+	got := renderHeadline("<script>x</script> " + headlineStartSel + "отчёт" + headlineStopSel)
+	assert.Equal(t, "&lt;script&gt;x&lt;/script&gt; <mark>отчёт</mark>", got)
+}
+
+func TestMatchTerms(t *testing.T) {
+	rank, snippet, ok := matchTerms("Квартальный отчёт и Report", searchTerms("ОТЧЁТ report"))
+	assert.True(t, ok)
+	assert.Equal(t, 2.0, rank)
+	assert.Equal(t, "Квартальный <mark>отчёт</mark> и <mark>Report</mark>", snippet)
+
+	_, _, ok = matchTerms("Квартальный отчёт", searchTerms("отчёт бюджет"))
+	assert.False(t, ok, "Должны встречаться все слова запроса")
+}
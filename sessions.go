@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// Сессии на refresh-токенах.
+// Каждый вход открывает семейство (family) токенов; при обновлении старый токен помечается
+// использованным и выдаётся новый из того же семейства. Повторное предъявление использованного
+// токена означает его утечку — всё семейство отзывается.
+
+const refreshCookieName = "refreshToken"
+
+var (
+	ErrRefreshTokenInvalid = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected")
+
+	refreshCookieSecure = true // Refresh-кука передаётся только по HTTPS (localhost браузеры считают безопасным)
+)
+
+// Случайный идентификатор в hex
+func randomID(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// В базе хранится только SHA-256 токена
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Подписанный refresh-токен и запись для хранилища
+func newRefreshToken(userID int, familyID string) (string, RefreshToken, error) {
+	token, expiresAt, err := generateRefreshToken(strconv.Itoa(userID), familyID)
+	if err != nil {
+		return "", RefreshToken{}, err
+	}
+	return token, RefreshToken{
+		UserID:    userID,
+		FamilyID:  familyID,
+		TokenHash: hashToken(token),
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+// Выдача refresh-токена новой сессии
+func (s *server) issueRefreshToken(ctx context.Context, userID int) (string, error) {
+	familyID, err := randomID(16)
+	if err != nil {
+		return "", fmt.Errorf("ошибка генерации семейства токенов: %v", err)
+	}
+	token, record, err := newRefreshToken(userID, familyID)
+	if err != nil {
+		return "", err
+	}
+	if err := s.sessions.CreateRefreshToken(ctx, record); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Одноразовая ротация: предъявленный токен помечается использованным, взамен выдаётся новый.
+func (s *server) rotateRefreshToken(ctx context.Context, token string) (newToken string, userID int, err error) {
+	claims, err := validateToken(token, refreshSecret)
+	if err != nil {
+		return "", 0, ErrRefreshTokenInvalid
+	}
+	userIDStr, _ := claims["userID"].(string)
+	familyID, _ := claims["family"].(string)
+	userID, err = strconv.Atoi(userIDStr)
+	if err != nil || familyID == "" {
+		return "", 0, ErrRefreshTokenInvalid
+	}
+
+	newToken, record, err := newRefreshToken(userID, familyID)
+	if err != nil {
+		return "", 0, err
+	}
+	err = s.sessions.RotateRefreshToken(ctx, hashToken(token), record)
+	if errors.Is(err, ErrRefreshTokenReused) {
+		log.Printf("Refresh token reuse detected for user %d, family %s revoked", userID, familyID)
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	return newToken, userID, nil
+}
+
+func setRefreshCookie(w http.ResponseWriter, token string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     refreshCookieName,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   int(refreshTokenTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   refreshCookieSecure,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+func clearRefreshCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     refreshCookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   refreshCookieSecure,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
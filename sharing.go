@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Роль, которую можно выдать участнику: владелец назначается только передачей
+func validMemberRole(role string) bool {
+	return role == roleEditor || role == roleViewer
+}
+
+// {prefix}{id}/members и {prefix}{id}/members/{userID}, например prefix = "/api/notebooks/"
+func parseMembersPath(path, prefix, idName string) (id, memberID int, err error) {
+	rest := strings.TrimPrefix(path, prefix)
+	idStr, rest, _ := strings.Cut(rest, "/members")
+	if id, err = strconv.Atoi(idStr); err != nil {
+		return 0, 0, fmt.Errorf("Invalid %s format", idName)
+	}
+	if rest = strings.Trim(rest, "/"); rest != "" {
+		if memberID, err = strconv.Atoi(rest); err != nil {
+			return 0, 0, fmt.Errorf("Invalid user_id format")
+		}
+	}
+	return id, memberID, nil
+}
+
+// Объединение получателей до и после изменения состава: бывший участник тоже узнаёт, что доступа больше нет
+func mergeAudience(a, b []int) []int {
+	seen := make(map[int]bool, len(a)+len(b))
+	var out []int
+	for _, id := range append(append([]int{}, a...), b...) {
+		if !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// Событие об изменении участников блокнота
+func (s *server) publishMembersChanged(ctx context.Context, notebookID int, before []int) {
+	s.publishTo(ctx, mergeAudience(before, s.notebookAudience(ctx, notebookID)), "notebook", eventUpdated, notebookID, nil)
+}
+
+// Обработчик участников блокнота:
+// GET и POST — /api/notebooks/{id}/members, PATCH и DELETE — /api/notebooks/{id}/members/{userID}
+func (s *server) notebookMembersHandler(w http.ResponseWriter, r *http.Request) {
+	notebookID, memberID, err := parseMembersPath(r.URL.Path, "/api/notebooks/", "notebook_id")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	collection := r.Method == http.MethodGet || r.Method == http.MethodPost
+	item := r.Method == http.MethodPatch || r.Method == http.MethodDelete
+	if !(memberID == 0 && collection || memberID != 0 && item) {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := userIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	// Список виден всем участникам, состав меняет владелец; покинуть блокнот может любой участник
+	need := roleOwner
+	if r.Method == http.MethodGet || r.Method == http.MethodDelete && memberID == userID {
+		need = roleViewer
+	}
+	access, err := s.authorizeNotebook(r.Context(), userID, notebookID, need)
+	if err != nil {
+		writeAuthzError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	switch r.Method {
+	case http.MethodGet:
+		members, err := s.notebooks.ListNotebookMembers(r.Context(), notebookID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error fetching members: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if members == nil {
+			members = []NotebookMember{}
+		}
+		json.NewEncoder(w).Encode(members)
+
+	case http.MethodPost:
+		s.inviteMember(w, r, notebookID, userID)
+
+	case http.MethodPatch:
+		var req struct {
+			Role string `json:"role"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if memberID == userID {
+			http.Error(w, "role: owner role can only be changed by transferring ownership", http.StatusBadRequest)
+			return
+		}
+		if !validMemberRole(req.Role) {
+			http.Error(w, "role: must be one of editor, viewer", http.StatusBadRequest)
+			return
+		}
+		member, err := s.notebooks.UpdateNotebookMemberRole(r.Context(), notebookID, memberID, req.Role)
+		if err != nil {
+			writeAuthzError(w, err)
+			return
+		}
+		s.publishMembersChanged(r.Context(), notebookID, nil)
+		json.NewEncoder(w).Encode(member)
+
+	case http.MethodDelete:
+		if access.Role == roleOwner && memberID == userID {
+			http.Error(w, "Owner cannot leave the notebook; transfer ownership first", http.StatusBadRequest)
+			return
+		}
+		before := s.notebookAudience(r.Context(), notebookID)
+		if err := s.notebooks.RemoveNotebookMember(r.Context(), notebookID, memberID); err != nil {
+			writeAuthzError(w, err)
+			return
+		}
+		s.publishMembersChanged(r.Context(), notebookID, before)
+		json.NewEncoder(w).Encode(map[string]string{"message": "Member removed"})
+	}
+}
+
+// Ответ на приглашение по email один и тот же для зарегистрированных, неизвестных и уже
+// приглашённых адресов: иначе по нему можно было бы узнать, есть ли у адреса аккаунт
+func writeEmailInviteAccepted(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"message": "If this email belongs to a registered user, they have been added"})
+}
+
+// POST /api/notebooks/{id}/members: приглашение по username или email.
+// По username — 201 с участником; по email — всегда 202, см. writeEmailInviteAccepted
+func (s *server) inviteMember(w http.ResponseWriter, r *http.Request, notebookID, ownerID int) {
+	var req struct {
+		Username string `json:"username"`
+		Email    string `json:"email"`
+		Role     string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if (req.Username == "") == (req.Email == "") {
+		http.Error(w, "username: exactly one of username or email is required", http.StatusBadRequest)
+		return
+	}
+	if req.Role == "" {
+		req.Role = roleViewer
+	}
+	if !validMemberRole(req.Role) {
+		http.Error(w, "role: must be one of editor, viewer", http.StatusBadRequest)
+		return
+	}
+
+	var invitee User
+	var err error
+	if req.Username != "" {
+		invitee, err = s.users.GetUserByUsername(r.Context(), req.Username)
+	} else {
+		invitee, err = s.users.GetUserByEmail(r.Context(), req.Email)
+	}
+	if errors.Is(err, ErrNotFound) && req.Email != "" {
+		writeEmailInviteAccepted(w)
+		return
+	}
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error looking up invitee: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	member, err := s.notebooks.AddNotebookMember(r.Context(), NotebookMember{
+		NotebookID: notebookID,
+		UserID:     invitee.ID,
+		Role:       req.Role,
+		InvitedBy:  &ownerID,
+	})
+	if errors.Is(err, ErrDuplicateKey) && req.Email != "" {
+		writeEmailInviteAccepted(w)
+		return
+	}
+	if errors.Is(err, ErrDuplicateKey) {
+		http.Error(w, "User already has access to this notebook", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error adding notebook member: %v", err)
+		http.Error(w, "Failed to add member", http.StatusInternalServerError)
+		return
+	}
+
+	// Уведомление приглашённому; ошибка не отменяет приглашение
+	if notebook, err := s.notebooks.GetNotebook(r.Context(), notebookID); err == nil {
+		n := Notification{
+			UserID:    invitee.ID,
+			Kind:      notificationShared,
+			Title:     "Вам открыт доступ к блокноту: " + notebook.Name,
+			DedupeKey: fmt.Sprintf("%s:%d:%d", notificationShared, notebookID, member.CreatedAt.UnixNano()),
+		}
+		if err := createNotificationOnce(r.Context(), s.notifications, n); err != nil {
+			log.Printf("Ошибка создания уведомления о доступе к блокноту %d: %v", notebookID, err)
+		}
+	}
+	s.publishMembersChanged(r.Context(), notebookID, nil)
+
+	if req.Email != "" {
+		writeEmailInviteAccepted(w)
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("/api/notebooks/%d/members/%d", notebookID, invitee.ID))
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(member)
+}
+
+// POST /api/notebooks/{id}/transfer: передача владения участнику, прежний владелец становится редактором
+func (s *server) transferNotebookHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	idStr := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/notebooks/"), "/transfer")
+	notebookID, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "Invalid notebook_id format", http.StatusBadRequest)
+		return
+	}
+	userID, err := userIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if _, err := s.authorizeNotebook(r.Context(), userID, notebookID, roleOwner); err != nil {
+		writeAuthzError(w, err)
+		return
+	}
+
+	var req struct {
+		UserID int `json:"user_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.UserID == userID {
+		http.Error(w, "user_id: you already own this notebook", http.StatusBadRequest)
+		return
+	}
+	err = s.notebooks.TransferNotebookOwnership(r.Context(), notebookID, userID, req.UserID)
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "user_id: must be a member of the notebook", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("Error transferring notebook %d: %v", notebookID, err)
+		http.Error(w, "Failed to transfer ownership", http.StatusInternalServerError)
+		return
+	}
+	s.publishMembersChanged(r.Context(), notebookID, nil)
+
+	members, err := s.notebooks.ListNotebookMembers(r.Context(), notebookID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error fetching members: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(members)
+}
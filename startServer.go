@@ -1,17 +1,56 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
+	"strings"
 )
 
-func startServer() {
+func startServer(cfg Config) {
 
-	if err := initDB(); err != nil {
+	pool, err := initDB()
+	if err != nil {
 		log.Fatalf("Ошибка подключения к базе данных: %v", err)
 	}
-	defer closeDB()
+	defer pool.Close()
 
+	if cfg.Database.AutoMigrate {
+		if _, err := migrateUp(context.Background(), pool); err != nil {
+			log.Fatalf("Ошибка миграции базы данных: %v", err)
+		}
+	}
+
+	st := newPgStore(pool)
+	srv := newServer(st)
+	srv.mailer = newMailer(cfg)
+	if cfg.Auth.LoginThrottle.Store == loginThrottleMemory {
+		srv.loginThrottle = newMemoryLoginThrottle()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srv.hub = newEventHub(cfg.Events.ReplaySize)
+	srv.events = srv.hub
+	srv.heartbeat = cfg.Events.Heartbeat
+	if cfg.Events.PGNotify {
+		bus := newPgEventBus(pool, srv.hub)
+		srv.events = bus
+		go bus.Listen(ctx)
+	}
+
+	if cfg.Reminders.Enabled {
+		go newReminderScheduler(st, cfg.Reminders).Run(ctx)
+	}
+
+	log.Printf("Сервер запущен на %s (окружение %s)", cfg.Server.Addr(), cfg.Env)
+	if err := http.ListenAndServe(cfg.Server.Addr(), srv.routes()); err != nil {
+		log.Fatalf("Ошибка запуска сервера: %v", err)
+	}
+}
+
+// Сборка всех маршрутов приложения вместе с middleware
+func (s *server) routes() http.Handler {
 	mux := http.NewServeMux()
 
 	mux.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("static"))))
@@ -30,54 +69,78 @@ func startServer() {
 		case http.MethodGet:
 			LogInGetHandler(w, r)
 		case http.MethodPost:
-			LoginPostHandler(w, r)
+			s.LoginPostHandler(w, r)
 		default:
 			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 		}
 	})
 
+	// Второй шаг входа при подключённой 2FA
+	handleRoute(mux, "/login/2fa", s.loginTwoFactorHandler)
+
 	handleRoute(mux, "/signup", func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodGet:
 			SignUpGetHandler(w, r)
 		case http.MethodPost:
-			SignUpPostHandler(w, r)
+			s.SignUpPostHandler(w, r)
 		default:
 			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 		}
 	})
 
+	// Подтверждение email и сброс пароля — без авторизации, по токену из письма
+	handleRoute(mux, "/verify-email", s.verifyEmailHandler)
+	handleRoute(mux, "/password/forgot", s.forgotPasswordHandler)
+	handleRoute(mux, "/password/reset", s.resetPasswordHandler)
+
 	api := http.NewServeMux()
 
 	api.HandleFunc("/api/notebooks/", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodPut {
-			updateNotebookHandler(w, r)
+		if strings.Contains(r.URL.Path, "/members") {
+			s.notebookMembersHandler(w, r)
+		} else if strings.HasSuffix(r.URL.Path, "/transfer") {
+			s.transferNotebookHandler(w, r)
+		} else if r.Method == http.MethodGet {
+			s.getNotebookHandler(w, r)
+		} else if r.Method == http.MethodPut {
+			s.updateNotebookHandler(w, r)
+		} else if r.Method == http.MethodPatch {
+			s.patchNotebookHandler(w, r)
 		} else if r.Method == http.MethodDelete {
-			deleteNotebookHandler(w, r)
+			s.deleteNotebookHandler(w, r)
+		} else {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 		}
 	})
 
 	api.HandleFunc("/api/notebooks", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == http.MethodGet {
-			getNotebooksHandler(w, r)
+			s.getNotebooksHandler(w, r)
 		} else if r.Method == http.MethodPost {
-			createNotebookHandler(w, r)
+			s.createNotebookHandler(w, r)
 		} else if r.Method == http.MethodPut {
-			updateNotebookHandler(w, r)
+			s.updateNotebookHandler(w, r)
 		} else {
 			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 		}
 	})
 
 	api.HandleFunc("/api/pages/", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodGet {
-			getPagesHandler(w, r)
+		if strings.HasPrefix(r.URL.Path, pageByIDPrefix) {
+			s.getPageHandler(w, r)
+		} else if strings.HasSuffix(r.URL.Path, "/labels") {
+			s.pageLabelsHandler(w, r)
+		} else if r.Method == http.MethodGet {
+			s.getPagesHandler(w, r)
 		} else if r.Method == http.MethodPost {
-			createPageHandler(w, r)
+			s.createPageHandler(w, r)
 		} else if r.Method == http.MethodPut {
-			updatePagesHandler(w, r)
+			s.updatePagesHandler(w, r)
+		} else if r.Method == http.MethodPatch {
+			s.patchPageHandler(w, r)
 		} else if r.Method == http.MethodDelete {
-			deletePagesHandler(w, r)
+			s.deletePagesHandler(w, r)
 		} else {
 			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 		}
@@ -86,7 +149,7 @@ func startServer() {
 	/*	api.HandleFunc("/refresh-token", func(w http.ResponseWriter, r *http.Request) {
 			if r.Method == http.MethodPost {
 				log.Printf("POST /refresh-token")
-				refreshTokenHandler(w, r)
+				s.refreshTokenHandler(w, r)
 			}
 		})
 	*/
@@ -94,43 +157,127 @@ func startServer() {
 	mux.HandleFunc("/refresh-token", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == http.MethodPost {
 			log.Printf("POST /refresh-token")
-			refreshTokenHandler(w, r)
+			s.refreshTokenHandler(w, r)
 		} else {
 			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 		}
 	})
 
-	api.HandleFunc("/api/tasks/", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/logout", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			s.logoutHandler(w, r)
+		} else {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.Handle("/logout-all", s.tokenAuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			s.logoutAllHandler(w, r)
+		} else {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	})))
+
+	api.HandleFunc("/api/search", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == http.MethodGet {
-			getTasksHandler(w, r)
+			s.searchHandler(w, r)
+		} else {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	// Профиль
+	api.HandleFunc("/api/profile", s.profileHandler)
+	api.HandleFunc("/api/profile/password", s.changePasswordHandler)
+	api.HandleFunc("/api/profile/2fa", s.twoFactorHandler)
+	api.HandleFunc("/api/profile/2fa/confirm", s.confirmTwoFactorHandler)
+	api.HandleFunc("/api/profile/2fa/recovery-codes", s.recoveryCodesHandler)
+	api.HandleFunc("/api/profile/login-attempts", s.loginAttemptsHandler)
+	api.HandleFunc("/api/profile/time-zone", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut {
+			s.updateTimeZoneHandler(w, r)
+		} else {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	// Персональные токены доступа
+	api.HandleFunc("/api/tokens", s.accessTokensHandler)
+	api.HandleFunc("/api/tokens/", s.accessTokenHandler)
+
+	// Поток событий; токен можно передать в ?access_token= (см. queryTokenMiddleware)
+	api.HandleFunc("/api/events", s.eventsHandler)
+
+	// Уведомления
+	api.HandleFunc("/api/notifications", s.notificationsHandler)
+	api.HandleFunc("/api/notifications/", s.notificationHandler)
+
+	// Пространства
+	api.HandleFunc("/api/workspaces", s.workspacesHandler)
+	api.HandleFunc("/api/workspaces/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/workspaces/current" {
+			s.currentWorkspaceHandler(w, r)
+		} else if strings.Contains(r.URL.Path, "/members") {
+			s.workspaceMembersHandler(w, r)
+		} else {
+			s.workspaceHandler(w, r)
+		}
+	})
+
+	// Метки
+	api.HandleFunc("/api/labels", s.labelsHandler)
+	api.HandleFunc("/api/labels/", s.labelHandler)
+
+	api.HandleFunc("/api/tasks", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			s.listTasksHandler(w, r)
+		} else {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	api.HandleFunc("/api/tasks/", func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, taskByIDPrefix) {
+			s.getTaskHandler(w, r)
+		} else if strings.Contains(r.URL.Path, "/checklist") {
+			s.checklistHandler(w, r)
+		} else if strings.Contains(r.URL.Path, "/reminders") {
+			s.remindersHandler(w, r)
+		} else if strings.HasSuffix(r.URL.Path, "/labels") {
+			s.taskLabelsHandler(w, r)
+		} else if r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/history") {
+			s.getTaskHistoryHandler(w, r)
+		} else if r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/occurrences") {
+			s.getTaskOccurrencesHandler(w, r)
+		} else if r.Method == http.MethodGet {
+			s.getTasksHandler(w, r)
 		} else if r.Method == http.MethodPost {
-			createTaskHandler(w, r)
+			s.createTaskHandler(w, r)
 		} else if r.Method == http.MethodPut {
-			updateTasksHandler(w, r)
+			s.updateTasksHandler(w, r)
+		} else if r.Method == http.MethodPatch {
+			s.patchTaskHandler(w, r)
 		} else if r.Method == http.MethodDelete {
-			deleteTasksHandler(w, r)
+			s.deleteTasksHandler(w, r)
 		} else {
 			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 		}
 	})
-	// Профиль
+	// Страница профиля
 	handleRoute(mux, "/profile", func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodGet:
-			//ProfileGetHandler(w, r)
+			ProfileGetHandler(w, r)
 		default:
 			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 		}
 	})
 
-	apiWithAuth := tokenAuthMiddleware(api)
+	apiWithAuth := s.tokenAuthMiddleware(api)
 
 	mux.Handle("/api/", apiWithAuth)
+	mux.Handle("/api/events", queryTokenMiddleware(apiWithAuth))
 
-	handlerWithMiddlewares := generalMiddleware(mux)
-
-	log.Println("Сервер запущен на http://localhost:8080")
-	if err := http.ListenAndServe(":8080", handlerWithMiddlewares); err != nil {
-		log.Fatalf("Ошибка запуска сервера: %v", err)
-	}
+	return generalMiddleware(mux)
 }
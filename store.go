@@ -0,0 +1,322 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Хранилища данных. Обработчики работают только через эти интерфейсы;
+// реализации — pgStore (PostgreSQL, database.go) и memoryStore (в памяти, memory_store.go).
+// Отсутствующие записи возвращаются как ErrNotFound.
+// Create/Update возвращают сохранённую запись: id, created_at, updated_at и значения по умолчанию.
+
+type UserStore interface {
+	// Пароль в user.Password уже должен быть захеширован
+	CreateUser(ctx context.Context, user User) error
+	// Пользователь вместе с сохранённым хешем пароля
+	GetUserByUsername(ctx context.Context, username string) (User, error)
+	GetUser(ctx context.Context, userID int) (User, error)
+	GetUserByEmail(ctx context.Context, email string) (User, error)
+	UpdateUserTimeZone(ctx context.Context, userID int, timeZone string) error
+	// Замена хеша пароля, только если он не изменился с момента чтения; иначе ErrNotFound
+	UpdatePasswordHash(ctx context.Context, userID int, oldHash, newHash string) error
+	GetProfile(ctx context.Context, userID int) (Profile, error)
+	// Занятые username или email — ErrDuplicateKey
+	PatchProfile(ctx context.Context, userID int, patch ProfilePatch) (Profile, error)
+	// Удаление пользователя со всеми его данными, включая его блокноты в общих пространствах.
+	// Пространства, где он единственный участник, удаляются; где единственный администратор —
+	// администратором становится участник, вступивший раньше остальных.
+	DeleteUser(ctx context.Context, userID int) error
+	// Подтверждение email, если адрес пользователя не сменился после отправки письма; иначе ErrNotFound
+	MarkEmailVerified(ctx context.Context, userID int, email string) error
+}
+
+// Двухфакторная аутентификация: секрет TOTP и хеши кодов восстановления
+type TwoFactorStore interface {
+	// Без секрета — ErrNotFound
+	GetTOTP(ctx context.Context, userID int) (TOTPSecret, error)
+	// Новый неподтверждённый секрет взамен прежнего; если 2FA уже подключена — ErrDuplicateKey
+	SetTOTPSecret(ctx context.Context, userID int, secret string) error
+	// Подтверждение подключения; коды восстановления заменяются на recoveryHashes
+	ConfirmTOTP(ctx context.Context, userID int, recoveryHashes []string) error
+	// Отметка использованного шага: код с тем же или более ранним шагом — ErrNotFound
+	UseTOTPStep(ctx context.Context, userID int, step int64) error
+	// Погашение кода восстановления; неизвестный или использованный — ErrNotFound
+	UseRecoveryCode(ctx context.Context, userID int, codeHash string) error
+	// Погашение токена второго шага входа по jti; повторное — ErrNotFound
+	UseLoginChallenge(ctx context.Context, jti string, expiresAt time.Time) error
+	ReplaceRecoveryCodes(ctx context.Context, userID int, recoveryHashes []string) error
+	// Отключение 2FA вместе с кодами восстановления
+	DeleteTOTP(ctx context.Context, userID int) error
+}
+
+// Токены из писем; хранятся только их хеши
+type EmailTokenStore interface {
+	CreateEmailToken(ctx context.Context, token EmailToken) error
+	// Погашение токена: он и остальные токены пользователя с тем же назначением становятся
+	// недействительными. Неизвестный, использованный или истёкший токен — ErrNotFound.
+	ConsumeEmailToken(ctx context.Context, purpose, tokenHash string) (EmailToken, error)
+}
+
+// Персональные токены доступа; хранятся только их хеши
+type AccessTokenStore interface {
+	CreateAccessToken(ctx context.Context, token AccessToken) (AccessToken, error)
+	// Токены пользователя, новые первыми
+	ListAccessTokens(ctx context.Context, userID int) ([]AccessToken, error)
+	// Поиск токена по хешу с отметкой last_used_at; неизвестный или истёкший — ErrNotFound
+	UseAccessToken(ctx context.Context, tokenHash string) (AccessToken, error)
+	// Отзыв токена; чужой или несуществующий — ErrNotFound
+	DeleteAccessToken(ctx context.Context, userID, tokenID int) error
+	// Отзыв всех токенов пользователя, например при сбросе пароля
+	DeleteUserAccessTokens(ctx context.Context, userID int) error
+}
+
+// Счётчики неудачных попыток входа. Счётчик, последняя неудача которого старше window,
+// считается сброшенным.
+type LoginThrottleStore interface {
+	// Атомарно читает действующие счётчики ключей (ключей без неудач в них нет) и, если allow
+	// разрешает попытку, увеличивает их все. Параллельные вызовы с общими ключами выполняются по очереди.
+	AddLoginAttempt(ctx context.Context, keys []string, window time.Duration, allow func(map[string]LoginFailures) bool) (bool, error)
+	// Снимает одну учтённую попытку с ключа
+	RemoveLoginAttempt(ctx context.Context, key string) error
+	ResetLoginFailures(ctx context.Context, key string) error
+}
+
+// Журнал неудачных попыток входа
+type LoginAuditStore interface {
+	AddLoginAudit(ctx context.Context, entry LoginAuditEntry) error
+	// Последние записи по аккаунту, новые первыми
+	ListLoginAudit(ctx context.Context, userID, limit int) ([]LoginAuditEntry, error)
+}
+
+type SessionStore interface {
+	CreateRefreshToken(ctx context.Context, token RefreshToken) error
+	// Атомарная ротация: старый токен помечается использованным и сохраняется next.
+	// Если старый токен уже использован, отзывается всё семейство и возвращается ErrRefreshTokenReused.
+	RotateRefreshToken(ctx context.Context, oldHash string, next RefreshToken) error
+	RevokeRefreshFamily(ctx context.Context, tokenHash string) error
+	RevokeUserRefreshTokens(ctx context.Context, userID int) error
+}
+
+// Доступ к блокноту, странице или задаче (*Access) есть у владельца, участников блокнота
+// и участников его пространства; без доступа — ErrNotFound, как и для несуществующей записи.
+//
+// Списки (ListNotebooks, ListUserTasks, Search) ограничены пространством. В личное пространство
+// дополнительно попадают доступные блокноты пространств, где пользователь не участник.
+type NotebookStore interface {
+	// Доступные пользователю блокноты пространства с его ролью в каждом
+	ListNotebooks(ctx context.Context, userID, workspaceID int) ([]Notebook, error)
+	GetNotebook(ctx context.Context, notebookID int) (Notebook, error)
+	// Без WorkspaceID блокнот создаётся в личном пространстве владельца
+	CreateNotebook(ctx context.Context, notebook Notebook) (Notebook, error)
+	UpdateNotebook(ctx context.Context, notebook Notebook) (Notebook, error)
+	// Частичное обновление: меняются только поля, переданные в patch
+	PatchNotebook(ctx context.Context, notebookID int, patch NotebookPatch) (Notebook, error)
+	DeleteNotebook(ctx context.Context, notebookID int) error
+	NotebookOwnerID(ctx context.Context, notebookID int) (int, error)
+	NotebookAccess(ctx context.Context, notebookID, userID int) (Access, error)
+	// Владелец и участники блокнота; владелец первым
+	ListNotebookMembers(ctx context.Context, notebookID int) ([]NotebookMember, error)
+	// Пользователь уже участник или владелец — ErrDuplicateKey
+	AddNotebookMember(ctx context.Context, member NotebookMember) (NotebookMember, error)
+	UpdateNotebookMemberRole(ctx context.Context, notebookID, userID int, role string) (NotebookMember, error)
+	// Вместе с участником удаляются его напоминания и метки в блокноте
+	RemoveNotebookMember(ctx context.Context, notebookID, userID int) error
+	// Новый владелец должен быть участником; прежний владелец становится редактором.
+	// Если владелец блокнота уже не fromUserID или toUserID не участник — ErrNotFound.
+	TransferNotebookOwnership(ctx context.Context, notebookID, fromUserID, toUserID int) error
+}
+
+// Пространства. Роль пользователя в пространстве, где он не участник, — ErrNotFound.
+type WorkspaceStore interface {
+	// Пространства пользователя с его ролью в каждом; личное первым
+	ListWorkspaces(ctx context.Context, userID int) ([]Workspace, error)
+	GetWorkspace(ctx context.Context, workspaceID int) (Workspace, error)
+	WorkspaceRole(ctx context.Context, workspaceID, userID int) (string, error)
+	// Создатель становится администратором
+	CreateWorkspace(ctx context.Context, workspace Workspace, creatorID int) (Workspace, error)
+	PatchWorkspace(ctx context.Context, workspaceID int, patch WorkspacePatch) (Workspace, error)
+	// Вместе с пространством удаляются его блокноты
+	DeleteWorkspace(ctx context.Context, workspaceID int) error
+	// Администраторы первыми, затем по времени вступления
+	ListWorkspaceMembers(ctx context.Context, workspaceID int) ([]WorkspaceMember, error)
+	// Пользователь уже участник — ErrDuplicateKey
+	AddWorkspaceMember(ctx context.Context, member WorkspaceMember) (WorkspaceMember, error)
+	UpdateWorkspaceMemberRole(ctx context.Context, workspaceID, userID int, role string) (WorkspaceMember, error)
+	RemoveWorkspaceMember(ctx context.Context, workspaceID, userID int) error
+	// Выбранное пользователем пространство с его ролью; если не выбрано или пользователь
+	// в нём больше не участник — личное
+	CurrentWorkspace(ctx context.Context, userID int) (Workspace, error)
+	// Пользователь не участник пространства — ErrNotFound
+	SetCurrentWorkspace(ctx context.Context, userID, workspaceID int) error
+}
+
+type PageStore interface {
+	ListPages(ctx context.Context, notebookID int) ([]Page, error)
+	GetPage(ctx context.Context, pageID int) (Page, error)
+	CreatePage(ctx context.Context, page Page) (Page, error)
+	UpdatePage(ctx context.Context, page Page) (Page, error)
+	// Частичное обновление: меняются только поля, переданные в patch
+	PatchPage(ctx context.Context, pageID int, patch PagePatch) (Page, error)
+	DeletePage(ctx context.Context, pageID int) error
+	PageOwnerID(ctx context.Context, pageID int) (int, error)
+	PageAccess(ctx context.Context, pageID, userID int) (Access, error)
+	// Страницы блокнота с метками, подходящими под фильтр
+	ListPagesByLabels(ctx context.Context, notebookID int, labels LabelFilter) ([]Page, error)
+}
+
+type TaskStore interface {
+	ListTasks(ctx context.Context, pageID int) ([]Task, error)
+	GetTask(ctx context.Context, taskID int) (Task, error)
+	// Задачи из доступных пользователю блокнотов (пространства filter.WorkspaceID): фильтр, сортировка и keyset-пагинация (не больше filter.Limit)
+	ListUserTasks(ctx context.Context, filter TaskFilter) ([]Task, error)
+	// createdBy записывается в историю статусов как автор начального статуса
+	CreateTask(ctx context.Context, task Task, createdBy int) (Task, error)
+	UpdateTask(ctx context.Context, task Task) (Task, error)
+	// Частичное обновление: меняются только поля, переданные в patch.
+	// Смена статуса атомарно проверяется по patch.FromStatus и записывается в историю.
+	PatchTask(ctx context.Context, taskID int, patch TaskPatch) (Task, error)
+	DeleteTask(ctx context.Context, taskID int) error
+	TaskOwnerID(ctx context.Context, taskID int) (int, error)
+	TaskAccess(ctx context.Context, taskID, userID int) (Access, error)
+	// История статусов задачи в порядке изменения
+	TaskStatusHistory(ctx context.Context, taskID int) ([]TaskStatusChange, error)
+	// Незакрытые задачи всех пользователей со сроком в [from, to) — для уведомлений о сроках
+	ListDueTasks(ctx context.Context, from, to time.Time) ([]Task, error)
+}
+
+// Пункты чек-листов. Пункт адресуется парой (taskID, itemID): пункт другой задачи — ErrNotFound.
+type ChecklistStore interface {
+	// Пункты нескольких задач сразу (для дерева задач страницы), по задаче и позиции
+	ListChecklistItems(ctx context.Context, taskIDs []int) ([]ChecklistItem, error)
+	// Новый пункт добавляется в конец чек-листа
+	CreateChecklistItem(ctx context.Context, item ChecklistItem) (ChecklistItem, error)
+	PatchChecklistItem(ctx context.Context, taskID, itemID int, patch ChecklistItemPatch) (ChecklistItem, error)
+	DeleteChecklistItem(ctx context.Context, taskID, itemID int) error
+}
+
+// Метки пользователя. Списки меток возвращаются отсортированными по имени.
+// Метки личные и в общих блокнотах: пользователь видит и меняет на задаче или странице только свои метки.
+type LabelStore interface {
+	ListLabels(ctx context.Context, userID int) ([]Label, error)
+	// Метка с уже существующим у пользователя именем — ErrDuplicateKey
+	CreateLabel(ctx context.Context, label Label) (Label, error)
+	PatchLabel(ctx context.Context, labelID int, patch LabelPatch) (Label, error)
+	DeleteLabel(ctx context.Context, labelID int) error
+	LabelOwnerID(ctx context.Context, labelID int) (int, error)
+	TaskLabels(ctx context.Context, userID, taskID int) ([]Label, error)
+	// Замена набора меток пользователя на задаче
+	SetTaskLabels(ctx context.Context, userID, taskID int, labelIDs []int) error
+	PageLabels(ctx context.Context, userID, pageID int) ([]Label, error)
+	// Замена набора меток пользователя на странице
+	SetPageLabels(ctx context.Context, userID, pageID int, labelIDs []int) error
+}
+
+// Напоминания о задачах. Напоминания личные: список и удаление — только свои,
+// напоминание адресуется тройкой (taskID, userID, reminderID).
+type ReminderStore interface {
+	ListReminders(ctx context.Context, taskID, userID int) ([]Reminder, error)
+	// FireAt вычисляется по RemindAt или по сроку задачи и часовому поясу пользователя
+	CreateReminder(ctx context.Context, reminder Reminder) (Reminder, error)
+	DeleteReminder(ctx context.Context, taskID, userID, reminderID int) error
+	// Захват наступивших напоминаний для отправки: увеличивает attempts и откладывает
+	// следующую попытку до now+lease, чтобы их не взял другой экземпляр сервера
+	ClaimDueReminders(ctx context.Context, now time.Time, limit int, lease time.Duration) ([]Reminder, error)
+	// Результат попытки отправки: Status, LastError и NextAttemptAt захваченного напоминания.
+	// Если fire_at с момента захвата изменился (сменился срок задачи), результат не записывается.
+	RecordReminderAttempt(ctx context.Context, reminder Reminder) error
+}
+
+// Уведомления пользователя. Уведомление адресуется парой (userID, notificationID): чужое — ErrNotFound.
+type NotificationStore interface {
+	CreateNotification(ctx context.Context, n Notification) (Notification, error)
+	// Уведомления от новых к старым
+	ListNotifications(ctx context.Context, filter NotificationFilter) ([]Notification, error)
+	UnreadNotificationCount(ctx context.Context, userID int) (int, error)
+	MarkNotificationRead(ctx context.Context, userID, notificationID int) (Notification, error)
+	// Возвращает число отмеченных уведомлений
+	MarkAllNotificationsRead(ctx context.Context, userID int) (int, error)
+}
+
+type SearchStore interface {
+	// Поиск по доступным пользователю блокнотам, страницам и задачам пространства, по убыванию релевантности
+	Search(ctx context.Context, userID, workspaceID int, query string, limit int) ([]SearchResult, error)
+}
+
+// Все хранилища одной реализации
+type Store interface {
+	UserStore
+	SessionStore
+	EmailTokenStore
+	TwoFactorStore
+	AccessTokenStore
+	LoginThrottleStore
+	LoginAuditStore
+	NotebookStore
+	WorkspaceStore
+	PageStore
+	TaskStore
+	ChecklistStore
+	LabelStore
+	ReminderStore
+	NotificationStore
+	SearchStore
+}
+
+// Сервер приложения: обработчики получают хранилища через него, а не через глобальное подключение
+type server struct {
+	users         UserStore
+	sessions      SessionStore
+	emailTokens   EmailTokenStore
+	twoFactor     TwoFactorStore
+	accessTokens  AccessTokenStore
+	loginThrottle LoginThrottleStore // по умолчанию — хранилище; при store: memory — счётчики экземпляра
+	loginAudit    LoginAuditStore
+	notebooks     NotebookStore
+	workspaces    WorkspaceStore
+	pages         PageStore
+	tasks         TaskStore
+	checklists    ChecklistStore
+	labels        LabelStore
+	reminders     ReminderStore
+	notifications NotificationStore
+	search        SearchStore
+	hub           *eventHub      // подписки на поток событий этого экземпляра
+	events        EventPublisher // по умолчанию — hub; при pg_notify — рассылка через PostgreSQL
+	heartbeat     time.Duration
+	mailer        Mailer
+	mailing       sync.WaitGroup // письма, отправляемые в фоне
+}
+
+func newServer(st Store) *server {
+	events := defaultConfig().Events
+	hub := newEventHub(events.ReplaySize)
+	return &server{
+		users:         st,
+		sessions:      st,
+		emailTokens:   st,
+		twoFactor:     st,
+		accessTokens:  st,
+		loginThrottle: st,
+		loginAudit:    st,
+		notebooks:     st,
+		workspaces:    st,
+		pages:         st,
+		tasks:         st,
+		checklists:    st,
+		labels:        st,
+		reminders:     st,
+		notifications: st,
+		search:        st,
+		hub:           hub,
+		events:        hub,
+		heartbeat:     events.Heartbeat,
+		mailer:        &logMailer{},
+	}
+}
+
+var (
+	_ Store = (*pgStore)(nil)
+	_ Store = (*memoryStore)(nil)
+)
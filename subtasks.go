@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Максимальная вложенность задач: задача верхнего уровня — уровень 1
+const maxTaskDepth = 3
+
+// Проверка родителя новой подзадачи: та же страница и не превышена вложенность
+func (s *server) checkParentTask(ctx context.Context, pageID, parentID int) error {
+	parent, err := s.tasks.GetTask(ctx, parentID)
+	if errors.Is(err, ErrNotFound) {
+		return &validationError{"parent_task_id", "task not found"}
+	}
+	if err != nil {
+		return err
+	}
+	if parent.PageID != pageID {
+		return &validationError{"parent_task_id", "parent task must be on the same page"}
+	}
+
+	depth := 1
+	for parent.ParentID != nil {
+		depth++
+		if parent, err = s.tasks.GetTask(ctx, *parent.ParentID); err != nil {
+			return err
+		}
+	}
+	if depth >= maxTaskDepth {
+		return &validationError{"parent_task_id", fmt.Sprintf("maximum nesting depth is %d", maxTaskDepth)}
+	}
+	return nil
+}
+
+// Есть ли у задачи подзадачи (подзадачи всегда на странице родителя)
+func (s *server) hasSubtasks(ctx context.Context, task Task) (bool, error) {
+	tasks, err := s.tasks.ListTasks(ctx, task.PageID)
+	if err != nil {
+		return false, err
+	}
+	for _, t := range tasks {
+		if t.ParentID != nil && *t.ParentID == task.ID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Дерево задач страницы с чек-листами и прогрессом. Порядок сохраняется как в tasks.
+func buildTaskTree(tasks []Task, items []ChecklistItem, w Workflow) []*TaskNode {
+	nodes := make(map[int]*TaskNode, len(tasks))
+	for _, t := range tasks {
+		nodes[t.ID] = &TaskNode{Task: t, Checklist: []ChecklistItem{}, Subtasks: []*TaskNode{}}
+	}
+	for _, item := range items {
+		if n, ok := nodes[item.TaskID]; ok {
+			n.Checklist = append(n.Checklist, item)
+			n.Progress.Total++
+			if item.Done {
+				n.Progress.Done++
+			}
+		}
+	}
+
+	roots := []*TaskNode{}
+	for _, t := range tasks {
+		n := nodes[t.ID]
+		parent, ok := (*TaskNode)(nil), false
+		if t.ParentID != nil {
+			parent, ok = nodes[*t.ParentID]
+		}
+		if !ok {
+			roots = append(roots, n)
+			continue
+		}
+		parent.Subtasks = append(parent.Subtasks, n)
+		if w.Cancelled == "" || t.Status != w.Cancelled {
+			parent.Progress.Total++
+			if t.Status == w.Completed {
+				parent.Progress.Done++
+			}
+		}
+	}
+	return roots
+}
+
+// /api/tasks/{id}{collection} и /api/tasks/{id}{collection}/{itemID}, например collection = "/checklist"
+func parseTaskItemPath(path, collection string) (taskID, itemID int, err error) {
+	rest := strings.TrimPrefix(path, "/api/tasks/")
+	taskIDStr, rest, _ := strings.Cut(rest, collection)
+	if taskID, err = strconv.Atoi(taskIDStr); err != nil {
+		return 0, 0, fmt.Errorf("Invalid task_id format")
+	}
+	if rest = strings.Trim(rest, "/"); rest != "" {
+		if itemID, err = strconv.Atoi(rest); err != nil {
+			return 0, 0, fmt.Errorf("Invalid item_id format")
+		}
+	}
+	return taskID, itemID, nil
+}
+
+// Обработчик чек-листа задачи:
+// GET и POST — /api/tasks/{id}/checklist, PATCH и DELETE — /api/tasks/{id}/checklist/{itemID}
+func (s *server) checklistHandler(w http.ResponseWriter, r *http.Request) {
+	taskID, itemID, err := parseTaskItemPath(r.URL.Path, "/checklist")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	collection := r.Method == http.MethodGet || r.Method == http.MethodPost
+	item := r.Method == http.MethodPatch || r.Method == http.MethodDelete
+	if !(itemID == 0 && collection || itemID != 0 && item) {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Чек-лист виден всем участникам блокнота, менять его может редактор
+	userID, err := userIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	need := roleEditor
+	if r.Method == http.MethodGet {
+		need = roleViewer
+	}
+	if _, err := s.authorizeTask(r.Context(), userID, taskID, need); err != nil {
+		writeAuthzError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	switch r.Method {
+	case http.MethodGet:
+		items, err := s.checklists.ListChecklistItems(r.Context(), []int{taskID})
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error fetching checklist: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if items == nil {
+			items = []ChecklistItem{}
+		}
+		json.NewEncoder(w).Encode(items)
+
+	case http.MethodPost:
+		var req struct {
+			Title string `json:"title"`
+			Done  bool   `json:"done"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Title == "" {
+			http.Error(w, "title: must be a non-empty string", http.StatusBadRequest)
+			return
+		}
+		created, err := s.checklists.CreateChecklistItem(r.Context(), ChecklistItem{TaskID: taskID, Title: req.Title, Done: req.Done})
+		if err != nil {
+			http.Error(w, "Failed to create checklist item: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Location", fmt.Sprintf("/api/tasks/%d/checklist/%d", taskID, created.ID))
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(created)
+
+	case http.MethodPatch:
+		var patch ChecklistItemPatch
+		if err := decodePatch(r.Body, &patch); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		patched, err := s.checklists.PatchChecklistItem(r.Context(), taskID, itemID, patch)
+		if err != nil {
+			writeAuthzError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(patched)
+
+	case http.MethodDelete:
+		if err := s.checklists.DeleteChecklistItem(r.Context(), taskID, itemID); err != nil {
+			writeAuthzError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"message": "Checklist item deleted"})
+	}
+}
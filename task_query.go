@@ -0,0 +1,288 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Размер страницы выдачи GET /api/tasks
+const (
+	defaultTaskPageSize = 50
+	maxTaskPageSize     = 200
+)
+
+// Фильтр списка задач пользователя по всем его блокнотам.
+// Нулевые значения означают «без ограничения».
+type TaskFilter struct {
+	UserID      int
+	WorkspaceID int // 0 — все пространства
+	NotebookID  int
+	Statuses    []string
+	PriorityGTE *int
+	DueAfter    *time.Time // включительно
+	DueBefore   *time.Time // не включительно
+	Due         string     // dueToday, dueOverdue или dueNone
+	DueWindow   dueWindow  // «сегодня» пользователя для Due; заполняет обработчик
+	Labels      LabelFilter
+	Sort        []taskSortKey
+	After       []any // значения ключей сортировки последней задачи предыдущей страницы
+	Limit       int
+}
+
+type taskSortKey struct {
+	Field string
+	Desc  bool
+}
+
+// Поля, по которым разрешена сортировка; value возвращает int или time.Time.
+// Задачи без срока при сортировке по due_date идут после всех остальных (по возрастанию).
+type taskSortField struct {
+	column string
+	value  func(Task) any
+}
+
+// Значение ключа due_date; задача без срока получает максимальный момент, как в COALESCE в taskSortFields
+func dueDateSortValue(t Task) any {
+	if t.DueDate == nil {
+		return time.Date(9999, 12, 31, 23, 59, 59, 0, time.UTC)
+	}
+	return *t.DueDate
+}
+
+var taskSortFields = map[string]taskSortField{
+	"id":         {"t.id", func(t Task) any { return t.ID }},
+	"priority":   {"t.priority", func(t Task) any { return t.Priority }},
+	"due_date":   {"COALESCE(t.due_date, '9999-12-31 23:59:59+00')", dueDateSortValue},
+	"created_at": {"t.created_at", func(t Task) any { return t.CreatedAt }},
+	"updated_at": {"t.updated_at", func(t Task) any { return t.UpdatedAt }},
+}
+
+// Разбор sort=-priority,due_date. id всегда добавляется последним ключом, чтобы порядок был однозначным.
+func parseTaskSort(s string) ([]taskSortKey, error) {
+	var keys []taskSortKey
+	seen := map[string]bool{}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		key := taskSortKey{Field: strings.TrimPrefix(part, "-"), Desc: strings.HasPrefix(part, "-")}
+		if _, ok := taskSortFields[key.Field]; !ok {
+			return nil, &validationError{"sort", fmt.Sprintf("unknown field %q", key.Field)}
+		}
+		if seen[key.Field] {
+			return nil, &validationError{"sort", fmt.Sprintf("duplicate field %q", key.Field)}
+		}
+		seen[key.Field] = true
+		keys = append(keys, key)
+	}
+	if !seen["id"] {
+		keys = append(keys, taskSortKey{Field: "id"})
+	}
+	return keys, nil
+}
+
+func formatTaskSort(keys []taskSortKey) string {
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = k.Field
+		if k.Desc {
+			parts[i] = "-" + k.Field
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// Разбор параметров GET /api/tasks
+func parseTaskFilter(q url.Values) (TaskFilter, error) {
+	var f TaskFilter
+	var err error
+
+	if v := q.Get("notebook_id"); v != "" {
+		if f.NotebookID, err = strconv.Atoi(v); err != nil {
+			return f, &validationError{"notebook_id", "must be an integer"}
+		}
+	}
+	if v := q.Get("status"); v != "" {
+		for _, status := range strings.Split(v, ",") {
+			if !taskWorkflow.Valid(status) {
+				return f, &validationError{"status", fmt.Sprintf("must be one of %v", taskWorkflow.Statuses())}
+			}
+			f.Statuses = append(f.Statuses, status)
+		}
+	}
+	if v := q.Get("priority_gte"); v != "" {
+		p, err := strconv.Atoi(v)
+		if err != nil {
+			return f, &validationError{"priority_gte", "must be an integer"}
+		}
+		f.PriorityGTE = &p
+	}
+	for name, dst := range map[string]**time.Time{"due_after": &f.DueAfter, "due_before": &f.DueBefore} {
+		if v := q.Get(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return f, &validationError{name, "must be an RFC 3339 timestamp"}
+			}
+			*dst = &t
+		}
+	}
+
+	switch v := q.Get("due"); v {
+	case "", dueToday, dueOverdue, dueNone:
+		f.Due = v
+	default:
+		return f, &validationError{"due", fmt.Sprintf("must be one of [%s %s %s]", dueToday, dueOverdue, dueNone)}
+	}
+
+	if f.Labels, err = parseLabelFilter(q); err != nil {
+		return f, err
+	}
+
+	if f.Sort, err = parseTaskSort(q.Get("sort")); err != nil {
+		return f, err
+	}
+
+	f.Limit = defaultTaskPageSize
+	if v := q.Get("limit"); v != "" {
+		if f.Limit, err = strconv.Atoi(v); err != nil || f.Limit < 1 || f.Limit > maxTaskPageSize {
+			return f, &validationError{"limit", fmt.Sprintf("must be an integer from 1 to %d", maxTaskPageSize)}
+		}
+	}
+
+	if v := q.Get("cursor"); v != "" {
+		if f.After, err = decodeTaskCursor(v, f.Sort); err != nil {
+			return f, err
+		}
+	}
+	return f, nil
+}
+
+// Непрозрачный курсор: base64 от JSON с порядком сортировки и значениями ключей последней задачи
+type taskCursor struct {
+	Sort   string            `json:"s"`
+	Values []json.RawMessage `json:"v"`
+}
+
+func encodeTaskCursor(last Task, keys []taskSortKey) string {
+	c := taskCursor{Sort: formatTaskSort(keys)}
+	for _, v := range taskKeyValues(last, keys) {
+		raw, _ := json.Marshal(v)
+		c.Values = append(c.Values, raw)
+	}
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeTaskCursor(s string, keys []taskSortKey) ([]any, error) {
+	invalid := &validationError{"cursor", "invalid cursor"}
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, invalid
+	}
+	var c taskCursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, invalid
+	}
+	if c.Sort != formatTaskSort(keys) {
+		return nil, &validationError{"cursor", "cursor was issued for a different sort order"}
+	}
+	if len(c.Values) != len(keys) {
+		return nil, invalid
+	}
+
+	values := make([]any, len(keys))
+	for i, k := range keys {
+		switch taskSortFields[k.Field].value(Task{}).(type) {
+		case int:
+			var v int
+			err = json.Unmarshal(c.Values[i], &v)
+			values[i] = v
+		case time.Time:
+			var v time.Time
+			err = json.Unmarshal(c.Values[i], &v)
+			values[i] = v
+		}
+		if err != nil {
+			return nil, invalid
+		}
+	}
+	return values, nil
+}
+
+// Значения ключей сортировки задачи
+func taskKeyValues(t Task, keys []taskSortKey) []any {
+	values := make([]any, len(keys))
+	for i, k := range keys {
+		values[i] = taskSortFields[k.Field].value(t)
+	}
+	return values
+}
+
+// Сравнение значений ключа сортировки (int или time.Time)
+func compareSortValues(a, b any) int {
+	switch a := a.(type) {
+	case int:
+		b := b.(int)
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+		return 0
+	case time.Time:
+		return a.Compare(b.(time.Time))
+	}
+	panic(fmt.Sprintf("unsupported sort value %T", a))
+}
+
+// Положение задачи относительно значений ключей с учётом направлений: <0 — раньше, >0 — позже
+func compareTaskToKeys(t Task, keys []taskSortKey, values []any) int {
+	for i, k := range keys {
+		c := compareSortValues(taskSortFields[k.Field].value(t), values[i])
+		if k.Desc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// Подходит ли задача под фильтр (без учёта владельца, меток и курсора) — для хранилища в памяти
+func (f TaskFilter) matches(t Task) bool {
+	if len(f.Statuses) > 0 {
+		found := false
+		for _, s := range f.Statuses {
+			found = found || s == t.Status
+		}
+		if !found {
+			return false
+		}
+	}
+	if f.PriorityGTE != nil && t.Priority < *f.PriorityGTE {
+		return false
+	}
+	if f.DueAfter != nil && (t.DueDate == nil || t.DueDate.Before(*f.DueAfter)) {
+		return false
+	}
+	if f.DueBefore != nil && (t.DueDate == nil || !t.DueDate.Before(*f.DueBefore)) {
+		return false
+	}
+	switch f.Due {
+	case dueToday:
+		return f.DueWindow.isToday(t)
+	case dueOverdue:
+		return f.DueWindow.isOverdue(t) && !taskWorkflow.Closed(t.Status)
+	case dueNone:
+		return t.DueDate == nil
+	}
+	return true
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestParseTaskFilter(t *testing.T) {
+	q, err := url.ParseQuery("status=todo,done&priority_gte=2&due_before=2030-01-01T00:00:00Z&notebook_id=7&sort=-priority,due_date&limit=10")
+	require.NoError(t, err)
+	f, err := parseTaskFilter(q)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"todo", "done"}, f.Statuses)
+	assert.Equal(t, 2, *f.PriorityGTE)
+	assert.Equal(t, 7, f.NotebookID)
+	assert.Equal(t, 10, f.Limit)
+	assert.Nil(t, f.DueAfter)
+	assert.Equal(t, "-priority,due_date,id", formatTaskSort(f.Sort), "id добавляется для однозначного порядка")
+
+	for _, bad := range []string{"status=garbage", "sort=password", "sort=id,id", "limit=0", "limit=1000", "due_after=tomorrow", "cursor=%21%21"} {
+		q, _ := url.ParseQuery(bad)
+		_, err := parseTaskFilter(q)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestTaskCursorRoundTrip(t *testing.T) {
+	keys, err := parseTaskSort("-priority,due_date")
+	require.NoError(t, err)
+	last := Task{ID: 42, Priority: 3, DueDate: dueAt(time.Date(2030, 5, 1, 12, 0, 0, 123000, time.UTC))}
+
+	cursor := encodeTaskCursor(last, keys)
+	values, err := decodeTaskCursor(cursor, keys)
+	require.NoError(t, err)
+	assert.Equal(t, 0, compareTaskToKeys(last, keys, values))
+
+	otherKeys, _ := parseTaskSort("due_date")
+	_, err = decodeTaskCursor(cursor, otherKeys)
+	assert.ErrorContains(t, err, "different sort order", "Курсор нельзя применить к другому порядку сортировки")
+}
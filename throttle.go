@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Хранилище счётчиков попыток входа (auth.login_throttle.store)
+const (
+	loginThrottleMemory   = "memory"
+	loginThrottlePostgres = "postgres"
+)
+
+// Причины неудачного входа в журнале login_audit
+const (
+	loginFailedCredentials  = "invalid_credentials"   // неизвестный аккаунт или неверный пароль
+	loginFailedSecondFactor = "invalid_second_factor" // неверный код TOTP или код восстановления
+	loginFailedUnverified   = "email_not_verified"
+	loginFailedThrottled    = "throttled" // попытка во время паузы или блокировки; в счётчики не входит
+)
+
+// Настройки защиты от перебора (задаются конфигурацией)
+var loginThrottle = defaultConfig().Auth.LoginThrottle
+
+// Один ответ и для неизвестного аккаунта, и для неверного пароля: по нему нельзя узнать, есть ли аккаунт
+var errInvalidCredentials = errors.New("invalid username or password")
+
+// Ответ на внутреннюю ошибку при входе; подробности — только в журнале сервера
+var errLoginFailed = errors.New("internal server error")
+
+const loginAuditPageSize = 50
+
+func accountThrottleKey(username string) string { return "account:" + username }
+func ipThrottleKey(ip string) string            { return "ip:" + ip }
+
+// IP-адрес клиента. X-Forwarded-For учитывается только за доверенным прокси: иначе клиент
+// подставил бы туда любой адрес. Берётся последний адрес — его добавил сам прокси.
+func clientIP(r *http.Request, trustProxy bool) string {
+	if trustProxy {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			parts := strings.Split(forwarded, ",")
+			if ip := strings.TrimSpace(parts[len(parts)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// До какого момента ключ заблокирован: после maxFailures неудач — на Lockout,
+// до этого — пауза BaseDelay, удваивающаяся с каждой неудачей, но не больше MaxDelay
+func (c LoginThrottleConfig) blockedUntil(f LoginFailures, maxFailures int) time.Time {
+	if f.Failures == 0 {
+		return time.Time{}
+	}
+	if f.Failures >= maxFailures {
+		return f.LastFailureAt.Add(c.Lockout)
+	}
+	delay := c.BaseDelay
+	for i := 1; i < f.Failures && delay < c.MaxDelay; i++ {
+		delay *= 2
+	}
+	return f.LastFailureAt.Add(min(delay, c.MaxDelay))
+}
+
+// Сколько ждать до следующей попытки входа при таких счётчиках аккаунта и IP-адреса; 0 — попытка разрешена
+func (c LoginThrottleConfig) retryAfter(failures map[string]LoginFailures, account, addr string) time.Duration {
+	until := c.blockedUntil(failures[account], c.MaxFailures)
+	if ipUntil := c.blockedUntil(failures[addr], c.MaxIPFailures); ipUntil.After(until) {
+		until = ipUntil
+	}
+	return max(time.Until(until), 0)
+}
+
+// Запись неудачной попытки в журнал. В счётчиках она уже учтена в beginLoginAttempt.
+// Без userID аккаунт ищется по имени, чтобы попытка попала в его журнал.
+func (s *server) recordLoginFailure(ctx context.Context, username string, userID *int, ip, reason string) {
+	log.Printf("Failed login for %q from %s: %s", username, ip, reason)
+	if userID == nil {
+		if user, err := s.users.GetUserByUsername(ctx, username); err == nil {
+			userID = &user.ID
+		}
+	}
+	entry := LoginAuditEntry{Username: username, UserID: userID, IP: ip, Reason: reason}
+	if err := s.loginAudit.AddLoginAudit(ctx, entry); err != nil {
+		log.Printf("Error writing login audit entry: %v", err)
+	}
+}
+
+// Попытка с верным паролем не считается перебором: учтённая заранее попытка снимается с аккаунта и IP-адреса
+func (s *server) releaseLoginAttempt(ctx context.Context, username, ip string) {
+	for _, key := range []string{accountThrottleKey(username), ipThrottleKey(ip)} {
+		if err := s.loginThrottle.RemoveLoginAttempt(ctx, key); err != nil {
+			log.Printf("Error releasing login attempt %s: %v", key, err)
+		}
+	}
+}
+
+// Успешный вход снимает паузу с аккаунта; с IP-адреса снимается только эта попытка —
+// иначе перебор можно было бы сбрасывать входом в собственный аккаунт
+func (s *server) resetLoginFailures(ctx context.Context, username, ip string) {
+	if err := s.loginThrottle.ResetLoginFailures(ctx, accountThrottleKey(username)); err != nil {
+		log.Printf("Error resetting failed logins of %q: %v", username, err)
+	}
+	if err := s.loginThrottle.RemoveLoginAttempt(ctx, ipThrottleKey(ip)); err != nil {
+		log.Printf("Error releasing login attempt from %s: %v", ip, err)
+	}
+}
+
+// Учёт попытки входа до проверки пароля или кода: пауза проверяется и попытка считается неудачной
+// одной операцией хранилища. Иначе параллельные запросы прошли бы проверку по одному и тому же
+// счётчику и перебрали бы больше паролей, чем разрешено. Неизвестные имена пользователей
+// считаются так же, как существующие. При ok = false ответ уже записан.
+func (s *server) beginLoginAttempt(w http.ResponseWriter, r *http.Request, username string, userID *int, ip string) bool {
+	account, addr := accountThrottleKey(username), ipThrottleKey(ip)
+	var wait time.Duration
+	allowed, err := s.loginThrottle.AddLoginAttempt(r.Context(), []string{account, addr}, loginThrottle.Lockout,
+		func(failures map[string]LoginFailures) bool {
+			wait = loginThrottle.retryAfter(failures, account, addr)
+			return wait == 0
+		})
+	if err != nil {
+		log.Printf("Error counting login attempt: %v", err)
+		handleError(w, errLoginFailed, http.StatusInternalServerError)
+		return false
+	}
+	if allowed {
+		return true
+	}
+	s.recordLoginFailure(r.Context(), username, userID, ip, loginFailedThrottled)
+	seconds := int((wait + time.Second - 1) / time.Second)
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	handleError(w, fmt.Errorf("too many failed login attempts, try again in %d seconds", seconds), http.StatusTooManyRequests)
+	return false
+}
+
+// GET /api/profile/login-attempts — последние неудачные попытки входа в аккаунт
+func (s *server) loginAttemptsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	userID, err := userIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	entries, err := s.loginAudit.ListLoginAudit(r.Context(), userID, loginAuditPageSize)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error fetching login attempts: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+// Счётчики попыток входа в памяти — для одного экземпляра сервера
+type memoryLoginThrottle struct {
+	mu       sync.Mutex
+	failures map[string]LoginFailures
+}
+
+// При таком числе ключей устаревшие счётчики удаляются
+const memoryThrottleSweepSize = 10000
+
+func newMemoryLoginThrottle() *memoryLoginThrottle {
+	return &memoryLoginThrottle{failures: map[string]LoginFailures{}}
+}
+
+func (m *memoryLoginThrottle) AddLoginAttempt(ctx context.Context, keys []string, window time.Duration, allow func(map[string]LoginFailures) bool) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	cutoff := now.Add(-window)
+	if len(m.failures) >= memoryThrottleSweepSize {
+		for key, f := range m.failures {
+			if !f.LastFailureAt.After(cutoff) {
+				delete(m.failures, key)
+			}
+		}
+	}
+	failures := map[string]LoginFailures{}
+	for _, key := range keys {
+		if f, ok := m.failures[key]; ok && f.LastFailureAt.After(cutoff) {
+			failures[key] = f
+		}
+	}
+	if !allow(failures) {
+		return false, nil
+	}
+	for _, key := range keys {
+		f, ok := failures[key]
+		if !ok {
+			f = LoginFailures{Key: key}
+		}
+		f.Failures++
+		f.LastFailureAt = now
+		m.failures[key] = f
+	}
+	return true, nil
+}
+
+func (m *memoryLoginThrottle) RemoveLoginAttempt(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if f, ok := m.failures[key]; ok {
+		if f.Failures <= 1 {
+			delete(m.failures, key)
+		} else {
+			f.Failures--
+			m.failures[key] = f
+		}
+	}
+	return nil
+}
+
+func (m *memoryLoginThrottle) ResetLoginFailures(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.failures, key)
+	return nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestBlockedUntil(t *testing.T) {
+	cfg := LoginThrottleConfig{BaseDelay: time.Second, MaxDelay: 5 * time.Second, Lockout: time.Hour}
+	last := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 5 * time.Second}, // не больше max_delay
+		{9, 5 * time.Second},
+		{10, time.Hour}, // блокировка
+		{12, time.Hour},
+	}
+	for _, tt := range tests {
+		got := cfg.blockedUntil(LoginFailures{Failures: tt.failures, LastFailureAt: last}, 10)
+		assert.Equal(t, last.Add(tt.want), got, "failures=%d", tt.failures)
+	}
+	assert.True(t, cfg.blockedUntil(LoginFailures{}, 10).IsZero())
+}
+
+func TestClientIP(t *testing.T) {
+	r := httptest.NewRequest("POST", "/login", nil)
+	r.RemoteAddr = "10.0.0.1:54321"
+	r.Header.Set("X-Forwarded-For", "198.51.100.7, 203.0.113.9")
+	assert.Equal(t, "10.0.0.1", clientIP(r, false), "Без доверенного прокси заголовок игнорируется")
+	assert.Equal(t, "203.0.113.9", clientIP(r, true), "Адрес, добавленный прокси, — последний")
+
+	r.Header.Del("X-Forwarded-For")
+	assert.Equal(t, "10.0.0.1", clientIP(r, true))
+	r.RemoteAddr = "[2001:db8::1]:443"
+	assert.Equal(t, "2001:db8::1", clientIP(r, false))
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Персональные токены доступа для скриптов и интеграций. Токен передаётся так же, как JWT:
+// в заголовке Authorization: Bearer tfp_...; по префиксу tokenAuthMiddleware отличает его от JWT.
+const (
+	accessTokenPrefix        = "tfp_"
+	maxAccessTokenNameLength = 100
+)
+
+// Ресурсы API, к которым можно выдать токен: /api/{ресурс}/...
+// Профиль, сами токены и поток событий доступны только после входа по паролю.
+var accessTokenResources = []string{"labels", "notebooks", "notifications", "pages", "search", "tasks", "workspaces"}
+
+// Уровни доступа: write включает read
+const (
+	scopeRead  = "read"
+	scopeWrite = "write"
+)
+
+// Область, которая нужна запросу: ресурс из пути и read для GET/HEAD, иначе write.
+// Пустой ресурс — путь, недоступный по токену доступа.
+func requiredScope(r *http.Request) (resource, level string) {
+	rest, ok := strings.CutPrefix(r.URL.Path, "/api/")
+	if !ok {
+		return "", ""
+	}
+	resource, rest, _ = strings.Cut(rest, "/")
+	if !isAccessTokenResource(resource) {
+		return "", ""
+	}
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return resource, scopeRead
+	}
+	if managesAccess(resource, rest) {
+		return "", ""
+	}
+	return resource, scopeWrite
+}
+
+// Изменяет ли запрос (не GET) чужой доступ: участники и владелец блокнота, участники, администраторы
+// и роль по умолчанию пространства. Это только после входа по паролю: утёкший токен скрипта
+// с notebooks:write или workspaces:write не должен раздавать права и передавать владение.
+func managesAccess(resource, rest string) bool {
+	id, sub, _ := strings.Cut(rest, "/")
+	if id == "" {
+		return false
+	}
+	switch resource {
+	case "notebooks":
+		return strings.HasPrefix(sub, "members") || sub == "transfer"
+	case "workspaces":
+		return id != "current"
+	}
+	return false
+}
+
+func isAccessTokenResource(resource string) bool {
+	i := sort.SearchStrings(accessTokenResources, resource)
+	return i < len(accessTokenResources) && accessTokenResources[i] == resource
+}
+
+// Разбор областей вида tasks:read; повторы убираются, порядок — по алфавиту
+func parseScopes(scopes []string) ([]string, error) {
+	if len(scopes) == 0 {
+		return nil, &validationError{"scopes", "at least one scope is required"}
+	}
+	seen := map[string]bool{}
+	parsed := []string{}
+	for _, scope := range scopes {
+		resource, level, _ := strings.Cut(scope, ":")
+		if !isAccessTokenResource(resource) || level != scopeRead && level != scopeWrite {
+			return nil, &validationError{"scopes", fmt.Sprintf("invalid scope %q: must be <resource>:read or <resource>:write, resources %v", scope, accessTokenResources)}
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			parsed = append(parsed, scope)
+		}
+	}
+	sort.Strings(parsed)
+	return parsed, nil
+}
+
+// Разрешает ли токен доступ к ресурсу на уровне level
+func (t AccessToken) allows(resource, level string) bool {
+	for _, scope := range t.Scopes {
+		if scope == resource+":"+scopeWrite || scope == resource+":"+level {
+			return true
+		}
+	}
+	return false
+}
+
+// Аутентификация запроса по токену доступа; при успехе userID кладётся в контекст, как для JWT.
+// Скрипты не умеют переходить на страницу входа, поэтому ошибки — 401 и 403, а не редирект.
+func (s *server) serveWithAccessToken(w http.ResponseWriter, r *http.Request, token string, next http.Handler) {
+	record, err := s.accessTokens.UseAccessToken(r.Context(), hashToken(token))
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Invalid or expired access token", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		log.Printf("Error checking access token: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	resource, level := requiredScope(r)
+	if resource == "" {
+		http.Error(w, "This endpoint is not available with an access token", http.StatusForbidden)
+		return
+	}
+	if !record.allows(resource, level) {
+		http.Error(w, fmt.Sprintf("Access token does not have the %s:%s scope", resource, level), http.StatusForbidden)
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), userIDKey, strconv.Itoa(record.UserID))
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// GET /api/tokens — токены пользователя;
+// POST /api/tokens {"name": "...", "scopes": ["tasks:read"], "expires_at": "..."} — новый токен
+func (s *server) accessTokensHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := userIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	switch r.Method {
+	case http.MethodGet:
+		tokens, err := s.accessTokens.ListAccessTokens(r.Context(), userID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error fetching access tokens: %v", err), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(tokens)
+
+	case http.MethodPost:
+		var req struct {
+			Name      string     `json:"name"`
+			Scopes    []string   `json:"scopes"`
+			ExpiresAt *time.Time `json:"expires_at"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if strings.TrimSpace(req.Name) == "" || utf8.RuneCountInString(req.Name) > maxAccessTokenNameLength {
+			http.Error(w, fmt.Sprintf("name: must be a non-empty string of at most %d characters", maxAccessTokenNameLength), http.StatusBadRequest)
+			return
+		}
+		scopes, err := parseScopes(req.Scopes)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+			http.Error(w, "expires_at: must be in the future", http.StatusBadRequest)
+			return
+		}
+
+		secret, err := randomID(32)
+		if err != nil {
+			log.Printf("Error generating access token: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		token := accessTokenPrefix + secret
+		created, err := s.accessTokens.CreateAccessToken(r.Context(), AccessToken{
+			UserID:    userID,
+			Name:      req.Name,
+			Scopes:    scopes,
+			TokenHash: hashToken(token),
+			ExpiresAt: req.ExpiresAt,
+		})
+		if err != nil {
+			log.Printf("Error creating access token for user %d: %v", userID, err)
+			http.Error(w, "Failed to create access token", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("User %d created access token %d", userID, created.ID)
+		w.Header().Set("Location", fmt.Sprintf("/api/tokens/%d", created.ID))
+		w.WriteHeader(http.StatusCreated)
+		// Токен показывается только здесь; в хранилище остаётся его хеш
+		json.NewEncoder(w).Encode(struct {
+			AccessToken
+			Token string `json:"token"`
+		}{created, token})
+
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// DELETE /api/tokens/{id} — отзыв токена
+func (s *server) accessTokenHandler(w http.ResponseWriter, r *http.Request) {
+	tokenID, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/api/tokens/"))
+	if err != nil {
+		http.Error(w, "Invalid token_id format", http.StatusBadRequest)
+		return
+	}
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	userID, err := userIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := s.accessTokens.DeleteAccessToken(r.Context(), userID, tokenID); err != nil {
+		writeAuthzError(w, err)
+		return
+	}
+	log.Printf("User %d revoked access token %d", userID, tokenID)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseScopes(t *testing.T) {
+	scopes, err := parseScopes([]string{"tasks:write", "notebooks:read", "tasks:write"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"notebooks:read", "tasks:write"}, scopes, "Повторы убираются, порядок по алфавиту")
+
+	for _, bad := range [][]string{nil, {"tasks"}, {"tasks:admin"}, {"profile:read"}, {"tokens:write"}, {":read"}} {
+		_, err := parseScopes(bad)
+		assert.Error(t, err, "%v", bad)
+	}
+}
+
+func TestRequiredScope(t *testing.T) {
+	tests := []struct {
+		method, path    string
+		resource, level string
+	}{
+		{"GET", "/api/tasks", "tasks", scopeRead},
+		{"GET", "/api/tasks/5/history", "tasks", scopeRead},
+		{"PATCH", "/api/tasks/5", "tasks", scopeWrite},
+		{"PUT", "/api/pages/3/labels", "pages", scopeWrite},
+		{"GET", "/api/search", "search", scopeRead},
+		{"GET", "/api/profile", "", ""},
+		{"POST", "/api/tokens", "", ""},
+		{"GET", "/api/events", "", ""},
+		{"POST", "/logout-all", "", ""},
+	}
+	for _, tt := range tests {
+		resource, level := requiredScope(httptest.NewRequest(tt.method, tt.path, nil))
+		assert.Equal(t, tt.resource, resource, "%s %s", tt.method, tt.path)
+		assert.Equal(t, tt.level, level, "%s %s", tt.method, tt.path)
+	}
+}
+
+func TestAccessTokenAllows(t *testing.T) {
+	token := AccessToken{Scopes: []string{"notebooks:read", "tasks:write"}}
+	assert.True(t, token.allows("notebooks", scopeRead))
+	assert.False(t, token.allows("notebooks", scopeWrite))
+	assert.True(t, token.allows("tasks", scopeRead), "write включает read")
+	assert.True(t, token.allows("tasks", scopeWrite))
+	assert.False(t, token.allows("pages", scopeRead))
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Секрет из тестовых векторов RFC 6238 ("12345678901234567890") в base32
+const rfcTOTPSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode(t *testing.T) {
+	// Последние 6 цифр 8-значных значений из приложения B RFC 6238 (SHA-1)
+	for unix, want := range map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	} {
+		code, err := totpCode(rfcTOTPSecret, totpStep(time.Unix(unix, 0)))
+		require.NoError(t, err)
+		assert.Equal(t, want, code, "время %d", unix)
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	code, err := totpCode(rfcTOTPSecret, totpStep(now))
+	require.NoError(t, err)
+
+	step, ok := validateTOTP(rfcTOTPSecret, code, now)
+	assert.True(t, ok)
+	assert.Equal(t, totpStep(now), step)
+	_, ok = validateTOTP(rfcTOTPSecret, code, now.Add(totpPeriod*time.Second))
+	assert.True(t, ok, "Допускается расхождение часов на один шаг")
+	_, ok = validateTOTP(rfcTOTPSecret, code, now.Add(3*totpPeriod*time.Second))
+	assert.False(t, ok, "Устаревший код не принимается")
+	_, ok = validateTOTP(rfcTOTPSecret, "12345", now)
+	assert.False(t, ok)
+}
+
+func TestTOTPURIAndRecoveryCodes(t *testing.T) {
+	secret, err := newTOTPSecret()
+	require.NoError(t, err)
+	uri := totpURI(secret, "user name")
+	assert.True(t, strings.HasPrefix(uri, "otpauth://totp/TaskFlow:user%20name?"))
+	assert.Contains(t, uri, "secret="+secret)
+	assert.Contains(t, uri, "issuer=TaskFlow")
+
+	codes, err := newRecoveryCodes()
+	require.NoError(t, err)
+	require.Len(t, codes, recoveryCodeCount)
+	assert.Regexp(t, `^[a-z2-7]{5}-[a-z2-7]{5}$`, codes[0])
+	assert.Equal(t, hashRecoveryCodes(codes[:1]), hashRecoveryCodes([]string{" " + strings.ToUpper(codes[0])}),
+		"Регистр, пробелы и дефисы при вводе не важны")
+}
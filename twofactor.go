@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Второй шаг входа: токен, выданный после проверки пароля, обменивается на код TOTP
+const (
+	purposeLoginChallenge = "login_2fa"
+	loginChallengeTTL     = 5 * time.Minute
+)
+
+// Проверка кода TOTP; принятый код запоминается и повторно не принимается
+func (s *server) checkTOTPCode(ctx context.Context, totp TOTPSecret, code string) (bool, error) {
+	step, ok := validateTOTP(totp.Secret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+	err := s.twoFactor.UseTOTPStep(ctx, totp.UserID, step)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Ответ с кодами восстановления: они показываются только один раз
+func writeRecoveryCodes(w http.ResponseWriter, codes []string) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]string{"recovery_codes": codes})
+}
+
+// POST /login/2fa {"challenge_token": "...", "code": "123456"} или {"challenge_token": "...", "recovery_code": "..."}
+func (s *server) loginTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		ChallengeToken string `json:"challenge_token"`
+		Code           string `json:"code"`
+		RecoveryCode   string `json:"recovery_code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if (req.Code == "") == (req.RecoveryCode == "") {
+		http.Error(w, "code: exactly one of code or recovery_code is required", http.StatusBadRequest)
+		return
+	}
+
+	claims, err := validateToken(req.ChallengeToken, refreshSecret)
+	var userID int
+	if err == nil {
+		if purpose, _ := claims["purpose"].(string); purpose != purposeLoginChallenge {
+			err = errors.New("wrong token purpose")
+		}
+	}
+	if err == nil {
+		sub, _ := claims["sub"].(string)
+		userID, err = strconv.Atoi(sub)
+	}
+	if err != nil {
+		http.Error(w, "Invalid or expired challenge token", http.StatusUnauthorized)
+		return
+	}
+	// Токен одноразовый: погашается первой же попыткой, удачной или нет. После неверного кода
+	// нужно снова ввести пароль, поэтому один токен не даёт перебирать коды.
+	jti, _ := claims["jti"].(string)
+	exp, _ := claims["ExpiresAt"].(float64)
+	if jti == "" {
+		http.Error(w, "Invalid or expired challenge token", http.StatusUnauthorized)
+		return
+	}
+	err = s.twoFactor.UseLoginChallenge(r.Context(), jti, time.Unix(int64(exp), 0))
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Invalid or expired challenge token", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		log.Printf("Error consuming login challenge of user %d: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	totp, err := s.twoFactor.GetTOTP(r.Context(), userID)
+	if errors.Is(err, ErrNotFound) || err == nil && !totp.Confirmed {
+		// 2FA отключили после первого шага — нужно войти заново
+		http.Error(w, "Invalid or expired challenge token", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading TOTP secret of user %d: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Коды считаются вместе с паролями: перебор кода приостанавливает вход в аккаунт
+	profile, err := s.users.GetProfile(r.Context(), userID)
+	if err != nil {
+		writeAuthzError(w, err)
+		return
+	}
+	ip := clientIP(r, loginThrottle.TrustProxy)
+	if !s.beginLoginAttempt(w, r, profile.Username, &userID, ip) {
+		return
+	}
+
+	ok := false
+	if req.Code != "" {
+		ok, err = s.checkTOTPCode(r.Context(), totp, req.Code)
+	} else {
+		err = s.twoFactor.UseRecoveryCode(r.Context(), userID, hashToken(normalizeRecoveryCode(req.RecoveryCode)))
+		ok = err == nil
+		if errors.Is(err, ErrNotFound) {
+			err = nil
+		} else if ok {
+			log.Printf("User %d logged in with a recovery code", userID)
+		}
+	}
+	if err != nil {
+		log.Printf("Error checking second factor of user %d: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		s.recordLoginFailure(r.Context(), profile.Username, &userID, ip, loginFailedSecondFactor)
+		http.Error(w, "Invalid code", http.StatusUnauthorized)
+		return
+	}
+
+	s.resetLoginFailures(r.Context(), profile.Username, ip)
+	s.startSession(w, r, userID)
+}
+
+// POST /api/profile/2fa {"password": "..."} — новый секрет и ссылка otpauth:// для приложения-аутентификатора;
+// DELETE /api/profile/2fa {"password": "..."} — отключение 2FA.
+// Пароль нужен и при подключении: иначе украденный токен доступа позволил бы привязать 2FA
+// к чужому приложению и запереть владельца аккаунта.
+func (s *server) twoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := userIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		var req struct {
+			Password string `json:"password"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		user, ok := s.checkCurrentPassword(w, r, userID, req.Password)
+		if !ok {
+			return
+		}
+		secret, err := newTOTPSecret()
+		if err == nil {
+			err = s.twoFactor.SetTOTPSecret(r.Context(), userID, secret)
+		}
+		if errors.Is(err, ErrDuplicateKey) {
+			http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			log.Printf("Error starting 2FA enrolment for user %d: %v", userID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{
+			"secret":      secret,
+			"otpauth_uri": totpURI(secret, user.Username),
+		})
+
+	case http.MethodDelete:
+		var req struct {
+			Password string `json:"password"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if _, ok := s.checkCurrentPassword(w, r, userID, req.Password); !ok {
+			return
+		}
+		err := s.twoFactor.DeleteTOTP(r.Context(), userID)
+		if errors.Is(err, ErrNotFound) {
+			http.Error(w, "Two-factor authentication is not enabled", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("Error disabling 2FA for user %d: %v", userID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("User %d disabled two-factor authentication", userID)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// POST /api/profile/2fa/confirm {"code": "123456"} — подтверждение подключения первым кодом;
+// в ответе коды восстановления
+func (s *server) confirmTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	userID, err := userIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	totp, err := s.twoFactor.GetTOTP(r.Context(), userID)
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Two-factor enrolment has not been started", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading TOTP secret of user %d: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if totp.Confirmed {
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+	ok, err := s.checkTOTPCode(r.Context(), totp, req.Code)
+	if err != nil {
+		log.Printf("Error checking TOTP code of user %d: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "code: invalid code", http.StatusBadRequest)
+		return
+	}
+
+	codes, err := newRecoveryCodes()
+	if err == nil {
+		err = s.twoFactor.ConfirmTOTP(r.Context(), userID, hashRecoveryCodes(codes))
+	}
+	if err != nil {
+		log.Printf("Error confirming 2FA for user %d: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("User %d enabled two-factor authentication", userID)
+	writeRecoveryCodes(w, codes)
+}
+
+// POST /api/profile/2fa/recovery-codes {"password": "..."} — новые коды восстановления взамен прежних
+func (s *server) recoveryCodesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	userID, err := userIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var req struct {
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if _, ok := s.checkCurrentPassword(w, r, userID, req.Password); !ok {
+		return
+	}
+	totp, err := s.twoFactor.GetTOTP(r.Context(), userID)
+	if errors.Is(err, ErrNotFound) || err == nil && !totp.Confirmed {
+		http.Error(w, "Two-factor authentication is not enabled", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading TOTP secret of user %d: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	codes, err := newRecoveryCodes()
+	if err == nil {
+		err = s.twoFactor.ReplaceRecoveryCodes(r.Context(), userID, hashRecoveryCodes(codes))
+	}
+	if err != nil {
+		log.Printf("Error regenerating recovery codes for user %d: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	writeRecoveryCodes(w, codes)
+}
@@ -13,8 +13,8 @@ import (
 )
 
 var (
-	accessSecret    = []byte("TaskMasterTaskFlowCourseWork") // Секретный ключ для подписи токенов
-	refreshSecret   = []byte("7daysitsonlytimewhenwelive")
+	accessSecret    = []byte(devAccessSecret) // Секретный ключ для подписи токенов (задаётся конфигурацией)
+	refreshSecret   = []byte(devRefreshSecret)
 	accessTokenTTL  = time.Minute * 15   // Время жизни токена доступа
 	refreshTokenTTL = time.Hour * 24 * 7 // Время жизни токена обновления
 )
@@ -27,7 +27,7 @@ func generalMiddleware(next http.Handler) http.Handler {
 
 		// CORS Headers
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
 		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 
 		// Если это OPTIONS запрос, сразу отвечаем
@@ -73,7 +73,8 @@ func authMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-func tokenAuthMiddleware(next http.Handler) http.Handler {
+// Аутентификация по access-токену (JWT) или персональному токену доступа (см. tokens.go)
+func (s *server) tokenAuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Получаем токен из заголовков
 		token := r.Header.Get("Authorization")
@@ -86,6 +87,12 @@ func tokenAuthMiddleware(next http.Handler) http.Handler {
 		// Убираем префикс "Bearer" из токена, если он есть
 		token = strings.TrimPrefix(token, "Bearer ")
 
+		// Персональный токен доступа проверяется по хранилищу, с учётом его областей
+		if strings.HasPrefix(token, accessTokenPrefix) {
+			s.serveWithAccessToken(w, r, token, next)
+			return
+		}
+
 		// Проверяем токен
 		claims, err := validateToken(token, accessSecret)
 		if err != nil {
@@ -102,7 +109,7 @@ func tokenAuthMiddleware(next http.Handler) http.Handler {
 		}
 
 		// Добавляем userID в контекст запроса
-		ctx := context.WithValue(r.Context(), "userID", userID)
+		ctx := context.WithValue(r.Context(), userIDKey, userID)
 
 		// Вызываем следующий обработчик с обновленным контекстом
 		next.ServeHTTP(w, r.WithContext(ctx))
@@ -152,14 +159,43 @@ func generateAccessToken(userID string) (string, error) {
 	return token.SignedString(accessSecret)                    // Подписание токена другим секретным ключом
 }
 
-func generateRefreshToken(userID string) (string, error) {
+// Refresh-токен привязан к семейству (сессии) и имеет уникальный jti, поэтому каждый выданный токен различим
+func generateRefreshToken(userID, familyID string) (string, time.Time, error) {
+	jti, err := randomID(16)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("ошибка генерации jti: %v", err)
+	}
+	expiresAt := time.Now().Add(refreshTokenTTL)
 	claims := jwt.MapClaims{
 		"userID":    userID,
-		"ExpiresAt": time.Now().Add(refreshTokenTTL).Unix(), // Срок действия 7 дней
-		"IssuedAt":  time.Now(),                             // Время создания токена
+		"family":    familyID,
+		"jti":       jti,
+		"ExpiresAt": expiresAt.Unix(), // Срок действия 7 дней
+		"IssuedAt":  time.Now(),       // Время создания токена
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	signed, err := token.SignedString(refreshSecret)
+	return signed, expiresAt, err
+}
+
+// Токен с назначением purpose: ссылка из письма или второй шаг входа. Подписывается refresh-секретом,
+// но без claims userID и family, поэтому не принимается ни как access-, ни как refresh-токен
+func generatePurposeToken(userID int, purpose string, ttl time.Duration) (string, time.Time, error) {
+	jti, err := randomID(16)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("ошибка генерации jti: %v", err)
+	}
+	expiresAt := time.Now().Add(ttl)
+	claims := jwt.MapClaims{
+		"sub":       strconv.Itoa(userID),
+		"purpose":   purpose,
+		"jti":       jti,
+		"ExpiresAt": expiresAt.Unix(),
+		"IssuedAt":  time.Now(),
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(refreshSecret)
+	signed, err := token.SignedString(refreshSecret)
+	return signed, expiresAt, err
 }
 
 func handleError(w http.ResponseWriter, err error, status int) {
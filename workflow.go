@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Ошибки смены статуса задачи
+var (
+	ErrStatusTransition = errors.New("status transition not allowed")
+	ErrStatusConflict   = errors.New("task status changed concurrently")
+)
+
+// Рабочий процесс задач: начальный статус и разрешённые переходы из каждого статуса.
+// Задаётся в конфигурации (tasks.workflow); статусы, которых нет в Transitions, недопустимы.
+// Completed считается выполнением в прогрессе и при рекурсивном завершении; Cancelled (необязателен)
+// не учитывается в прогрессе и не меняется при рекурсивном завершении.
+type Workflow struct {
+	Initial     string              `yaml:"initial"`
+	Completed   string              `yaml:"completed"`
+	Cancelled   string              `yaml:"cancelled"`
+	Transitions map[string][]string `yaml:"transitions"`
+}
+
+// Действующий рабочий процесс (задаётся конфигурацией)
+var taskWorkflow = defaultWorkflow()
+
+// todo → in_progress → review → done, плюс cancelled из любого незавершённого статуса
+func defaultWorkflow() Workflow {
+	return Workflow{
+		Initial:   "todo",
+		Completed: "done",
+		Cancelled: "cancelled",
+		Transitions: map[string][]string{
+			"todo":        {"in_progress", "cancelled"},
+			"in_progress": {"todo", "review", "done", "cancelled"},
+			"review":      {"in_progress", "done", "cancelled"},
+			"done":        {"in_progress"},
+			"cancelled":   {"todo"},
+		},
+	}
+}
+
+// Статус известен рабочему процессу
+func (w Workflow) Valid(status string) bool {
+	_, ok := w.Transitions[status]
+	return ok
+}
+
+// Разрешён ли переход from → to. Из статуса, которого нет в рабочем процессе
+// (старые данные или статус, удалённый из конфигурации), можно перейти в любой допустимый.
+func (w Workflow) CanTransition(from, to string) bool {
+	if !w.Valid(to) {
+		return false
+	}
+	next, ok := w.Transitions[from]
+	if !ok {
+		return true
+	}
+	for _, s := range next {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Проверка перехода с ошибкой для клиента
+func (w Workflow) CheckTransition(from, to string) error {
+	if from == to || w.CanTransition(from, to) {
+		return nil
+	}
+	return fmt.Errorf("%w: %q → %q", ErrStatusTransition, from, to)
+}
+
+// Задача закрыта: выполнена или отменена — такие не бывают просроченными
+func (w Workflow) Closed(status string) bool {
+	return status == w.Completed || (w.Cancelled != "" && status == w.Cancelled)
+}
+
+// Статусы закрытых задач — для запросов к базе
+func (w Workflow) ClosedStatuses() []string {
+	if w.Cancelled == "" {
+		return []string{w.Completed}
+	}
+	return []string{w.Completed, w.Cancelled}
+}
+
+// Отсортированный список статусов — для сообщений об ошибках
+func (w Workflow) Statuses() []string {
+	statuses := make([]string, 0, len(w.Transitions))
+	for s := range w.Transitions {
+		statuses = append(statuses, s)
+	}
+	sort.Strings(statuses)
+	return statuses
+}
+
+func (w Workflow) Validate() error {
+	var errs []error
+	if len(w.Transitions) == 0 {
+		errs = append(errs, errors.New("tasks.workflow.transitions: не задан ни один статус"))
+	}
+	if !w.Valid(w.Initial) {
+		errs = append(errs, fmt.Errorf("tasks.workflow.initial: статус %q отсутствует в transitions", w.Initial))
+	}
+	if !w.Valid(w.Completed) {
+		errs = append(errs, fmt.Errorf("tasks.workflow.completed: статус %q отсутствует в transitions", w.Completed))
+	}
+	if w.Cancelled != "" && !w.Valid(w.Cancelled) {
+		errs = append(errs, fmt.Errorf("tasks.workflow.cancelled: статус %q отсутствует в transitions", w.Cancelled))
+	}
+	for from, next := range w.Transitions {
+		if from == "" {
+			errs = append(errs, errors.New("tasks.workflow.transitions: пустое имя статуса"))
+		}
+		for _, to := range next {
+			if !w.Valid(to) {
+				errs = append(errs, fmt.Errorf("tasks.workflow.transitions.%s: неизвестный статус %q", from, to))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
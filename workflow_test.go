@@ -0,0 +1,46 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDefaultWorkflowTransitions(t *testing.T) {
+	w := defaultWorkflow()
+	require.NoError(t, w.Validate())
+
+	assert.NoError(t, w.CheckTransition("todo", "in_progress"))
+	assert.NoError(t, w.CheckTransition("review", "done"))
+	assert.NoError(t, w.CheckTransition("done", "done"), "Повторная установка того же статуса — не переход")
+	assert.ErrorIs(t, w.CheckTransition("todo", "done"), ErrStatusTransition)
+	assert.ErrorIs(t, w.CheckTransition("cancelled", "done"), ErrStatusTransition)
+	assert.ErrorIs(t, w.CheckTransition("todo", "garbage"), ErrStatusTransition)
+	assert.NoError(t, w.CheckTransition("legacy", "review"), "Из неизвестного статуса можно перейти в любой допустимый")
+}
+
+func TestWorkflowValidate(t *testing.T) {
+	w := Workflow{Initial: "new", Transitions: map[string][]string{"open": {"closed"}}}
+	err := w.Validate()
+	assert.ErrorContains(t, err, "tasks.workflow.initial")
+	assert.ErrorContains(t, err, `неизвестный статус "closed"`)
+}
+
+func TestLoadConfigWorkflowReplacesDefault(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte(`
+tasks:
+  workflow:
+    initial: open
+    completed: closed
+    transitions:
+      open: [closed]
+      closed: [open]
+`), 0o600))
+
+	cfg, err := loadConfig(configPath)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"closed", "open"}, cfg.Tasks.Workflow.Statuses(), "Карта из файла заменяет процесс по умолчанию целиком")
+}
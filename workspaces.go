@@ -0,0 +1,407 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Название личного пространства, которое создаётся вместе с пользователем
+const personalWorkspaceName = "Личное"
+
+func validDefaultRole(role string) bool {
+	return role == roleEditor || role == roleViewer || role == roleNone
+}
+
+func validWorkspaceRole(role string) bool {
+	return role == workspaceAdmin || role == workspaceMember
+}
+
+// Пространство для списков блокнотов, задач и поиска: ?workspace_id=, иначе выбранное пользователем.
+// При ok = false ответ с ошибкой уже записан.
+func (s *server) requestWorkspace(w http.ResponseWriter, r *http.Request, userID int) (Workspace, bool) {
+	v := r.URL.Query().Get("workspace_id")
+	if v == "" {
+		workspace, err := s.workspaces.CurrentWorkspace(r.Context(), userID)
+		if err != nil {
+			http.Error(w, "Failed to load current workspace: "+err.Error(), http.StatusInternalServerError)
+			return Workspace{}, false
+		}
+		return workspace, true
+	}
+	id, err := strconv.Atoi(v)
+	if err != nil {
+		http.Error(w, "workspace_id: must be an integer", http.StatusBadRequest)
+		return Workspace{}, false
+	}
+	var workspace Workspace
+	role, err := s.authorizeWorkspace(r.Context(), userID, id, workspaceMember)
+	if err == nil {
+		workspace, err = s.workspaces.GetWorkspace(r.Context(), id)
+	}
+	if err != nil {
+		writeAuthzError(w, err)
+		return Workspace{}, false
+	}
+	workspace.Role = role
+	return workspace, true
+}
+
+// Последний администратор не может уйти или стать обычным участником
+func (s *server) isLastAdmin(ctx context.Context, workspaceID, userID int) (bool, error) {
+	members, err := s.workspaces.ListWorkspaceMembers(ctx, workspaceID)
+	if err != nil {
+		return false, err
+	}
+	admins, isAdmin := 0, false
+	for _, m := range members {
+		if m.Role == workspaceAdmin {
+			admins++
+			isAdmin = isAdmin || m.UserID == userID
+		}
+	}
+	return isAdmin && admins == 1, nil
+}
+
+// GET /api/workspaces — пространства пользователя, POST — новое пространство
+func (s *server) workspacesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := userIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	switch r.Method {
+	case http.MethodGet:
+		workspaces, err := s.workspaces.ListWorkspaces(r.Context(), userID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error fetching workspaces: %v", err), http.StatusInternalServerError)
+			return
+		}
+		current, err := s.workspaces.CurrentWorkspace(r.Context(), userID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error fetching current workspace: %v", err), http.StatusInternalServerError)
+			return
+		}
+		for i := range workspaces {
+			workspaces[i].Current = workspaces[i].ID == current.ID
+		}
+		if workspaces == nil {
+			workspaces = []Workspace{}
+		}
+		json.NewEncoder(w).Encode(workspaces)
+
+	case http.MethodPost:
+		var req struct {
+			Name        string `json:"name"`
+			DefaultRole string `json:"default_role"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if req.Name == "" {
+			http.Error(w, "name: must be a non-empty string", http.StatusBadRequest)
+			return
+		}
+		if req.DefaultRole == "" {
+			req.DefaultRole = roleViewer
+		}
+		if !validDefaultRole(req.DefaultRole) {
+			http.Error(w, "default_role: must be one of editor, viewer, none", http.StatusBadRequest)
+			return
+		}
+		created, err := s.workspaces.CreateWorkspace(r.Context(), Workspace{Name: req.Name, DefaultRole: req.DefaultRole}, userID)
+		if err != nil {
+			log.Printf("Error creating workspace: %v", err)
+			http.Error(w, "Failed to create workspace", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Location", fmt.Sprintf("/api/workspaces/%d", created.ID))
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(created)
+
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Переключатель пространств: GET /api/workspaces/current — выбранное пространство,
+// PUT с {"workspace_id": N} — выбрать другое. Выбор сохраняется между сессиями.
+func (s *server) currentWorkspaceHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := userIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var req struct {
+			WorkspaceID int `json:"workspace_id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if err := s.workspaces.SetCurrentWorkspace(r.Context(), userID, req.WorkspaceID); err != nil {
+			writeAuthzError(w, err)
+			return
+		}
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	current, err := s.workspaces.CurrentWorkspace(r.Context(), userID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error fetching current workspace: %v", err), http.StatusInternalServerError)
+		return
+	}
+	current.Current = true
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(current)
+}
+
+// GET, PATCH и DELETE /api/workspaces/{id}. Менять и удалять пространство может администратор;
+// вместе с пространством удаляются его блокноты. Личное пространство не удаляется.
+func (s *server) workspaceHandler(w http.ResponseWriter, r *http.Request) {
+	workspaceID, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/api/workspaces/"))
+	if err != nil {
+		http.Error(w, "Invalid workspace_id format", http.StatusBadRequest)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodPatch && r.Method != http.MethodDelete {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := userIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	need := workspaceAdmin
+	if r.Method == http.MethodGet {
+		need = workspaceMember
+	}
+	role, err := s.authorizeWorkspace(r.Context(), userID, workspaceID, need)
+	if err != nil {
+		writeAuthzError(w, err)
+		return
+	}
+	workspace, err := s.workspaces.GetWorkspace(r.Context(), workspaceID)
+	if err != nil {
+		writeAuthzError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	switch r.Method {
+	case http.MethodGet:
+		workspace.Role = role
+		json.NewEncoder(w).Encode(workspace)
+
+	case http.MethodPatch:
+		var patch WorkspacePatch
+		if err := decodePatch(r.Body, &patch); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		patched, err := s.workspaces.PatchWorkspace(r.Context(), workspaceID, patch)
+		if err != nil {
+			writeAuthzError(w, err)
+			return
+		}
+		patched.Role = role
+		json.NewEncoder(w).Encode(patched)
+
+	case http.MethodDelete:
+		if workspace.Personal {
+			http.Error(w, "Personal workspace cannot be deleted", http.StatusBadRequest)
+			return
+		}
+		if err := s.workspaces.DeleteWorkspace(r.Context(), workspaceID); err != nil {
+			writeAuthzError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"message": "Workspace deleted"})
+	}
+}
+
+// Участники пространства: GET и POST — /api/workspaces/{id}/members,
+// PATCH и DELETE — /api/workspaces/{id}/members/{userID}.
+// Список виден всем участникам, состав меняют администраторы; выйти может любой участник.
+func (s *server) workspaceMembersHandler(w http.ResponseWriter, r *http.Request) {
+	workspaceID, memberID, err := parseMembersPath(r.URL.Path, "/api/workspaces/", "workspace_id")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	collection := r.Method == http.MethodGet || r.Method == http.MethodPost
+	item := r.Method == http.MethodPatch || r.Method == http.MethodDelete
+	if !(memberID == 0 && collection || memberID != 0 && item) {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := userIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	need := workspaceAdmin
+	if r.Method == http.MethodGet || r.Method == http.MethodDelete && memberID == userID {
+		need = workspaceMember
+	}
+	if _, err := s.authorizeWorkspace(r.Context(), userID, workspaceID, need); err != nil {
+		writeAuthzError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	switch r.Method {
+	case http.MethodGet:
+		members, err := s.workspaces.ListWorkspaceMembers(r.Context(), workspaceID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error fetching members: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if members == nil {
+			members = []WorkspaceMember{}
+		}
+		json.NewEncoder(w).Encode(members)
+
+	case http.MethodPost:
+		s.addWorkspaceMember(w, r, workspaceID)
+
+	case http.MethodPatch:
+		var req struct {
+			Role string `json:"role"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if !validWorkspaceRole(req.Role) {
+			http.Error(w, "role: must be one of admin, member", http.StatusBadRequest)
+			return
+		}
+		if req.Role != workspaceAdmin {
+			last, err := s.isLastAdmin(r.Context(), workspaceID, memberID)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Error fetching members: %v", err), http.StatusInternalServerError)
+				return
+			}
+			if last {
+				http.Error(w, "role: workspace must keep at least one admin", http.StatusBadRequest)
+				return
+			}
+		}
+		member, err := s.workspaces.UpdateWorkspaceMemberRole(r.Context(), workspaceID, memberID, req.Role)
+		if err != nil {
+			writeAuthzError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(member)
+
+	case http.MethodDelete:
+		last, err := s.isLastAdmin(r.Context(), workspaceID, memberID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error fetching members: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if last {
+			http.Error(w, "Workspace must keep at least one admin", http.StatusBadRequest)
+			return
+		}
+		if err := s.workspaces.RemoveWorkspaceMember(r.Context(), workspaceID, memberID); err != nil {
+			writeAuthzError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"message": "Member removed"})
+	}
+}
+
+// POST /api/workspaces/{id}/members: добавление по username или email, роль по умолчанию — member.
+// По email ответ всегда 202, как и при приглашении в блокнот
+func (s *server) addWorkspaceMember(w http.ResponseWriter, r *http.Request, workspaceID int) {
+	var req struct {
+		Username string `json:"username"`
+		Email    string `json:"email"`
+		Role     string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if (req.Username == "") == (req.Email == "") {
+		http.Error(w, "username: exactly one of username or email is required", http.StatusBadRequest)
+		return
+	}
+	if req.Role == "" {
+		req.Role = workspaceMember
+	}
+	if !validWorkspaceRole(req.Role) {
+		http.Error(w, "role: must be one of admin, member", http.StatusBadRequest)
+		return
+	}
+	workspace, err := s.workspaces.GetWorkspace(r.Context(), workspaceID)
+	if err != nil {
+		writeAuthzError(w, err)
+		return
+	}
+	if workspace.Personal {
+		http.Error(w, "Personal workspace cannot have members; share notebooks instead", http.StatusBadRequest)
+		return
+	}
+
+	var user User
+	if req.Username != "" {
+		user, err = s.users.GetUserByUsername(r.Context(), req.Username)
+	} else {
+		user, err = s.users.GetUserByEmail(r.Context(), req.Email)
+	}
+	if errors.Is(err, ErrNotFound) && req.Email != "" {
+		writeEmailInviteAccepted(w)
+		return
+	}
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error looking up workspace member: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	member, err := s.workspaces.AddWorkspaceMember(r.Context(), WorkspaceMember{WorkspaceID: workspaceID, UserID: user.ID, Role: req.Role})
+	if errors.Is(err, ErrDuplicateKey) && req.Email != "" {
+		writeEmailInviteAccepted(w)
+		return
+	}
+	if errors.Is(err, ErrDuplicateKey) {
+		http.Error(w, "User is already a member of this workspace", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error adding workspace member: %v", err)
+		http.Error(w, "Failed to add member", http.StatusInternalServerError)
+		return
+	}
+	if req.Email != "" {
+		writeEmailInviteAccepted(w)
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("/api/workspaces/%d/members/%d", workspaceID, user.ID))
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(member)
+}